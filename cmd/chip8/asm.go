@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ambertide/chip8/pkg/asm"
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+// Assemble the source given as the argument into a ROM, with its own flags.
+func runAssembler(arguments []string) {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	platformName := flags.String("platform", "chip8", "Sets the platform, one of chip8, schip, xochip or eti660.")
+	outputPath := flags.String("o", "", "Writes the ROM to this file, defaults to the source with the .ch8 extension.")
+	symbols := flags.Bool("sym", false, "Writes the symbol map of the debuggers next to the ROM with the .sym extension.")
+	listingPath := flags.String("list", "", "Writes a listing of the addresses, bytes and source lines to this file.")
+	flags.Parse(arguments)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: chip8 asm [flags] prog.c8s")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	if err := assemble(flags.Arg(0), *platformName, *outputPath, *symbols, *listingPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Write the ROM assembled from the source to the output path, along
+// with its symbol map and its listing if they are requested.
+func assemble(sourcePath string, platformName string, outputPath string, symbols bool, listingPath string) error {
+	platform, err := device.PlatformByName(platformName)
+	if err != nil {
+		return err
+	}
+	program, err := asm.AssembleFile(sourcePath, asm.Options{Platform: platform})
+	if err != nil {
+		return err
+	}
+	if outputPath == "" {
+		outputPath = strings.TrimSuffix(sourcePath, filepath.Ext(sourcePath)) + ".ch8"
+	}
+	if err := os.WriteFile(outputPath, program.ROM, 0o644); err != nil {
+		return err
+	}
+	if symbols {
+		symbolsPath := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".sym"
+		if err := writeFile(symbolsPath, program.Symbols(filepath.Dir(symbolsPath)).Write); err != nil {
+			return err
+		}
+	}
+	if listingPath != "" {
+		return writeFile(listingPath, program.WriteListing)
+	}
+	return nil
+}
+
+// Create the file at the path and write to it with the function.
+func writeFile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/ambertide/chip8/pkg/debug"
+	"github.com/ambertide/chip8/pkg/emulator"
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+// Serve the Debug Adapter Protocol on the standard streams, or
+// on a TCP address, with its own flags for the defaults of launches.
+func runDAP(arguments []string) {
+	flags := flag.NewFlagSet("dap", flag.ExitOnError)
+	listenAddress := flags.String("listen", "", "Serves on this TCP address, e.g. :4711, instead of the standard streams.")
+	clockSpeed := flags.Uint64("speed", 500, "Sets the default speed of the main processor in Hz.")
+	platformName := flags.String("platform", "chip8", "Sets the default platform, one of chip8, schip, xochip or eti660.")
+	quirksName := flags.String("quirks", "", "Sets the default quirks profile, defaults to the one of the platform.")
+	flags.Parse(arguments)
+	server := debug.NewDAPServer(launcher(debug.LaunchArguments{Platform: *platformName, Quirks: *quirksName, Speed: *clockSpeed}))
+	var err error
+	if *listenAddress == "" {
+		err = server.ServeConn(os.Stdin, os.Stdout)
+	} else {
+		var listener net.Listener
+		if listener, err = net.Listen("tcp", *listenAddress); err == nil {
+			err = server.Serve(listener)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Return a launcher running the programs on a machine without a
+// window, the unset launch arguments are taken from the defaults.
+func launcher(defaults debug.LaunchArguments) debug.Launcher {
+	return func(arguments debug.LaunchArguments) (*debug.Debugger, func(), error) {
+		if arguments.Platform == "" {
+			arguments.Platform = defaults.Platform
+		}
+		if arguments.Quirks == "" {
+			arguments.Quirks = defaults.Quirks
+		}
+		if arguments.Speed == 0 {
+			arguments.Speed = defaults.Speed
+		}
+		platform, err := device.PlatformByName(arguments.Platform)
+		if err != nil {
+			return nil, nil, err
+		}
+		config := device.Config{Platform: platform, Quirks: platform.DefaultQuirks(), Seed: time.Now().UnixNano()}
+		if arguments.Quirks != "" {
+			if config.Quirks, err = device.QuirksByName(arguments.Quirks); err != nil {
+				return nil, nil, err
+			}
+		}
+		rom, err := os.ReadFile(arguments.Program)
+		if err != nil {
+			return nil, nil, err
+		}
+		machine := emulator.NewMachine(config, arguments.Speed)
+		if err := machine.LoadROM(rom); err != nil {
+			return nil, nil, err
+		}
+		debugger := debug.NewDebugger(machine.Processor())
+		stop := make(chan struct{})
+		go emulator.NewScheduler(debugger, arguments.Speed).Run(stop)
+		return debugger, func() { close(stop) }, nil
+	}
+}
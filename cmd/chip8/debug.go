@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/ambertide/chip8/pkg/debug"
+	"github.com/ambertide/chip8/pkg/emulator"
+)
+
+// Run the program under the terminal debugger, interrupting
+// pauses the execution instead of exiting.
+func runDebugger(options emulator.Options) {
+	rom, err := os.ReadFile(options.ProgramPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	machine := emulator.NewMachine(options.Config, options.ClockSpeed)
+	if err := machine.LoadROM(rom); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	debugger := debug.NewDebugger(machine.Processor())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		for range interrupts {
+			debugger.Pause()
+		}
+	}()
+	cycles := int(options.ClockSpeed / emulator.FrameRate)
+	if cycles == 0 {
+		cycles = 1
+	}
+	if err := debug.NewREPL(debugger, os.Stdout, cycles).Run(os.Stdin); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
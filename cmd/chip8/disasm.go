@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ambertide/chip8/pkg/disasm"
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+// Disassemble the ROM given as the argument, with its own flags.
+func runDisassembler(arguments []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	platformName := flags.String("platform", "chip8", "Sets the platform, one of chip8, schip, xochip or eti660.")
+	outputPath := flags.String("o", "", "Writes the listing to this file instead of the standard output.")
+	flags.Parse(arguments)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: chip8 disasm [flags] rom.ch8")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	if err := disassemble(flags.Arg(0), *platformName, *outputPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Write the listing of the ROM to the output path, or the standard output.
+func disassemble(romPath string, platformName string, outputPath string) error {
+	platform, err := device.PlatformByName(platformName)
+	if err != nil {
+		return err
+	}
+	rom, err := os.ReadFile(romPath)
+	if err != nil {
+		return err
+	}
+	var output io.Writer = os.Stdout
+	if outputPath != "" {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+	return disasm.Disassemble(rom, platform).Write(output)
+}
@@ -2,19 +2,167 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/ambertide/chip8/pkg/emulator"
-	"github.com/faiface/pixel/pixelgl"
+	"github.com/ambertide/chip8/pkg/emulator/device"
+	"github.com/ambertide/chip8/pkg/frontend/audio"
+	"github.com/ambertide/chip8/pkg/frontend/gui"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "asm":
+			runAssembler(os.Args[2:])
+			return
+		case "dap":
+			runDAP(os.Args[2:])
+			return
+		case "disasm":
+			runDisassembler(os.Args[2:])
+			return
+		case "recompile":
+			runRecompiler(os.Args[2:])
+			return
+		}
+	}
 	clockSpeed := flag.Uint64("speed", 500, "Sets the speed of the main processor in Hz.")
 	programPath := flag.String("rom", "", "Path to the rom file for chip8.")
-	flag.Parse()
+	platformName := flag.String("platform", "chip8", "Sets the platform, one of chip8, schip, xochip, eti660 or vip.")
+	quirksName := flag.String("quirks", "", "Sets the quirks profile, one of cowgod, vip, chip48, schip or xochip, defaults to the one of the platform.")
+	machineCalls := flag.String("machine-calls", "ignore", "Sets what happens on unhandled 0NNN machine code calls, one of ignore, log or fault.")
+	seed := flag.Int64("seed", 0, "Sets the seed of the random number generator, defaults to the current time or to zero in headless mode.")
+	vipMonitorPath := flag.String("vip-monitor", "", "Path to the COSMAC VIP monitor ROM image for the vip platform.")
+	vipInterpreterPath := flag.String("vip-interpreter", "", "Path to the COSMAC VIP Chip-8 interpreter image for the vip platform.")
+	headless := flag.Bool("headless", false, "Runs without a window or sound as fast as possible, for testing.")
+	frames := flag.Uint64("frames", 0, "Stops after this many frames in headless mode.")
+	cycles := flag.Uint64("cycles", 0, "Stops after this many cycles in headless mode.")
+	keyScript := flag.String("keys", "", "Scripted key presses in headless mode as frame:keys pairs, e.g. 10:5,12:,30:AB.")
+	pngPath := flag.String("png", "", "Writes the final frame in headless mode to this PNG file.")
+	asciiPath := flag.String("ascii", "", "Writes the final frame in headless mode to this text file.")
+	loadState := flag.String("load-state", "", "Loads the save state from this file after the rom.")
+	saveState := flag.String("save-state-on-exit", "", "Saves the state to this file when the program exits.")
+	rewindSeconds := flag.Int("rewind", 10, "Sets the number of seconds that can be rewound by holding backspace, 0 disables rewinding.")
+	gdbAddress := flag.String("gdb", "", "Serves the GDB remote protocol on this TCP address, e.g. :1234, and waits for a debugger.")
+	jit := flag.Bool("jit", false, "Runs translated blocks of code instead of decoding every instruction, the results are the same.")
+	// The run subcommand is the same as no subcommand.
+	arguments := os.Args[1:]
+	subcommand := "run"
+	if len(arguments) > 0 && (arguments[0] == "run" || arguments[0] == "debug") {
+		subcommand, arguments = arguments[0], arguments[1:]
+	}
+	flag.CommandLine.Parse(arguments)
+	if *programPath == "" && flag.NArg() > 0 {
+		*programPath = flag.Arg(0)
+	}
 	if *programPath == "" {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
-	pixelgl.Run(func() { emulator.RunEmulator(*clockSpeed, *programPath) })
+	options := emulator.Options{
+		ClockSpeed:    *clockSpeed,
+		ProgramPath:   *programPath,
+		LoadStatePath: *loadState,
+		SaveStatePath: *saveState,
+		RewindSeconds: *rewindSeconds,
+		GDBAddress:    *gdbAddress,
+	}
+	if *platformName == "vip" {
+		// The original interpreter is run instead of the processor.
+		if *vipMonitorPath == "" || *vipInterpreterPath == "" {
+			fmt.Fprintln(os.Stderr, "vip platform requires the -vip-monitor and -vip-interpreter images")
+			flag.PrintDefaults()
+			os.Exit(1)
+		}
+		options.VIPMonitorPath, options.VIPInterpreterPath = *vipMonitorPath, *vipInterpreterPath
+	} else {
+		options.Config = parseConfig(*platformName, *quirksName, *machineCalls, *seed, *headless)
+		options.Config.JIT = *jit
+	}
+	if subcommand == "debug" {
+		if options.VIPMonitorPath != "" {
+			fmt.Fprintln(os.Stderr, "the debugger does not support the vip platform")
+			os.Exit(1)
+		}
+		runDebugger(options)
+		return
+	}
+	if !*headless {
+		run(options)
+		return
+	}
+	keys, err := emulator.ParseKeyScript(*keyScript)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	err = emulator.RunHeadless(options, emulator.HeadlessOptions{
+		Frames:    *frames,
+		Cycles:    *cycles,
+		Keys:      keys,
+		PNGPath:   *pngPath,
+		ASCIIPath: *asciiPath,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Build the processor configuration from the flags, exits if
+// any of them is invalid. Headless runs are seeded with zero by
+// default so that they are reproducible.
+func parseConfig(platformName string, quirksName string, machineCalls string, seed int64, headless bool) device.Config {
+	platform, err := device.PlatformByName(platformName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	config := device.Config{Platform: platform, Quirks: platform.DefaultQuirks()}
+	if quirksName != "" {
+		config.Quirks, err = device.QuirksByName(quirksName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			flag.PrintDefaults()
+			os.Exit(1)
+		}
+	}
+	if !headless {
+		config.Seed = time.Now().UnixNano()
+	}
+	if isFlagSet("seed") {
+		config.Seed = seed
+	}
+	config.MachineCallPolicy, err = device.MachineCallPolicyByName(machineCalls)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	return config
+}
+
+// Returns true if the flag is set in the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// Run the emulator and exit with a non-zero status if it fails.
+func run(options emulator.Options) {
+	var err error
+	gui.Run(func() { err = emulator.RunEmulator(options, gui.Renderer{}, audio.Speaker{}) })
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+	"github.com/ambertide/chip8/pkg/recompiler"
+)
+
+// Recompile the ROM given as the argument into a Go program, with its own flags.
+func runRecompiler(arguments []string) {
+	flags := flag.NewFlagSet("recompile", flag.ExitOnError)
+	platformName := flags.String("platform", "chip8", "Sets the platform, one of chip8, schip, xochip or eti660.")
+	quirksName := flags.String("quirks", "", "Sets the quirks profile the code is compiled for, defaults to the one of the platform.")
+	outputPath := flags.String("o", "", "Writes the program to this file instead of the standard output.")
+	flags.Parse(arguments)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: chip8 recompile [flags] rom.ch8")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	if err := recompile(flags.Arg(0), *platformName, *quirksName, *outputPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Write the program recompiled from the ROM to the output path, or the standard output.
+func recompile(romPath string, platformName string, quirksName string, outputPath string) error {
+	platform, err := device.PlatformByName(platformName)
+	if err != nil {
+		return err
+	}
+	options := recompiler.Options{Platform: platform, Quirks: platform.DefaultQuirks(), Name: filepath.Base(romPath)}
+	if quirksName != "" {
+		if options.Quirks, err = device.QuirksByName(quirksName); err != nil {
+			return err
+		}
+	}
+	rom, err := os.ReadFile(romPath)
+	if err != nil {
+		return err
+	}
+	var output io.Writer = os.Stdout
+	if outputPath != "" {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+	return recompiler.Recompile(rom, options, output)
+}
@@ -0,0 +1,540 @@
+// Contains an assembler for Cowgod mnemonics, which turns source files
+// into ROMs along with the symbol maps the debuggers read.
+package asm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+	"github.com/ambertide/chip8/pkg/isa"
+)
+
+// Maximum depth of nested macro expansions.
+const maxExpansionDepth = 64
+
+// Operands that are written as they are rather than as registers
+// or values, which cannot be used as names.
+var reservedNames = map[string]bool{
+	"I": true, "DT": true, "ST": true, "K": true, "F": true, "HF": true, "B": true, "R": true, "LONG": true,
+}
+
+// Options of the assembly.
+type Options struct {
+	// The platform, which determines the instructions, the
+	// address the program is loaded at and the memory size.
+	Platform device.Platform
+}
+
+// An error in the source, at a line of a file.
+type Error struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// The errors of an assembly, in the order of the source.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// The position of a statement, which is that of the
+// invocation for the statements of a macro.
+type location struct {
+	file  string
+	line  int
+	macro string
+}
+
+// A label, or a constant evaluated on its first use.
+type symbol struct {
+	location
+	value int
+	label bool
+	// Expression of the constant and the address it was defined at.
+	expression string
+	address    int
+	evaluated  bool
+	evaluating bool
+}
+
+type macro struct {
+	location
+	name       string
+	parameters []string
+	lines      []string
+}
+
+// Return the names of the labels defined in the body of the macro.
+func (m *macro) labels() []string {
+	var labels []string
+	for _, line := range m.lines {
+		name, _ := splitWord(line)
+		if colon := strings.IndexByte(name, ':'); colon >= 0 && isIdentifier(name[:colon]) {
+			labels = append(labels, name[:colon])
+		}
+	}
+	return labels
+}
+
+// An instruction or a data directive, whose operands
+// are evaluated once all labels are defined.
+type statement struct {
+	location
+	text    string
+	address int
+	size    int
+	// The db or dw directive, empty for instructions.
+	directive string
+	kind      isa.Kind
+	operands  []string
+}
+
+type assembler struct {
+	platform device.Platform
+	table    *isa.Table
+	origin   int
+	size     int
+	address  int
+	symbols  map[string]*symbol
+	macros   map[string]*macro
+	// The macro whose lines are being read.
+	definition *macro
+	depth      int
+	// Number of macro expansions, which tells their labels apart.
+	expansions int
+	// Files being read, the includes of one another.
+	including  []string
+	statements []*statement
+	errors     ErrorList
+}
+
+// Assemble the source file at the path, the files it includes are
+// read relative to the directory of the file including them.
+func AssembleFile(path string, options Options) (*Program, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Assemble(path, source, options)
+}
+
+// Assemble the source, named by the path of its file.
+func Assemble(path string, source []byte, options Options) (*Program, error) {
+	a := &assembler{
+		platform: options.Platform,
+		table:    options.Platform.Opcodes(),
+		origin:   device.RamStartLocation,
+		size:     int(options.Platform.MemorySize()),
+		symbols:  make(map[string]*symbol),
+		macros:   make(map[string]*macro),
+	}
+	if options.Platform == device.ETI660 {
+		a.origin = device.ETI660StartLocation
+	}
+	a.address = a.origin
+	a.readSource(path, source)
+	if a.definition != nil {
+		a.errorf(a.definition.location, "macro %s is not closed with endm", a.definition.name)
+	}
+	if len(a.errors) > 0 {
+		return nil, a.errors
+	}
+	program := a.encode()
+	if len(a.errors) > 0 {
+		return nil, a.errors
+	}
+	return program, nil
+}
+
+// Record an error at the location.
+func (a *assembler) errorf(at location, format string, arguments ...interface{}) {
+	message := fmt.Sprintf(format, arguments...)
+	if at.macro != "" {
+		message += " in macro " + at.macro
+	}
+	a.errors = append(a.errors, &Error{File: at.file, Line: at.line, Message: message})
+}
+
+// Read the lines of the source of the file.
+func (a *assembler) readSource(path string, source []byte) {
+	a.including = append(a.including, filepath.Clean(path))
+	lines := strings.Split(strings.ReplaceAll(string(source), "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		a.readLine(location{file: path, line: i + 1}, line)
+	}
+	a.including = a.including[:len(a.including)-1]
+}
+
+// Read a line, defining its label and laying out its statement.
+func (a *assembler) readLine(at location, line string) {
+	text := strings.TrimSpace(stripComment(line))
+	name, rest := splitWord(text)
+	if a.definition != nil {
+		switch strings.ToLower(name) {
+		case "endm":
+			a.macros[a.definition.name] = a.definition
+			a.definition = nil
+		case "macro":
+			a.errorf(at, "macro defined within macro %s", a.definition.name)
+		default:
+			a.definition.lines = append(a.definition.lines, text)
+		}
+		return
+	}
+	if colon := strings.IndexByte(name, ':'); colon >= 0 && isIdentifier(name[:colon]) {
+		a.defineLabel(at, name[:colon])
+		text = strings.TrimSpace(text[colon+1:])
+		name, rest = splitWord(text)
+	}
+	if name == "" {
+		return
+	}
+	switch strings.ToLower(name) {
+	case "include":
+		a.include(at, rest)
+	case "macro":
+		a.defineMacro(at, rest)
+	case "endm":
+		a.errorf(at, "endm without macro")
+	case "org":
+		a.org(at, rest)
+	case "db", "dw":
+		a.data(at, strings.ToLower(name), rest)
+	default:
+		if keyword, expression := splitWord(rest); strings.EqualFold(keyword, "equ") {
+			a.defineConstant(at, name, expression)
+		} else if m, ok := a.macros[name]; ok {
+			a.expand(at, m, rest)
+		} else {
+			a.instruction(at, name, rest, text)
+		}
+	}
+}
+
+// Check that a label or constant can be named so.
+func (a *assembler) checkName(at location, name string) bool {
+	if !isIdentifier(name) {
+		a.errorf(at, "invalid name %q", name)
+		return false
+	}
+	if _, ok := register(name); ok || reservedNames[strings.ToUpper(name)] {
+		a.errorf(at, "%s is reserved", name)
+		return false
+	}
+	if defined, ok := a.symbols[name]; ok {
+		a.errorf(at, "%s is already defined at %s:%d", name, defined.file, defined.line)
+		return false
+	}
+	return true
+}
+
+func (a *assembler) defineLabel(at location, name string) {
+	if a.checkName(at, name) {
+		a.symbols[name] = &symbol{location: at, value: a.address, label: true, evaluated: true}
+	}
+}
+
+func (a *assembler) defineConstant(at location, name string, expression string) {
+	if expression == "" {
+		a.errorf(at, "missing value of %s", name)
+	} else if a.checkName(at, name) {
+		a.symbols[name] = &symbol{location: at, expression: expression, address: a.address}
+	}
+}
+
+// Return the value of the symbol, evaluating constants on their first use.
+func (a *assembler) lookup(name string) (int, error) {
+	s, ok := a.symbols[name]
+	if !ok {
+		return 0, fmt.Errorf("undefined symbol %s", name)
+	}
+	if s.evaluated {
+		return s.value, nil
+	}
+	if s.evaluating {
+		return 0, fmt.Errorf("constant %s depends on itself", name)
+	}
+	s.evaluating = true
+	value, err := evaluate(s.expression, s.address, a.lookup)
+	s.evaluating = false
+	if err != nil {
+		return 0, err
+	}
+	s.value, s.evaluated = value, true
+	return value, nil
+}
+
+// Evaluate the expression of a statement at the address, which
+// must be between the minimum and the maximum.
+func (a *assembler) evaluate(at location, expression string, address int, minimum int, maximum int) (int, bool) {
+	value, err := evaluate(expression, address, a.lookup)
+	if err != nil {
+		a.errorf(at, "%v", err)
+		return 0, false
+	}
+	if value < minimum || value > maximum {
+		if strconv.Itoa(value) == expression {
+			a.errorf(at, "%s is out of the range %d to %d", expression, minimum, maximum)
+		} else {
+			a.errorf(at, "%s is %d, out of the range %d to %d", expression, value, minimum, maximum)
+		}
+		return 0, false
+	}
+	return value, true
+}
+
+// Read the file named by the quoted path, relative to the including file.
+func (a *assembler) include(at location, argument string) {
+	path, err := strconv.Unquote(argument)
+	if err != nil || path == "" {
+		a.errorf(at, "include takes a quoted path, not %q", argument)
+		return
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(at.file), path)
+	}
+	for _, including := range a.including {
+		if including == filepath.Clean(path) {
+			a.errorf(at, "%s includes itself", path)
+			return
+		}
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		a.errorf(at, "%v", err)
+		return
+	}
+	a.readSource(path, source)
+}
+
+// Start the definition of a macro, the lines up to
+// endm are its body.
+func (a *assembler) defineMacro(at location, arguments string) {
+	name, rest := splitWord(arguments)
+	m := &macro{location: at, name: name, parameters: splitOperands(rest)}
+	a.definition = m
+	if !isIdentifier(name) {
+		a.errorf(at, "invalid macro name %q", name)
+	} else if a.isMnemonic(name) {
+		a.errorf(at, "macro %s is named after an instruction", name)
+	}
+	for _, parameter := range m.parameters {
+		if !isIdentifier(parameter) {
+			a.errorf(at, "invalid parameter %q of macro %s", parameter, name)
+		}
+	}
+}
+
+// Read the lines of the macro with its parameters replaced by the
+// arguments, and its labels by ones local to the expansion.
+func (a *assembler) expand(at location, m *macro, arguments string) {
+	values := splitOperands(arguments)
+	if len(values) != len(m.parameters) {
+		a.errorf(at, "macro %s takes %d arguments, not %d", m.name, len(m.parameters), len(values))
+		return
+	}
+	if a.depth == maxExpansionDepth {
+		a.errorf(at, "macro %s is expanded too deeply", m.name)
+		return
+	}
+	a.depth++
+	defer func() { a.depth-- }()
+	if at.macro == "" {
+		at.macro = m.name
+	}
+	a.expansions++
+	names := append([]string(nil), m.parameters...)
+	for _, label := range m.labels() {
+		names = append(names, label)
+		values = append(values, fmt.Sprintf("%s.%s.%d", m.name, label, a.expansions))
+	}
+	for _, line := range m.lines {
+		a.readLine(at, substitute(line, names, values))
+	}
+}
+
+// Move the address of the following statements forwards.
+func (a *assembler) org(at location, expression string) {
+	address, ok := a.evaluate(at, expression, a.address, 0, a.size)
+	if !ok {
+		return
+	}
+	if address < a.address {
+		a.errorf(at, "org 0x%03X is before the address 0x%03X", address, a.address)
+		return
+	}
+	a.address = address
+}
+
+// Lay out a db or dw directive, strings are allowed for bytes.
+func (a *assembler) data(at location, directive string, arguments string) {
+	s := &statement{location: at, text: directive + " " + arguments, directive: directive, operands: splitOperands(arguments)}
+	if len(s.operands) == 0 {
+		a.errorf(at, "%s without values", directive)
+		return
+	}
+	for _, operand := range s.operands {
+		switch {
+		case directive == "dw":
+			s.size += 2
+		case strings.HasPrefix(operand, "\""):
+			text, err := strconv.Unquote(operand)
+			if err != nil {
+				a.errorf(at, "invalid string %s", operand)
+			}
+			s.size += len(text)
+		default:
+			s.size++
+		}
+	}
+	a.add(s)
+}
+
+// Lay out an instruction.
+func (a *assembler) instruction(at location, mnemonic string, arguments string, text string) {
+	operands := splitOperands(arguments)
+	if len(operands) == 1 && (strings.EqualFold(mnemonic, "SHR") || strings.EqualFold(mnemonic, "SHL")) {
+		// SHR Vx shifts Vx into itself with and without the shift quirk.
+		operands = append(operands, operands[0])
+	}
+	for _, kind := range a.table.Kinds() {
+		if strings.EqualFold(kind.Mnemonic(), mnemonic) && matchesSyntax(kind.Syntax(), operands) {
+			a.add(&statement{location: at, text: text, kind: kind, operands: operands, size: isa.Instruction{Kind: kind}.Size()})
+			return
+		}
+	}
+	switch {
+	case !a.isMnemonic(mnemonic):
+		a.errorf(at, "unknown instruction or macro %s", mnemonic)
+	case isa.XOChip != a.table && a.supportedBy(isa.XOChip, mnemonic, operands):
+		a.errorf(at, "%s is not an instruction of the %s platform", text, a.platform)
+	default:
+		a.errorf(at, "invalid operands of %s", text)
+	}
+}
+
+// Returns true if an instruction of any platform has the mnemonic.
+func (a *assembler) isMnemonic(name string) bool {
+	for kind := isa.Kind(1); kind < isa.KindCount; kind++ {
+		if strings.EqualFold(kind.Mnemonic(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the table has an instruction of the mnemonic and operands.
+func (a *assembler) supportedBy(table *isa.Table, mnemonic string, operands []string) bool {
+	for _, kind := range table.Kinds() {
+		if strings.EqualFold(kind.Mnemonic(), mnemonic) && matchesSyntax(kind.Syntax(), operands) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add the statement at the address and move past it.
+func (a *assembler) add(s *statement) {
+	s.address = a.address
+	if a.address+s.size > a.size {
+		if a.address <= a.size {
+			a.errorf(s.location, "program does not fit in the 0x%X bytes of memory", a.size)
+		}
+	} else {
+		a.statements = append(a.statements, s)
+	}
+	a.address += s.size
+}
+
+// Encode the statements into the program.
+func (a *assembler) encode() *Program {
+	program := &Program{Origin: uint16(a.origin), Labels: make(map[string]uint16)}
+	for name, s := range a.symbols {
+		if s.label {
+			program.Labels[name] = uint16(s.value)
+		}
+	}
+	program.ROM = make([]byte, a.address-a.origin)
+	for _, s := range a.statements {
+		var encoded []byte
+		if s.directive == "" {
+			encoded = a.encodeInstruction(s)
+		} else {
+			encoded = a.encodeData(s)
+		}
+		copy(program.ROM[s.address-a.origin:], encoded)
+		program.Lines = append(program.Lines, Line{
+			Address: uint16(s.address), Size: s.size, File: s.file, Line: s.line, Text: s.text,
+		})
+	}
+	return program
+}
+
+// Encode the operands of the instruction into its opcode.
+func (a *assembler) encodeInstruction(s *statement) []byte {
+	instruction := isa.Instruction{Kind: s.kind}
+	syntax := strings.Split(s.kind.Syntax(), ", ")
+	for i, operand := range s.operands {
+		switch syntax[i] {
+		case "Vx":
+			instruction.X, _ = register(operand)
+		case "Vy":
+			instruction.Y, _ = register(operand)
+		case "Vx-Vy":
+			instruction.X, instruction.Y, _ = registerRange(operand)
+		case "nn":
+			value, _ := a.evaluate(s.location, operand, s.address, -0x80, 0xFF)
+			instruction.NN = uint8(value)
+		case "nnn":
+			value, _ := a.evaluate(s.location, operand, s.address, 0, 0xFFF)
+			instruction.NNN = uint16(value)
+		case "LONG nnnn":
+			value, _ := a.evaluate(s.location, strings.TrimSpace(operand[len("LONG"):]), s.address, 0, 0xFFFF)
+			instruction.NNN = uint16(value)
+		case "n":
+			value, _ := a.evaluate(s.location, operand, s.address, 0, 0xF)
+			instruction.N = uint8(value)
+		case "x":
+			value, _ := a.evaluate(s.location, operand, s.address, 0, 0xF)
+			instruction.X = uint8(value)
+		}
+	}
+	opcode := isa.Encode(instruction)
+	encoded := []byte{byte(opcode >> 8), byte(opcode)}
+	if s.kind == isa.LoadILong {
+		encoded = append(encoded, byte(instruction.NNN>>8), byte(instruction.NNN))
+	}
+	return encoded
+}
+
+// Encode the values of a db or dw directive.
+func (a *assembler) encodeData(s *statement) []byte {
+	encoded := make([]byte, 0, s.size)
+	for _, operand := range s.operands {
+		if s.directive == "dw" {
+			value, _ := a.evaluate(s.location, operand, s.address, -0x8000, 0xFFFF)
+			encoded = append(encoded, byte(value>>8), byte(value))
+		} else if strings.HasPrefix(operand, "\"") {
+			text, _ := strconv.Unquote(operand)
+			encoded = append(encoded, text...)
+		} else {
+			value, _ := a.evaluate(s.location, operand, s.address, -0x80, 0xFF)
+			encoded = append(encoded, byte(value))
+		}
+	}
+	return encoded
+}
@@ -0,0 +1,181 @@
+package asm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ambertide/chip8/pkg/disasm"
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+func TestAssemble(t *testing.T) {
+	source := `; Draws the digits of a counter.
+SPEED equ 2 * (3 + 1)
+macro draw x, y
+	DRW x, y, 5
+endm
+start:	LD V0, 10
+	LD V1, SPEED - 1
+loop:	LD F, V0
+	draw V0, V1
+	ADD V0, 0xFF          ; decrement
+	SE V0, -1
+	JP loop
+	LD I, LONG sprite
+	LD [I], V0 - V2
+	JP $
+sprite:	db 0b11110000, 'A', "hi"
+	dw sprite, end - start
+end:
+`
+	program, err := Assemble("test.c8s", []byte(source), Options{Platform: device.XOChip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		0x60, 0x0A, 0x61, 0x07, 0xF0, 0x29, 0xD0, 0x15, 0x70, 0xFF, 0x30, 0xFF, 0x12, 0x04,
+		0xF0, 0x00, 0x02, 0x16, 0x50, 0x22, 0x12, 0x14, 0xF0, 0x41, 0x68, 0x69, 0x02, 0x16, 0x00, 0x1E,
+	}
+	if !bytes.Equal(program.ROM, expected) {
+		t.Fatalf("Unexpected ROM % X.", program.ROM)
+	}
+	if program.Labels["loop"] != 0x204 || program.Labels["end"] != 0x21E || len(program.Labels) != 4 {
+		t.Fatalf("Unexpected labels %v.", program.Labels)
+	}
+	line := program.Lines[3]
+	if line.Address != 0x206 || line.File != "test.c8s" || line.Line != 9 || line.Text != "DRW V0, V1, 5" {
+		t.Fatalf("Unexpected line %+v of the macro.", line)
+	}
+	symbols := program.Symbols(".")
+	if symbols.Lines[0].Line != 6 || symbols.Labels["sprite"] != 0x216 {
+		t.Fatalf("Unexpected symbols %+v.", symbols)
+	}
+}
+
+func TestAssembleTestROM(t *testing.T) {
+	program, err := AssembleFile("../../test/characters.c8s", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom, err := os.ReadFile("../../test/characters.ch8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(program.ROM, rom) {
+		t.Fatalf("Source assembled to % X rather than % X.", program.ROM, rom)
+	}
+}
+
+func TestAssembleDisassembly(t *testing.T) {
+	rom := []byte{
+		0x00, 0xE0, 0x22, 0x0A, 0x3F, 0x01, 0x12, 0x02, 0x12, 0x08, 0xA2, 0x12,
+		0xD0, 0x15, 0x8E, 0x06, 0x00, 0xEE, 0xF0, 0x90, 0xB2, 0x00,
+	}
+	var listing bytes.Buffer
+	if err := disasm.Disassemble(rom, device.Chip8).Write(&listing); err != nil {
+		t.Fatal(err)
+	}
+	program, err := Assemble("listing.c8s", listing.Bytes(), Options{Platform: device.Chip8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(program.ROM, rom) {
+		t.Fatalf("Disassembly assembled to % X.", program.ROM)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{"JP nowhere", "test.c8s:1: undefined symbol nowhere"},
+		{"\nLD V0, 256", "test.c8s:2: 256 is out of the range -128 to 255"},
+		{"SE V0, 0x80 * 2", "test.c8s:1: 0x80 * 2 is 256, out of the range -128 to 255"},
+		{"LD V0, V1, V2", "test.c8s:1: invalid operands of LD V0, V1, V2"},
+		{"MOV V0, 1", "test.c8s:1: unknown instruction or macro MOV"},
+		{"PLANE 1", "test.c8s:1: PLANE 1 is not an instruction of the chip8 platform"},
+		{"a:\na: CLS", "test.c8s:2: a is already defined at test.c8s:1"},
+		{"A equ C + 1\nC equ A\nJP A", "test.c8s:3: constant A depends on itself"},
+		{"macro m v\nLD v, 1 / 0\nendm\nm V0", "test.c8s:4: division by zero in macro m"},
+		{"macro m\nCLS", "test.c8s:1: macro m is not closed with endm"},
+		{"org 0x1000\nCLS", "test.c8s:2: program does not fit in the 0x1000 bytes of memory"},
+	}
+	for _, test := range tests {
+		_, err := Assemble("test.c8s", []byte(test.source), Options{Platform: device.Chip8})
+		if err == nil || err.Error() != test.err {
+			t.Fatalf("Assembling %q failed with %v, not %s.", test.source, err, test.err)
+		}
+	}
+}
+
+func TestAssembleFile(t *testing.T) {
+	directory := t.TempDir()
+	files := map[string]string{
+		"main.c8s":         "include \"lib/sprites.c8s\"\nstart: LD I, digit\n",
+		"lib/sprites.c8s":  "JP start\ndigit: db 0xF0\ninclude \"loop.c8s\"\n",
+		"lib/loop.c8s":     "",
+		"cycle/a.c8s":      "include \"b.c8s\"\n",
+		"cycle/b.c8s":      "CLS\ninclude \"a.c8s\"\n",
+		"missing/main.c8s": "include \"none.c8s\"\n",
+	}
+	for name, source := range files {
+		path := filepath.Join(directory, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	program, err := AssembleFile(filepath.Join(directory, "main.c8s"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(program.ROM, []byte{0x12, 0x03, 0xF0, 0xA2, 0x02}) {
+		t.Fatalf("Unexpected ROM % X.", program.ROM)
+	}
+	if file := program.Symbols(directory).Lines[1].File; file != filepath.Join("lib", "sprites.c8s") {
+		t.Fatalf("Unexpected file %s of the data.", file)
+	}
+	var listing bytes.Buffer
+	if err := program.WriteListing(&listing); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(listing.String(), "203: A2 02        "+filepath.Join(directory, "main.c8s")+":2: LD I, digit\n") {
+		t.Fatalf("Unexpected listing:\n%s", listing.String())
+	}
+	if _, err := AssembleFile(filepath.Join(directory, "cycle", "a.c8s"), Options{}); err == nil ||
+		!strings.Contains(err.Error(), "b.c8s:2: "+filepath.Join(directory, "cycle", "a.c8s")+" includes itself") {
+		t.Fatalf("Include cycle failed with %v.", err)
+	}
+	if _, err := AssembleFile(filepath.Join(directory, "missing", "main.c8s"), Options{}); err == nil ||
+		!strings.Contains(err.Error(), "main.c8s:1: open ") {
+		t.Fatalf("Missing include failed with %v.", err)
+	}
+}
+
+func TestAssembleMacroLabels(t *testing.T) {
+	source := `macro wait
+lp:	LD V0, DT
+	SE V0, 0
+	JP lp
+endm
+	SHR V1
+	wait
+	SHL VA
+	wait
+`
+	program, err := Assemble("test.c8s", []byte(source), Options{Platform: device.Chip8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x81, 0x16, 0xF0, 0x07, 0x30, 0x00, 0x12, 0x02, 0x8A, 0xAE, 0xF0, 0x07, 0x30, 0x00, 0x12, 0x0A}
+	if !bytes.Equal(program.ROM, expected) {
+		t.Fatalf("Unexpected ROM % X.", program.ROM)
+	}
+	if program.Labels["wait.lp.1"] != 0x202 || program.Labels["wait.lp.2"] != 0x20A {
+		t.Fatalf("Unexpected labels %v of the expansions.", program.Labels)
+	}
+}
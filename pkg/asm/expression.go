@@ -0,0 +1,201 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Binary operators by increasing precedence.
+var binaryOperators = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// Parses and evaluates an expression of numbers, characters,
+// symbols and the current address $ at once.
+type expressionParser struct {
+	text     string
+	position int
+	// Value of $, the address of the statement.
+	address int
+	lookup  func(name string) (int, error)
+}
+
+// Evaluate the expression, looking up the values of its symbols.
+func evaluate(text string, address int, lookup func(name string) (int, error)) (int, error) {
+	p := &expressionParser{text: text, address: address, lookup: lookup}
+	value, err := p.binary(0)
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpaces()
+	if p.position < len(p.text) {
+		return 0, fmt.Errorf("unexpected %q in expression %q", p.text[p.position:], text)
+	}
+	return value, nil
+}
+
+func (p *expressionParser) skipSpaces() {
+	for p.position < len(p.text) && (p.text[p.position] == ' ' || p.text[p.position] == '\t') {
+		p.position++
+	}
+}
+
+// Consume one of the operators if it is next.
+func (p *expressionParser) operator(operators []string) string {
+	p.skipSpaces()
+	for _, operator := range operators {
+		if strings.HasPrefix(p.text[p.position:], operator) {
+			p.position += len(operator)
+			return operator
+		}
+	}
+	return ""
+}
+
+// Parse the binary operators of the precedence level and the ones above it.
+func (p *expressionParser) binary(level int) (int, error) {
+	if level == len(binaryOperators) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		operator := p.operator(binaryOperators[level])
+		if operator == "" {
+			return left, nil
+		}
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return 0, err
+		}
+		if left, err = apply(operator, left, right); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Return the result of the binary operator.
+func apply(operator string, left int, right int) (int, error) {
+	switch operator {
+	case "|":
+		return left | right, nil
+	case "^":
+		return left ^ right, nil
+	case "&":
+		return left & right, nil
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	}
+	if (operator == "/" || operator == "%") && right == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	if (operator == "<<" || operator == ">>") && (right < 0 || right > 63) {
+		return 0, fmt.Errorf("invalid shift by %d", right)
+	}
+	switch operator {
+	case "/":
+		return left / right, nil
+	case "%":
+		return left % right, nil
+	case "<<":
+		return left << uint(right), nil
+	}
+	return left >> uint(right), nil
+}
+
+// Parse a unary operator, a parenthesized expression or a value.
+func (p *expressionParser) unary() (int, error) {
+	p.skipSpaces()
+	if p.position == len(p.text) {
+		return 0, fmt.Errorf("missing value in expression %q", p.text)
+	}
+	switch character := p.text[p.position]; {
+	case character == '-' || character == '+' || character == '~':
+		p.position++
+		value, err := p.unary()
+		if character == '-' {
+			value = -value
+		} else if character == '~' {
+			value = ^value
+		}
+		return value, err
+	case character == '(':
+		p.position++
+		value, err := p.binary(0)
+		if err != nil {
+			return 0, err
+		}
+		if p.operator([]string{")"}) == "" {
+			return 0, fmt.Errorf("missing ) in expression %q", p.text)
+		}
+		return value, nil
+	case character == '$':
+		p.position++
+		return p.address, nil
+	case character == '\'':
+		end := strings.IndexByte(p.text[p.position+1:], '\'')
+		if end < 0 {
+			return 0, fmt.Errorf("unterminated character in expression %q", p.text)
+		}
+		literal := p.text[p.position : p.position+end+2]
+		p.position += end + 2
+		value, _, _, err := strconv.UnquoteChar(literal[1:len(literal)-1], '\'')
+		if err != nil || len(literal) == 2 {
+			return 0, fmt.Errorf("invalid character %s", literal)
+		}
+		return int(value), nil
+	case character >= '0' && character <= '9':
+		word := p.word()
+		value, err := strconv.ParseInt(word, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", word)
+		}
+		return int(value), nil
+	case isIdentifierStart(character):
+		return p.lookup(p.word())
+	}
+	return 0, fmt.Errorf("unexpected %q in expression %q", p.text[p.position:], p.text)
+}
+
+// Consume the identifier or number that is next.
+func (p *expressionParser) word() string {
+	start := p.position
+	for p.position < len(p.text) && isIdentifierPart(p.text[p.position]) {
+		p.position++
+	}
+	return p.text[start:p.position]
+}
+
+func isIdentifierStart(character byte) bool {
+	return character == '_' || character == '.' ||
+		character >= 'a' && character <= 'z' || character >= 'A' && character <= 'Z'
+}
+
+func isIdentifierPart(character byte) bool {
+	return isIdentifierStart(character) || character >= '0' && character <= '9'
+}
+
+// Returns true if the text is a name of a label, constant or macro.
+func isIdentifier(text string) bool {
+	if text == "" || !isIdentifierStart(text[0]) {
+		return false
+	}
+	for i := 1; i < len(text); i++ {
+		if !isIdentifierPart(text[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package asm
+
+import (
+	"strings"
+)
+
+// Remove the comment starting with a semicolon outside of quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch character := line[i]; {
+		case quote != 0 && character == '\\':
+			i++
+		case quote != 0:
+			if character == quote {
+				quote = 0
+			}
+		case character == '"' || character == '\'':
+			quote = character
+		case character == ';':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// Split the first word of the text from the rest.
+func splitWord(text string) (string, string) {
+	end := strings.IndexAny(text, " \t")
+	if end < 0 {
+		return text, ""
+	}
+	return text[:end], strings.TrimSpace(text[end:])
+}
+
+// Split the operands at the commas outside of parentheses and quotes.
+func splitOperands(text string) []string {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	var operands []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		switch character := text[i]; {
+		case quote != 0 && character == '\\':
+			i++
+		case quote != 0:
+			if character == quote {
+				quote = 0
+			}
+		case character == '"' || character == '\'':
+			quote = character
+		case character == '(':
+			depth++
+		case character == ')':
+			depth--
+		case character == ',' && depth == 0:
+			operands = append(operands, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	return append(operands, strings.TrimSpace(text[start:]))
+}
+
+// Replace the names of the parameters outside of quotes by the values.
+func substitute(line string, parameters []string, values []string) string {
+	var result strings.Builder
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		character := line[i]
+		switch {
+		case quote != 0:
+			if character == '\\' && i+1 < len(line) {
+				result.WriteByte(character)
+				i++
+				character = line[i]
+			} else if character == quote {
+				quote = 0
+			}
+		case character == '"' || character == '\'':
+			quote = character
+		case isIdentifierStart(character):
+			end := i + 1
+			for end < len(line) && isIdentifierPart(line[end]) {
+				end++
+			}
+			word := line[i:end]
+			for j, parameter := range parameters {
+				if word == parameter {
+					word = values[j]
+					break
+				}
+			}
+			result.WriteString(word)
+			i = end - 1
+			continue
+		}
+		result.WriteByte(character)
+	}
+	return result.String()
+}
+
+// Return the index of the register named by the operand, such as VA.
+func register(operand string) (uint8, bool) {
+	if len(operand) != 2 || operand[0] != 'V' && operand[0] != 'v' {
+		return 0, false
+	}
+	switch digit := operand[1]; {
+	case digit >= '0' && digit <= '9':
+		return digit - '0', true
+	case digit >= 'A' && digit <= 'F':
+		return digit - 'A' + 10, true
+	case digit >= 'a' && digit <= 'f':
+		return digit - 'a' + 10, true
+	}
+	return 0, false
+}
+
+// Return the indices of the registers of a range, such as V1-V4.
+func registerRange(operand string) (uint8, uint8, bool) {
+	dash := strings.IndexByte(operand, '-')
+	if dash < 0 {
+		return 0, 0, false
+	}
+	first, firstOk := register(strings.TrimSpace(operand[:dash]))
+	last, lastOk := register(strings.TrimSpace(operand[dash+1:]))
+	return first, last, firstOk && lastOk
+}
+
+// Returns true if the operands have the shape of the syntax of a kind,
+// the values of its immediates are checked once they are evaluated.
+func matchesSyntax(syntax string, operands []string) bool {
+	if syntax == "" {
+		return len(operands) == 0
+	}
+	expected := strings.Split(syntax, ", ")
+	if len(expected) != len(operands) {
+		return false
+	}
+	for i, operand := range operands {
+		if !matchesOperand(expected[i], operand) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the operand has the shape of an operand of a syntax.
+func matchesOperand(syntax string, operand string) bool {
+	switch syntax {
+	case "Vx", "Vy":
+		_, ok := register(operand)
+		return ok
+	case "Vx-Vy":
+		_, _, ok := registerRange(operand)
+		return ok
+	case "nn", "nnn", "n", "x":
+		return isValue(operand)
+	case "LONG nnnn":
+		keyword, value := splitWord(operand)
+		return strings.EqualFold(keyword, "LONG") && isValue(value)
+	}
+	return strings.EqualFold(strings.ReplaceAll(operand, " ", ""), syntax)
+}
+
+// Returns true if the operand is an expression rather than a
+// register, a range of registers or a reserved name.
+func isValue(operand string) bool {
+	if _, ok := register(operand); ok || operand == "" {
+		return false
+	}
+	if _, _, ok := registerRange(operand); ok {
+		return false
+	}
+	keyword, _ := splitWord(operand)
+	return !reservedNames[strings.ToUpper(keyword)] && !strings.HasPrefix(operand, "[")
+}
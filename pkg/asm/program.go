@@ -0,0 +1,85 @@
+package asm
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ambertide/chip8/pkg/debug"
+)
+
+// An assembled program.
+type Program struct {
+	// The bytes of the program, loaded at the origin.
+	ROM    []byte
+	Origin uint16
+	// Addresses of the labels by their names.
+	Labels map[string]uint16
+	// The lines of source that assembled to bytes, by address.
+	Lines []Line
+}
+
+// A line of source and the address of the bytes it assembled to,
+// the lines of a macro are at the line it is invoked on.
+type Line struct {
+	Address uint16
+	Size    int
+	File    string
+	Line    int
+	// The statement without its label and comment.
+	Text string
+}
+
+// Return the symbol map of the program, with the paths of the source
+// files relative to the directory the symbol map is written to.
+func (p *Program) Symbols(directory string) *debug.SymbolMap {
+	symbols := &debug.SymbolMap{Labels: make(map[string]uint16), Lines: make([]debug.SourceLine, len(p.Lines))}
+	for name, address := range p.Labels {
+		symbols.Labels[name] = address
+	}
+	for i, line := range p.Lines {
+		symbols.Lines[i] = debug.SourceLine{Address: line.Address, File: relativePath(directory, line.File), Line: line.Line}
+	}
+	return symbols
+}
+
+// Return the path relative to the directory if possible.
+func relativePath(directory string, path string) string {
+	absoluteDirectory, err := filepath.Abs(directory)
+	if err != nil {
+		return path
+	}
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if relative, err := filepath.Rel(absoluteDirectory, absolutePath); err == nil {
+		return relative
+	}
+	return absolutePath
+}
+
+// Write a listing of the addresses and bytes of the lines next to
+// their source, four bytes to a row.
+func (p *Program) WriteListing(w io.Writer) error {
+	for _, line := range p.Lines {
+		offset := int(line.Address - p.Origin)
+		for row := 0; row < line.Size || row == 0; row += 4 {
+			end := row + 4
+			if end > line.Size {
+				end = line.Size
+			}
+			code := fmt.Sprintf("% X", p.ROM[offset+row:offset+end])
+			source := ""
+			if row == 0 {
+				source = fmt.Sprintf("%s:%d: %s", line.File, line.Line, line.Text)
+			}
+			text := strings.TrimRight(fmt.Sprintf("%03X: %-11s  %s", int(line.Address)+row, code, source), " ")
+			if _, err := fmt.Fprintln(w, text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package debug
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+// Matches opcodes against a pattern of four hexadecimal digits, where
+// X, Y and N match any digit, such as DXYN for all draw instructions
+// or F00A for waiting for a key into V0. Patterns without X, Y or N
+// look like addresses, and are prefixed with op in breakpoint
+// expressions, such as op F00A.
+type OpcodePattern struct {
+	pattern string
+	mask    uint16
+	value   uint16
+}
+
+// Return the pattern in upper case.
+func normalisePattern(pattern string) string {
+	return strings.ToUpper(strings.TrimSpace(pattern))
+}
+
+// Parse an opcode pattern such as DXYN.
+func ParseOpcodePattern(pattern string) (OpcodePattern, error) {
+	opcodePattern := OpcodePattern{pattern: normalisePattern(pattern)}
+	if len(opcodePattern.pattern) != 4 {
+		return opcodePattern, fmt.Errorf("opcode pattern %q is not four digits", pattern)
+	}
+	for _, digit := range opcodePattern.pattern {
+		opcodePattern.mask <<= 4
+		opcodePattern.value <<= 4
+		switch {
+		case digit == 'X' || digit == 'Y' || digit == 'N':
+		case strings.ContainsRune("0123456789ABCDEF", digit):
+			value, _ := strconv.ParseUint(string(digit), 16, 8)
+			opcodePattern.mask |= 0xF
+			opcodePattern.value |= uint16(value)
+		default:
+			return opcodePattern, fmt.Errorf("opcode pattern %q has an invalid digit %q", pattern, digit)
+		}
+	}
+	return opcodePattern, nil
+}
+
+// Returns true if the opcode matches the pattern.
+func (o OpcodePattern) Matches(opcode uint16) bool {
+	return opcode&o.mask == o.value
+}
+
+func (o OpcodePattern) String() string {
+	return o.pattern
+}
+
+// Returns true if the expression is an opcode pattern rather than
+// an address, which is the case if it contains X, Y or N other
+// than in the 0x prefix.
+func IsOpcodePattern(expression string) bool {
+	expression = normalisePattern(expression)
+	return !strings.HasPrefix(expression, "0X") && strings.ContainsAny(expression, "XYN")
+}
+
+// Return the opcode pattern of a breakpoint expression and true if it
+// is one, which is the case if it is prefixed with op, such as op 00E0,
+// or is an opcode pattern without the prefix, such as DXYN.
+func CutOpcodePattern(expression string) (string, bool) {
+	fields := strings.Fields(expression)
+	if len(fields) == 2 && strings.EqualFold(fields[0], "op") {
+		return fields[1], true
+	}
+	return expression, IsOpcodePattern(expression)
+}
+
+// A register or a memory range whose changes stop the execution.
+type watchpoint struct {
+	name string
+	// Read the watched value.
+	read func(p *device.Processor) []byte
+	last []byte
+}
+
+// Returns true if the watched value changed since the last check.
+func (w *watchpoint) changed(p *device.Processor) bool {
+	value := w.read(p)
+	if bytes.Equal(value, w.last) {
+		return false
+	}
+	w.last = value
+	return true
+}
+
+// Return the expression in the canonical form used as the name of
+// the watchpoint, registers in upper case and addresses in hex.
+func normaliseExpression(expression string) string {
+	expression = strings.ToUpper(strings.TrimSpace(expression))
+	if start, end, err := ParseAddressRange(expression); err == nil {
+		if start == end {
+			return fmt.Sprintf("0x%03X", start)
+		}
+		return fmt.Sprintf("0x%03X-0x%03X", start, end)
+	}
+	return expression
+}
+
+// Parse a watchpoint expression.
+func parseWatchpoint(expression string) (*watchpoint, error) {
+	name := normaliseExpression(expression)
+	if register, err := ParseRegister(name); err == nil {
+		if register == RegisterPC || register == RegisterSP {
+			return nil, fmt.Errorf("%s cannot be watched", name)
+		}
+		return &watchpoint{name: name, read: func(p *device.Processor) []byte {
+			value := ReadRegister(p, register)
+			return []byte{byte(value >> 8), byte(value)}
+		}}, nil
+	}
+	start, end, err := ParseAddressRange(name)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a register nor an address range", expression)
+	}
+	return &watchpoint{name: name, read: func(p *device.Processor) []byte {
+		value := make([]byte, 0, int(end-start)+1)
+		for address := uint32(start); address <= uint32(end); address++ {
+			value = append(value, p.ReadMemory(uint16(address)))
+		}
+		return value
+	}}, nil
+}
+
+// Parse an address in hexadecimal with an optional 0x prefix.
+func ParseAddress(text string) (uint16, error) {
+	text = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(text)), "0x")
+	value, err := strconv.ParseUint(text, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", text)
+	}
+	return uint16(value), nil
+}
+
+// Parse an address or an inclusive range of addresses such as 0x300-0x30F.
+func ParseAddressRange(text string) (uint16, uint16, error) {
+	parts := strings.SplitN(text, "-", 2)
+	start, err := ParseAddress(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(parts) == 1 {
+		return start, start, nil
+	}
+	end, err := ParseAddress(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("address range %q ends before it starts", text)
+	}
+	return start, end, nil
+}
+
+// Sort the addresses in increasing order.
+func sortAddresses(addresses []uint16) {
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+}
@@ -0,0 +1,786 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Starts the program of a launch request paused under a debugger that
+// is run by the launcher, the returned function stops the program.
+type Launcher func(arguments LaunchArguments) (*Debugger, func(), error)
+
+// Arguments of the launch request.
+type LaunchArguments struct {
+	// Path of the ROM.
+	Program string `json:"program"`
+	// Path of the symbol map, defaults to the ROM with the .sym extension.
+	Symbols     string `json:"symbols"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+	// The platform, the quirks profile and the speed in Hz,
+	// the launcher picks the defaults if they are not set.
+	Platform string `json:"platform"`
+	Quirks   string `json:"quirks"`
+	Speed    uint64 `json:"speed"`
+}
+
+// Serves the Debug Adapter Protocol used by editors, a
+// program is launched by each session through the launcher.
+type DAPServer struct {
+	launch Launcher
+}
+
+// Create a new DAP server launching programs with the launcher.
+func NewDAPServer(launch Launcher) *DAPServer {
+	server := new(DAPServer)
+	server.launch = launch
+	return server
+}
+
+// Accept sessions from the listener one at a time
+// until it is closed, and return the error of accepting.
+func (s *DAPServer) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		s.ServeConn(conn, conn)
+		conn.Close()
+	}
+}
+
+// Serve a single session until the client disconnects,
+// the program of the session is stopped afterwards.
+func (s *DAPServer) ServeConn(r io.Reader, w io.Writer) error {
+	session := &dapSession{
+		launch:            s.launch,
+		writer:            w,
+		sourceBreakpoints: make(map[string][]uint16),
+		done:              make(chan struct{}),
+	}
+	defer session.close()
+	reader := bufio.NewReader(r)
+	for {
+		data, err := readDAPMessage(reader)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var request dapRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			return err
+		}
+		if request.Type != "request" {
+			continue
+		}
+		if !session.handle(request) {
+			return nil
+		}
+	}
+}
+
+// A request of the client.
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// A response to a request.
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+// An event sent to the client.
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type dapBreakpoint struct {
+	Verified             bool       `json:"verified"`
+	Message              string     `json:"message,omitempty"`
+	Source               *dapSource `json:"source,omitempty"`
+	Line                 int        `json:"line,omitempty"`
+	InstructionReference string     `json:"instructionReference,omitempty"`
+}
+
+type dapStackFrame struct {
+	ID                          int        `json:"id"`
+	Name                        string     `json:"name"`
+	Source                      *dapSource `json:"source,omitempty"`
+	Line                        int        `json:"line"`
+	Column                      int        `json:"column"`
+	InstructionPointerReference string     `json:"instructionPointerReference"`
+}
+
+type dapScope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+	MemoryReference    string `json:"memoryReference,omitempty"`
+}
+
+// References of the scopes of the variables view.
+const (
+	dapRegisters = iota + 1
+	dapTimers
+	dapMemory
+)
+
+// Only the instructions in the single thread can be debugged.
+const dapThread = 1
+
+// Returned by requests that need a launched program.
+var errNotLaunched = errors.New("no program is launched")
+
+// A session with a client.
+type dapSession struct {
+	launch Launcher
+	writer io.Writer
+	// Guards the writes and the sequence number.
+	writeMutex sync.Mutex
+	seq        int
+	// Set once the program is launched.
+	debugger    *Debugger
+	stopProgram func()
+	symbols     *SymbolMap
+	stopOnEntry bool
+	// Addresses of the breakpoints set by source, by
+	// instruction and by function name, merged into the
+	// breakpoints of the debugger whenever one changes.
+	sourceBreakpoints      map[string][]uint16
+	instructionBreakpoints []uint16
+	functionBreakpoints    []uint16
+	opcodeBreakpoints      []string
+	// Events sent after the response to the current request.
+	deferredEvents []dapEvent
+	// Closed once the session ends.
+	done chan struct{}
+}
+
+// Handle a request and send the response, returns
+// false if the session ends with the request.
+func (s *dapSession) handle(request dapRequest) bool {
+	handlers := map[string]func(json.RawMessage) (interface{}, error){
+		"initialize":                s.initialize,
+		"launch":                    s.launchProgram,
+		"configurationDone":         s.configurationDone,
+		"setBreakpoints":            s.setBreakpoints,
+		"setInstructionBreakpoints": s.setInstructionBreakpoints,
+		"setFunctionBreakpoints":    s.setFunctionBreakpoints,
+		"setExceptionBreakpoints":   func(json.RawMessage) (interface{}, error) { return nil, nil },
+		"threads":                   s.threads,
+		"stackTrace":                s.stackTrace,
+		"scopes":                    s.scopes,
+		"variables":                 s.variables,
+		"setVariable":               s.setVariable,
+		"evaluate":                  s.evaluate,
+		"readMemory":                s.readMemory,
+		"writeMemory":               s.writeMemory,
+		"continue":                  s.continueProgram,
+		"next":                      s.next,
+		"stepOut":                   s.stepOut,
+		"stepIn":                    s.stepIn,
+		"pause":                     s.pause,
+		"terminate":                 s.terminate,
+		"disconnect":                s.terminate,
+	}
+	response := dapResponse{Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: true}
+	handler, ok := handlers[request.Command]
+	if !ok {
+		response.Success, response.Message = false, fmt.Sprintf("unsupported request %q", request.Command)
+	} else if request.Command != "initialize" && request.Command != "launch" && request.Command != "disconnect" && s.debugger == nil {
+		response.Success, response.Message = false, errNotLaunched.Error()
+	} else {
+		body, err := handler(request.Arguments)
+		if err != nil {
+			response.Success, response.Message = false, err.Error()
+		}
+		response.Body = body
+	}
+	s.send(&response.Seq, &response)
+	for _, event := range s.deferredEvents {
+		s.sendEvent(event.Event, event.Body)
+	}
+	s.deferredEvents = nil
+	return request.Command != "disconnect"
+}
+
+// Send the event after the response to the current request.
+func (s *dapSession) deferEvent(event string, body interface{}) {
+	s.deferredEvents = append(s.deferredEvents, dapEvent{Event: event, Body: body})
+}
+
+func (s *dapSession) initialize(json.RawMessage) (interface{}, error) {
+	return map[string]bool{
+		"supportsConfigurationDoneRequest": true,
+		"supportsFunctionBreakpoints":      true,
+		"supportsInstructionBreakpoints":   true,
+		"supportsSetVariable":              true,
+		"supportsReadMemoryRequest":        true,
+		"supportsWriteMemoryRequest":       true,
+		"supportsTerminateRequest":         true,
+		"supportsEvaluateForHovers":        true,
+	}, nil
+}
+
+func (s *dapSession) launchProgram(raw json.RawMessage) (interface{}, error) {
+	if s.debugger != nil {
+		return nil, errors.New("a program is already launched")
+	}
+	var arguments LaunchArguments
+	if err := json.Unmarshal(raw, &arguments); err != nil {
+		return nil, err
+	}
+	if arguments.Program == "" {
+		return nil, errors.New("launch requires the path of the program")
+	}
+	symbolsPath := arguments.Symbols
+	if symbolsPath == "" {
+		symbolsPath = strings.TrimSuffix(arguments.Program, filepath.Ext(arguments.Program)) + ".sym"
+	}
+	symbols, err := LoadSymbolMap(symbolsPath)
+	if err != nil && (arguments.Symbols != "" || !os.IsNotExist(err)) {
+		return nil, err
+	}
+	debugger, stopProgram, err := s.launch(arguments)
+	if err != nil {
+		return nil, err
+	}
+	s.debugger, s.stopProgram, s.symbols = debugger, stopProgram, symbols
+	s.stopOnEntry = arguments.StopOnEntry
+	go s.watchStops()
+	// Breakpoints need the symbol map, so they are set after launching.
+	s.deferEvent("initialized", nil)
+	return nil, nil
+}
+
+// Start the program once the client has set the breakpoints.
+func (s *dapSession) configurationDone(json.RawMessage) (interface{}, error) {
+	if s.stopOnEntry {
+		s.deferEvent("stopped", map[string]interface{}{"reason": "entry", "threadId": dapThread, "allThreadsStopped": true})
+	} else {
+		s.debugger.Continue()
+	}
+	return nil, nil
+}
+
+// Send the stops of the debugger as events until the session ends.
+func (s *dapSession) watchStops() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case stop := <-s.debugger.Stops():
+			s.sendStop(stop)
+		}
+	}
+}
+
+// Reasons of the stopped events for the reasons of the stops.
+var dapStopReasons = map[StopReason]string{
+	StopStep:             "step",
+	StopBreakpoint:       "breakpoint",
+	StopOpcodeBreakpoint: "function breakpoint",
+	StopWatchpoint:       "data breakpoint",
+	StopPause:            "pause",
+	StopFault:            "exception",
+}
+
+// Send the events of the stop.
+func (s *dapSession) sendStop(stop Stop) {
+	for _, event := range dapStopEvents(stop) {
+		s.sendEvent(event.Event, event.Body)
+	}
+}
+
+// Return the events reporting the stop.
+func dapStopEvents(stop Stop) []dapEvent {
+	if stop.Reason == StopHalt {
+		return []dapEvent{{Event: "exited", Body: map[string]int{"exitCode": 0}}, {Event: "terminated"}}
+	}
+	var events []dapEvent
+	body := map[string]interface{}{"reason": dapStopReasons[stop.Reason], "threadId": dapThread, "allThreadsStopped": true}
+	if stop.Detail != "" {
+		body["description"] = fmt.Sprintf("Paused on %s %s", stop.Reason, stop.Detail)
+	}
+	if stop.Err != nil {
+		body["text"] = stop.Err.Error()
+		events = append(events, dapEvent{Event: "output", Body: map[string]string{"category": "stderr", "output": stop.Err.Error() + "\n"}})
+	}
+	return append(events, dapEvent{Event: "stopped", Body: body})
+}
+
+func (s *dapSession) setBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var arguments struct {
+		Source      dapSource `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &arguments); err != nil {
+		return nil, err
+	}
+	var addresses []uint16
+	breakpoints := make([]dapBreakpoint, len(arguments.Breakpoints))
+	for i, requested := range arguments.Breakpoints {
+		breakpoints[i].Line = requested.Line
+		if s.symbols == nil {
+			breakpoints[i].Message = "no symbol map is loaded"
+			continue
+		}
+		line, ok := s.symbols.Address(arguments.Source.Path, requested.Line)
+		if !ok {
+			breakpoints[i].Message = "no instruction at or after this line"
+			continue
+		}
+		addresses = append(addresses, line.Address)
+		breakpoints[i] = dapBreakpoint{
+			Verified:             true,
+			Source:               &arguments.Source,
+			Line:                 line.Line,
+			InstructionReference: fmt.Sprintf("0x%03X", line.Address),
+		}
+	}
+	s.sourceBreakpoints[filepath.Clean(arguments.Source.Path)] = addresses
+	s.syncBreakpoints()
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+func (s *dapSession) setInstructionBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var arguments struct {
+		Breakpoints []struct {
+			InstructionReference string `json:"instructionReference"`
+			Offset               int    `json:"offset"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &arguments); err != nil {
+		return nil, err
+	}
+	s.instructionBreakpoints = nil
+	breakpoints := make([]dapBreakpoint, len(arguments.Breakpoints))
+	for i, requested := range arguments.Breakpoints {
+		address, err := ParseAddress(requested.InstructionReference)
+		if err != nil {
+			breakpoints[i].Message = err.Error()
+			continue
+		}
+		address += uint16(requested.Offset)
+		s.instructionBreakpoints = append(s.instructionBreakpoints, address)
+		breakpoints[i] = s.addressBreakpoint(address)
+	}
+	s.syncBreakpoints()
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+// Function breakpoints are set by the name of a label, an
+// address or an opcode pattern such as DXYN or op 00E0.
+func (s *dapSession) setFunctionBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var arguments struct {
+		Breakpoints []struct {
+			Name string `json:"name"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &arguments); err != nil {
+		return nil, err
+	}
+	s.functionBreakpoints, s.opcodeBreakpoints = nil, nil
+	breakpoints := make([]dapBreakpoint, len(arguments.Breakpoints))
+	for i, requested := range arguments.Breakpoints {
+		if address, ok := s.lookupLabel(requested.Name); ok {
+			s.functionBreakpoints = append(s.functionBreakpoints, address)
+			breakpoints[i] = s.addressBreakpoint(address)
+		} else if pattern, ok := CutOpcodePattern(requested.Name); ok {
+			if _, err := ParseOpcodePattern(pattern); err != nil {
+				breakpoints[i].Message = err.Error()
+				continue
+			}
+			s.opcodeBreakpoints = append(s.opcodeBreakpoints, pattern)
+			breakpoints[i].Verified = true
+		} else if address, err := ParseAddress(requested.Name); err == nil {
+			s.functionBreakpoints = append(s.functionBreakpoints, address)
+			breakpoints[i] = s.addressBreakpoint(address)
+		} else {
+			breakpoints[i].Message = fmt.Sprintf("%q is not a label, an address or an opcode pattern", requested.Name)
+		}
+	}
+	s.syncBreakpoints()
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+// Return the verified breakpoint at the address.
+func (s *dapSession) addressBreakpoint(address uint16) dapBreakpoint {
+	breakpoint := dapBreakpoint{Verified: true, InstructionReference: fmt.Sprintf("0x%03X", address)}
+	if line, ok := s.sourceLine(address); ok {
+		breakpoint.Source, breakpoint.Line = dapSourceOf(line), line.Line
+	}
+	return breakpoint
+}
+
+// Replace the breakpoints of the debugger with those of the session.
+func (s *dapSession) syncBreakpoints() {
+	if s.debugger == nil {
+		return
+	}
+	s.debugger.ClearBreakpoints()
+	s.debugger.ClearOpcodeBreakpoints()
+	for _, addresses := range s.sourceBreakpoints {
+		for _, address := range addresses {
+			s.debugger.SetBreakpoint(address)
+		}
+	}
+	for _, address := range append(s.instructionBreakpoints, s.functionBreakpoints...) {
+		s.debugger.SetBreakpoint(address)
+	}
+	for _, pattern := range s.opcodeBreakpoints {
+		s.debugger.SetOpcodeBreakpoint(pattern)
+	}
+}
+
+func (s *dapSession) threads(json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{"threads": []map[string]interface{}{{"id": dapThread, "name": "Chip-8"}}}, nil
+}
+
+// Build the stack trace from the stack of the processor, the
+// frames of the callers are at the addresses of their calls.
+func (s *dapSession) stackTrace(json.RawMessage) (interface{}, error) {
+	addresses := []uint16{s.debugger.ReadRegister(RegisterPC)}
+	stack := s.debugger.Stack()
+	for i := len(stack) - 1; i >= 0; i-- {
+		addresses = append(addresses, stack[i])
+	}
+	frames := make([]dapStackFrame, len(addresses))
+	for i, address := range addresses {
+		frames[i] = dapStackFrame{
+			ID:                          i,
+			Name:                        s.addressName(address),
+			InstructionPointerReference: fmt.Sprintf("0x%03X", address),
+		}
+		if line, ok := s.sourceLine(address); ok {
+			frames[i].Source, frames[i].Line, frames[i].Column = dapSourceOf(line), line.Line, 1
+		}
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+// Return the address relative to the closest label, if there is one.
+func (s *dapSession) addressName(address uint16) string {
+	if s.symbols != nil {
+		if label, ok := s.symbols.Label(address); ok {
+			if offset := address - s.symbols.Labels[label]; offset != 0 {
+				return fmt.Sprintf("%s+%d", label, offset)
+			}
+			return label
+		}
+	}
+	return fmt.Sprintf("0x%03X", address)
+}
+
+func (s *dapSession) scopes(json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{"scopes": []dapScope{
+		{Name: "Registers", VariablesReference: dapRegisters},
+		{Name: "Timers", VariablesReference: dapTimers},
+		{Name: "Memory", VariablesReference: dapMemory, Expensive: true},
+	}}, nil
+}
+
+func (s *dapSession) variables(raw json.RawMessage) (interface{}, error) {
+	var arguments struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(raw, &arguments); err != nil {
+		return nil, err
+	}
+	var variables []dapVariable
+	switch arguments.VariablesReference {
+	case dapRegisters:
+		for register := Register(0); register < RegisterDT; register++ {
+			variables = append(variables, s.registerVariable(register))
+		}
+	case dapTimers:
+		variables = append(variables, s.registerVariable(RegisterDT), s.registerVariable(RegisterST))
+	case dapMemory:
+		// A row of sixteen bytes for each variable.
+		size := s.debugger.MemorySize()
+		for address := uint32(0); address < size; address += 16 {
+			row := s.debugger.ReadMemory(uint16(address), 16)
+			reference := fmt.Sprintf("0x%03X", address)
+			variables = append(variables, dapVariable{Name: reference, Value: fmt.Sprintf("% X", row), MemoryReference: reference})
+		}
+	default:
+		return nil, fmt.Errorf("unknown variables reference %d", arguments.VariablesReference)
+	}
+	return map[string]interface{}{"variables": variables}, nil
+}
+
+// Return the variable of the register.
+func (s *dapSession) registerVariable(register Register) dapVariable {
+	value := s.debugger.ReadRegister(register)
+	variable := dapVariable{Name: register.String(), Value: formatRegister(register, value)}
+	if register == RegisterI || register == RegisterPC {
+		variable.MemoryReference = fmt.Sprintf("0x%03X", value)
+	}
+	return variable
+}
+
+// Format the value of a register, the timers in decimal.
+func formatRegister(register Register, value uint16) string {
+	if register == RegisterDT || register == RegisterST {
+		return strconv.Itoa(int(value))
+	}
+	return fmt.Sprintf("0x%0*X", register.Size()*2, value)
+}
+
+func (s *dapSession) setVariable(raw json.RawMessage) (interface{}, error) {
+	var arguments struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &arguments); err != nil {
+		return nil, err
+	}
+	register, err := ParseRegister(arguments.Name)
+	if err != nil {
+		return nil, fmt.Errorf("only registers and timers can be set, memory is written through the memory view")
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(arguments.Value), 0, register.Size()*8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", arguments.Value)
+	}
+	if err := s.debugger.WriteRegister(register, uint16(value)); err != nil {
+		return nil, err
+	}
+	return map[string]string{"value": formatRegister(register, uint16(value))}, nil
+}
+
+// Evaluate a register, a label or the byte at an address.
+func (s *dapSession) evaluate(raw json.RawMessage) (interface{}, error) {
+	var arguments struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.Unmarshal(raw, &arguments); err != nil {
+		return nil, err
+	}
+	expression := strings.TrimSpace(arguments.Expression)
+	if register, err := ParseRegister(expression); err == nil {
+		variable := s.registerVariable(register)
+		return map[string]interface{}{"result": variable.Value, "variablesReference": 0, "memoryReference": variable.MemoryReference}, nil
+	}
+	address, ok := s.lookupLabel(expression)
+	if ok {
+		return map[string]interface{}{"result": fmt.Sprintf("0x%03X", address), "variablesReference": 0, "memoryReference": fmt.Sprintf("0x%03X", address)}, nil
+	}
+	address, err := ParseAddress(expression)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a register, a label or an address", expression)
+	}
+	value := s.debugger.ReadMemory(address, 1)[0]
+	return map[string]interface{}{"result": fmt.Sprintf("0x%02X", value), "variablesReference": 0, "memoryReference": fmt.Sprintf("0x%03X", address)}, nil
+}
+
+func (s *dapSession) readMemory(raw json.RawMessage) (interface{}, error) {
+	var arguments struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Count           int    `json:"count"`
+	}
+	if err := json.Unmarshal(raw, &arguments); err != nil {
+		return nil, err
+	}
+	if arguments.Count < 0 {
+		return nil, fmt.Errorf("invalid count %d", arguments.Count)
+	}
+	address, err := ParseAddress(arguments.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+	start := int(address) + arguments.Offset
+	size := int(s.debugger.MemorySize())
+	if start < 0 || start >= size {
+		return map[string]interface{}{"address": fmt.Sprintf("0x%03X", start), "unreadableBytes": arguments.Count}, nil
+	}
+	count := arguments.Count
+	if count > size-start {
+		count = size - start
+	}
+	data := s.debugger.ReadMemory(uint16(start), count)
+	return map[string]interface{}{
+		"address":         fmt.Sprintf("0x%03X", start),
+		"data":            base64.StdEncoding.EncodeToString(data),
+		"unreadableBytes": arguments.Count - count,
+	}, nil
+}
+
+func (s *dapSession) writeMemory(raw json.RawMessage) (interface{}, error) {
+	var arguments struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Data            string `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &arguments); err != nil {
+		return nil, err
+	}
+	address, err := ParseAddress(arguments.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(arguments.Data)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.debugger.WriteMemory(address+uint16(arguments.Offset), data); err != nil {
+		return nil, err
+	}
+	return map[string]int{"bytesWritten": len(data)}, nil
+}
+
+func (s *dapSession) continueProgram(json.RawMessage) (interface{}, error) {
+	s.debugger.Continue()
+	return map[string]bool{"allThreadsContinued": true}, nil
+}
+
+func (s *dapSession) next(json.RawMessage) (interface{}, error) {
+	s.debugger.StepOver()
+	return nil, nil
+}
+
+func (s *dapSession) stepOut(json.RawMessage) (interface{}, error) {
+	s.debugger.StepOut()
+	return nil, nil
+}
+
+// Execute a single instruction, the stop is reported
+// after the response as for the other steps.
+func (s *dapSession) stepIn(json.RawMessage) (interface{}, error) {
+	s.deferredEvents = append(s.deferredEvents, dapStopEvents(s.debugger.Step())...)
+	return nil, nil
+}
+
+func (s *dapSession) pause(json.RawMessage) (interface{}, error) {
+	s.debugger.Pause()
+	return nil, nil
+}
+
+func (s *dapSession) terminate(json.RawMessage) (interface{}, error) {
+	if s.debugger != nil {
+		s.stop()
+		s.deferEvent("terminated", nil)
+	}
+	return nil, nil
+}
+
+// Stop the program once.
+func (s *dapSession) stop() {
+	if s.stopProgram != nil {
+		s.debugger.Kill()
+		s.stopProgram()
+		s.stopProgram = nil
+	}
+}
+
+// End the session and stop its program.
+func (s *dapSession) close() {
+	close(s.done)
+	s.stop()
+}
+
+// Return the address of the label.
+func (s *dapSession) lookupLabel(name string) (uint16, bool) {
+	if s.symbols == nil {
+		return 0, false
+	}
+	address, ok := s.symbols.Labels[name]
+	return address, ok
+}
+
+// Return the source line of the address.
+func (s *dapSession) sourceLine(address uint16) (SourceLine, bool) {
+	if s.symbols == nil {
+		return SourceLine{}, false
+	}
+	return s.symbols.Line(address)
+}
+
+// Return the source of the line.
+func dapSourceOf(line SourceLine) *dapSource {
+	return &dapSource{Name: filepath.Base(line.File), Path: line.File}
+}
+
+// Send an event to the client.
+func (s *dapSession) sendEvent(event string, body interface{}) {
+	message := dapEvent{Type: "event", Event: event, Body: body}
+	s.send(&message.Seq, &message)
+}
+
+// Number the message and send it to the client.
+func (s *dapSession) send(seq *int, message interface{}) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	s.seq++
+	*seq = s.seq
+	data, err := json.Marshal(message)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(s.writer, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// Read the content of a message framed by a Content-Length header.
+func readDAPMessage(reader *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if length >= 0 {
+				break
+			}
+			continue
+		}
+		if value := strings.TrimPrefix(line, "Content-Length:"); value != line {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid header %q", line)
+			}
+		}
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
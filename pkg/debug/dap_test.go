@@ -0,0 +1,167 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A client of a DAP session for testing.
+type dapClient struct {
+	t        *testing.T
+	writer   io.Writer
+	messages chan dapMessage
+	seq      int
+}
+
+// A response or an event read by the client.
+type dapMessage struct {
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// Read the messages from the server, so that it never blocks on writing.
+func (c *dapClient) readMessages(r io.Reader) {
+	defer close(c.messages)
+	reader := bufio.NewReader(r)
+	for {
+		data, err := readDAPMessage(reader)
+		if err != nil {
+			return
+		}
+		var message dapMessage
+		json.Unmarshal(data, &message)
+		c.messages <- message
+	}
+}
+
+// Return the next message from the server.
+func (c *dapClient) read() dapMessage {
+	message, ok := <-c.messages
+	if !ok {
+		c.t.Fatal("The server closed the session.")
+	}
+	return message
+}
+
+// Send a request and decode the body of its response, skipping events.
+func (c *dapClient) request(command string, arguments interface{}, body interface{}) {
+	c.seq++
+	data, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	fmt.Fprintf(c.writer, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	for {
+		message := c.read()
+		if message.Type != "response" || message.RequestSeq != c.seq {
+			continue
+		}
+		if !message.Success {
+			c.t.Fatalf("Request %s failed: %s.", command, message.Message)
+		}
+		if body != nil {
+			json.Unmarshal(message.Body, body)
+		}
+		return
+	}
+}
+
+// Wait for the event and decode its body.
+func (c *dapClient) event(event string, body interface{}) {
+	for {
+		if message := c.read(); message.Type == "event" && message.Event == event {
+			json.Unmarshal(message.Body, body)
+			return
+		}
+	}
+}
+
+func TestDAPServer(t *testing.T) {
+	directory := t.TempDir()
+	symbols := SymbolMap{
+		Labels: map[string]uint16{"main": 0x200, "draw": 0x208},
+		Lines:  []SourceLine{{0x200, "game.c8s", 2}, {0x202, "game.c8s", 3}, {0x208, "game.c8s", 7}, {0x20A, "game.c8s", 9}},
+	}
+	file, _ := os.Create(filepath.Join(directory, "game.sym"))
+	symbols.Write(file)
+	file.Close()
+	launch := func(arguments LaunchArguments) (*Debugger, func(), error) {
+		debugger := newTestDebugger(t, testProgram)
+		stop := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					debugger.StepFrame(8)
+				}
+			}
+		}()
+		return debugger, func() { close(stop) }, nil
+	}
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	go NewDAPServer(launch).ServeConn(serverReader, serverWriter)
+	client := &dapClient{t: t, writer: clientWriter, messages: make(chan dapMessage, 64)}
+	go client.readMessages(clientReader)
+	client.request("initialize", map[string]string{"adapterID": "chip8"}, nil)
+	client.request("launch", map[string]string{"program": filepath.Join(directory, "game.ch8")}, nil)
+	var breakpoints struct {
+		Breakpoints []dapBreakpoint `json:"breakpoints"`
+	}
+	source := map[string]string{"path": filepath.Join(directory, "game.c8s")}
+	client.request("setBreakpoints", map[string]interface{}{"source": source, "breakpoints": []map[string]int{{"line": 8}}}, &breakpoints)
+	if len(breakpoints.Breakpoints) != 1 || !breakpoints.Breakpoints[0].Verified || breakpoints.Breakpoints[0].Line != 9 {
+		t.Fatalf("Breakpoint on a blank line was not moved to the next instruction: %+v.", breakpoints.Breakpoints)
+	}
+	client.request("configurationDone", nil, nil)
+	var stopped struct {
+		Reason string `json:"reason"`
+	}
+	client.event("stopped", &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Fatalf("Stopped on %s, expected the breakpoint.", stopped.Reason)
+	}
+	var trace struct {
+		StackFrames []dapStackFrame `json:"stackFrames"`
+	}
+	client.request("stackTrace", map[string]int{"threadId": dapThread}, &trace)
+	if len(trace.StackFrames) != 2 || trace.StackFrames[0].Name != "draw+2" || trace.StackFrames[0].Line != 9 || trace.StackFrames[1].Line != 3 {
+		t.Fatalf("Unexpected stack trace %+v.", trace.StackFrames)
+	}
+	var variables struct {
+		Variables []dapVariable `json:"variables"`
+	}
+	client.request("variables", map[string]int{"variablesReference": dapRegisters}, &variables)
+	if variables.Variables[2].Name != "V2" || variables.Variables[2].Value != "0x03" {
+		t.Fatalf("Unexpected registers %+v.", variables.Variables)
+	}
+	client.request("stepOut", map[string]int{"threadId": dapThread}, nil)
+	client.event("stopped", &stopped)
+	client.request("stackTrace", map[string]int{"threadId": dapThread}, &trace)
+	if len(trace.StackFrames) != 1 || trace.StackFrames[0].InstructionPointerReference != "0x204" {
+		t.Fatalf("Stepping out stopped at %+v.", trace.StackFrames)
+	}
+	client.request("disconnect", nil, nil)
+}
+
+func TestDAPReadMemory(t *testing.T) {
+	session := &dapSession{debugger: newTestDebugger(t, testProgram)}
+	body, err := session.readMemory(json.RawMessage(`{"memoryReference": "0xFFE", "count": 4}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if memory := body.(map[string]interface{}); memory["data"] != "AAA=" || memory["unreadableBytes"] != 2 {
+		t.Fatalf("Reading past the end of the memory returned %v.", memory)
+	}
+	if _, err := session.readMemory(json.RawMessage(`{"memoryReference": "0x200", "count": -1}`)); err == nil {
+		t.Fatal("Negative count was read.")
+	}
+}
@@ -0,0 +1,468 @@
+// Contains a debugger for the Chip-8 processor, which is
+// shared by the terminal, GDB and DAP frontends.
+package debug
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+// Why the debugger stopped.
+type StopReason int
+
+const (
+	// A step, step over or step out finished.
+	StopStep StopReason = iota
+	// A breakpoint at an address was reached.
+	StopBreakpoint
+	// An instruction matching an opcode breakpoint was reached.
+	StopOpcodeBreakpoint
+	// A watched register or memory range changed.
+	StopWatchpoint
+	// The user paused the execution.
+	StopPause
+	// The processor faulted.
+	StopFault
+	// The program exited.
+	StopHalt
+)
+
+var stopReasonNames = map[StopReason]string{
+	StopStep:             "step",
+	StopBreakpoint:       "breakpoint",
+	StopOpcodeBreakpoint: "opcode breakpoint",
+	StopWatchpoint:       "watchpoint",
+	StopPause:            "pause",
+	StopFault:            "fault",
+	StopHalt:             "exit",
+}
+
+func (r StopReason) String() string {
+	return stopReasonNames[r]
+}
+
+// Describes why and where the debugger stopped.
+type Stop struct {
+	Reason StopReason
+	// Address of the next instruction.
+	PC uint16
+	// The opcode pattern or the watchpoint that triggered.
+	Detail string
+	// The fault of the processor.
+	Err error
+}
+
+// How the debugger runs until it stops on its own.
+type stepMode int
+
+const (
+	// Run until a breakpoint.
+	stepNone stepMode = iota
+	// Run until the stack is back at the depth of the call.
+	stepOver
+	// Run until the current subroutine returns.
+	stepOut
+)
+
+// Duration of a single frame, while paused the frames
+// are idle for this long.
+const frameDuration = time.Second / 60
+
+// Controls the execution of a processor. It can either be run by a
+// scheduler through StepFrame, on the emulator goroutine, or stepped
+// by the frontend itself, all methods are safe to call concurrently.
+type Debugger struct {
+	mutex     sync.Mutex
+	processor *device.Processor
+	// Addresses of the breakpoints.
+	breakpoints       map[uint16]bool
+	opcodeBreakpoints []OpcodePattern
+	watchpoints       []*watchpoint
+	// Set while running, the debugger starts paused.
+	running bool
+	// Set once the frontend ends the program.
+	killed bool
+	mode   stepMode
+	// Stack depth stepping over or out started at.
+	stepDepth uint16
+	// Set until the first instruction after resuming.
+	justResumed bool
+	// Set by Pause from any goroutine.
+	pauseRequested int32
+	// Signalled when the execution is resumed.
+	resumed  chan struct{}
+	stops    chan Stop
+	lastStop Stop
+}
+
+// Create a new debugger for the processor, which is paused.
+func NewDebugger(processor *device.Processor) *Debugger {
+	debugger := new(Debugger)
+	debugger.processor = processor
+	debugger.breakpoints = make(map[uint16]bool)
+	debugger.resumed = make(chan struct{}, 1)
+	debugger.stops = make(chan Stop, 1)
+	debugger.lastStop = Stop{Reason: StopPause, PC: processor.NextInstruction()}
+	return debugger
+}
+
+// Return the processor being debugged, which must only be
+// accessed while the debugger is paused.
+func (d *Debugger) Processor() *device.Processor {
+	return d.processor
+}
+
+// Returns notifications of the stops of the execution
+// resumed by Continue, StepOver and StepOut.
+func (d *Debugger) Stops() <-chan Stop {
+	return d.stops
+}
+
+// Return the last stop.
+func (d *Debugger) LastStop() Stop {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.lastStop
+}
+
+// Returns true while the execution is resumed.
+func (d *Debugger) Running() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.running
+}
+
+// Add a breakpoint at the address.
+func (d *Debugger) SetBreakpoint(address uint16) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.breakpoints[address] = true
+}
+
+// Remove the breakpoint at the address, returns false if there is none.
+func (d *Debugger) ClearBreakpoint(address uint16) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.breakpoints[address] {
+		return false
+	}
+	delete(d.breakpoints, address)
+	return true
+}
+
+// Remove the breakpoints at all addresses.
+func (d *Debugger) ClearBreakpoints() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.breakpoints = make(map[uint16]bool)
+}
+
+// Remove all opcode breakpoints.
+func (d *Debugger) ClearOpcodeBreakpoints() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.opcodeBreakpoints = nil
+}
+
+// Remove all breakpoints, opcode breakpoints and watchpoints.
+func (d *Debugger) ClearAll() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.breakpoints = make(map[uint16]bool)
+	d.opcodeBreakpoints = nil
+	d.watchpoints = nil
+}
+
+// Return the addresses of the breakpoints.
+func (d *Debugger) Breakpoints() []uint16 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	addresses := make([]uint16, 0, len(d.breakpoints))
+	for address := range d.breakpoints {
+		addresses = append(addresses, address)
+	}
+	sortAddresses(addresses)
+	return addresses
+}
+
+// Add a breakpoint on the instructions matching the pattern.
+func (d *Debugger) SetOpcodeBreakpoint(pattern string) error {
+	opcodePattern, err := ParseOpcodePattern(pattern)
+	if err != nil {
+		return err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.opcodeBreakpoints = append(d.opcodeBreakpoints, opcodePattern)
+	return nil
+}
+
+// Remove the opcode breakpoint, returns false if there is none.
+func (d *Debugger) ClearOpcodeBreakpoint(pattern string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for i, opcodePattern := range d.opcodeBreakpoints {
+		if opcodePattern.String() == normalisePattern(pattern) {
+			d.opcodeBreakpoints = append(d.opcodeBreakpoints[:i], d.opcodeBreakpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Return the patterns of the opcode breakpoints.
+func (d *Debugger) OpcodeBreakpoints() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	patterns := make([]string, len(d.opcodeBreakpoints))
+	for i, opcodePattern := range d.opcodeBreakpoints {
+		patterns[i] = opcodePattern.String()
+	}
+	return patterns
+}
+
+// Stop the execution when the register or memory range changes, the
+// expression is V0 to VF, I, DT, ST, an address or a range of
+// addresses such as 0x300-0x30F.
+func (d *Debugger) Watch(expression string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	watch, err := parseWatchpoint(expression)
+	if err != nil {
+		return err
+	}
+	watch.last = watch.read(d.processor)
+	d.watchpoints = append(d.watchpoints, watch)
+	return nil
+}
+
+// Remove the watchpoint, returns false if there is none.
+func (d *Debugger) Unwatch(expression string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for i, watch := range d.watchpoints {
+		if watch.name == normaliseExpression(expression) {
+			d.watchpoints = append(d.watchpoints[:i], d.watchpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Return the expressions of the watchpoints.
+func (d *Debugger) Watchpoints() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	names := make([]string, len(d.watchpoints))
+	for i, watch := range d.watchpoints {
+		names[i] = watch.name
+	}
+	return names
+}
+
+// Request the execution to stop, which happens before the
+// next instruction. Safe to call from signal handlers.
+func (d *Debugger) Pause() {
+	atomic.StoreInt32(&d.pauseRequested, 1)
+}
+
+// Resume the execution in the mode, the mutex must be held.
+func (d *Debugger) resume(mode stepMode) {
+	atomic.StoreInt32(&d.pauseRequested, 0)
+	d.running = true
+	d.justResumed = true
+	d.mode = mode
+	d.stepDepth = d.processor.StackPointer()
+	select {
+	case d.resumed <- struct{}{}:
+	default:
+	}
+}
+
+// Resume the execution until a breakpoint.
+func (d *Debugger) Continue() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.resume(stepNone)
+}
+
+// Execute the next instruction, stepping over subroutine calls.
+// Calls are run until they return or stop at a breakpoint.
+func (d *Debugger) StepOver() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.resume(stepOver)
+}
+
+// Resume the execution until the current subroutine returns.
+func (d *Debugger) StepOut() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.resume(stepOut)
+}
+
+// Execute a single instruction while paused and return the stop.
+func (d *Debugger) Step() Stop {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.running {
+		return d.lastStop
+	}
+	d.mode = stepNone
+	if d.processor.IsWaitingForVBlank() {
+		// Nothing would run until the next frame, so end this one.
+		d.processor.TickTimers()
+	}
+	stop, stopped := d.execute(false)
+	if !stopped {
+		stop = Stop{Reason: StopStep, PC: d.processor.NextInstruction()}
+	}
+	d.lastStop = stop
+	d.processor.SyncBuffers()
+	return stop
+}
+
+// Run the processor for a frame of the given number of cycles if it
+// is running, then tick the timers. While paused, the frame waits
+// until the execution is resumed for at most the duration of a frame.
+// Faults stop the debugger instead of being returned. Returns the
+// number of cycles that were run, none while paused.
+func (d *Debugger) StepFrame(cycles int) (int, error) {
+	executed, _, err := d.StepFrameUnlessPaused(cycles)
+	return executed, err
+}
+
+// Run a frame like StepFrame, also returns false if the frame was
+// held paused, which tells it apart from a frame of no cycles.
+func (d *Debugger) StepFrameUnlessPaused(cycles int) (int, bool, error) {
+	d.mutex.Lock()
+	if !d.running {
+		d.mutex.Unlock()
+		select {
+		case <-d.resumed:
+		case <-time.After(frameDuration):
+		}
+		return 0, false, nil
+	}
+	defer d.mutex.Unlock()
+	i := 0
+	for i < cycles && d.running {
+		stop, stopped := d.execute(!d.justResumed)
+		d.justResumed = false
+		if stopped {
+			d.stop(stop)
+			break
+		}
+		i++
+		if d.processor.IsWaiting() {
+			break
+		}
+	}
+	d.processor.TickTimers()
+	d.processor.SyncBuffers()
+	return i, true, nil
+}
+
+// Returns true once the program exits or is killed.
+func (d *Debugger) ShouldHalt() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.killed || d.processor.ShouldHalt()
+}
+
+// Remove all breakpoints and watchpoints and resume the execution.
+func (d *Debugger) Detach() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.breakpoints = make(map[uint16]bool)
+	d.opcodeBreakpoints = nil
+	d.watchpoints = nil
+	d.resume(stepNone)
+}
+
+// End the program, the scheduler running the debugger stops.
+func (d *Debugger) Kill() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.killed = true
+	d.running = false
+	select {
+	case d.resumed <- struct{}{}:
+	default:
+	}
+}
+
+// Call the function with the processor while no instruction is
+// being executed, for changes made outside of the debugger.
+func (d *Debugger) WithProcessor(fn func(p *device.Processor)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	fn(d.processor)
+}
+
+// Run frames until the execution stops and return the stop,
+// used by frontends that drive the processor themselves.
+func (d *Debugger) RunUntilStop(cycles int) Stop {
+	for d.Running() {
+		d.StepFrame(cycles)
+	}
+	return d.LastStop()
+}
+
+// Record the stop and notify the frontend, the mutex must be held.
+func (d *Debugger) stop(stop Stop) {
+	d.running = false
+	d.lastStop = stop
+	select {
+	case <-d.stops:
+	default:
+	}
+	d.stops <- stop
+}
+
+// Execute the next instruction and return the stop if the execution
+// should stop. Breakpoints are checked before the instruction unless
+// this is the first instruction after resuming, so that a stopped
+// breakpoint can be continued from. The mutex must be held.
+func (d *Debugger) execute(checkBreakpoints bool) (Stop, bool) {
+	p := d.processor
+	pc := p.NextInstruction()
+	if atomic.SwapInt32(&d.pauseRequested, 0) != 0 {
+		return Stop{Reason: StopPause, PC: pc}, true
+	}
+	if p.ShouldHalt() {
+		return Stop{Reason: StopHalt, PC: pc}, true
+	}
+	if checkBreakpoints {
+		if d.breakpoints[pc] {
+			return Stop{Reason: StopBreakpoint, PC: pc}, true
+		}
+		opcode := uint16(p.ReadMemory(pc))<<8 | uint16(p.ReadMemory(pc+1))
+		for _, opcodePattern := range d.opcodeBreakpoints {
+			if opcodePattern.Matches(opcode) {
+				return Stop{Reason: StopOpcodeBreakpoint, PC: pc, Detail: opcodePattern.String()}, true
+			}
+		}
+	}
+	if err := p.Cycle(); err != nil {
+		return Stop{Reason: StopFault, PC: p.NextInstruction(), Err: err}, true
+	}
+	pc = p.NextInstruction()
+	for _, watch := range d.watchpoints {
+		if watch.changed(p) {
+			return Stop{Reason: StopWatchpoint, PC: pc, Detail: watch.name}, true
+		}
+	}
+	switch {
+	case p.ShouldHalt():
+		return Stop{Reason: StopHalt, PC: pc}, true
+	case d.mode == stepOver && p.StackPointer() <= d.stepDepth:
+		return Stop{Reason: StopStep, PC: pc}, true
+	case d.mode == stepOut && p.StackPointer() < d.stepDepth:
+		return Stop{Reason: StopStep, PC: pc}, true
+	}
+	return Stop{}, false
+}
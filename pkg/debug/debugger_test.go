@@ -0,0 +1,102 @@
+package debug
+
+import (
+	"testing"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+// Create a debugger for a processor running the program.
+func newTestDebugger(t *testing.T, program []byte) *Debugger {
+	return newConfiguredTestDebugger(t, device.Config{}, program)
+}
+
+// Create a debugger for a processor with the configuration running the program.
+func newConfiguredTestDebugger(t *testing.T, config device.Config, program []byte) *Debugger {
+	var screenBuffer device.FrameBuffer
+	var keyState device.KeyState
+	var soundBuffer device.SoundBuffer
+	processor := device.NewProcessor(&screenBuffer, &keyState, &soundBuffer, config)
+	if err := processor.LoadProgram(program, uint16(len(program))); err != nil {
+		t.Fatal(err)
+	}
+	return NewDebugger(processor)
+}
+
+// LD V0, 0x01; CALL 0x208; LD V1, 0x02; JP 0x206;
+// at 0x208, LD V2, 0x03; DRW V0, V0, 1; RET.
+var testProgram = []byte{0x60, 0x01, 0x22, 0x08, 0x61, 0x02, 0x12, 0x06, 0x62, 0x03, 0xD0, 0x01, 0x00, 0xEE}
+
+func TestStepOver(t *testing.T) {
+	debugger := newTestDebugger(t, testProgram)
+	debugger.Step()
+	debugger.StepOver()
+	stop := debugger.RunUntilStop(100)
+	if stop.Reason != StopStep || stop.PC != 0x204 {
+		t.Fatalf("Stepping over the call stopped on %s at 0x%03X.", stop.Reason, stop.PC)
+	}
+	if debugger.ReadRegister(2) != 0x03 {
+		t.Fatal("Subroutine was not executed.")
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	debugger := newTestDebugger(t, testProgram)
+	debugger.SetBreakpoint(0x20A)
+	debugger.Continue()
+	if stop := debugger.RunUntilStop(100); stop.Reason != StopBreakpoint || stop.PC != 0x20A {
+		t.Fatalf("Stopped on %s at 0x%03X, expected the breakpoint at 0x20A.", stop.Reason, stop.PC)
+	}
+	debugger.StepOut()
+	if stop := debugger.RunUntilStop(100); stop.PC != 0x204 || debugger.ReadRegister(RegisterSP) != 0 {
+		t.Fatalf("Stepping out stopped at 0x%03X.", stop.PC)
+	}
+	debugger.ClearBreakpoint(0x20A)
+	if err := debugger.Watch("V1"); err != nil {
+		t.Fatal(err)
+	}
+	debugger.Continue()
+	if stop := debugger.RunUntilStop(100); stop.Reason != StopWatchpoint || stop.PC != 0x206 {
+		t.Fatalf("Stopped on %s at 0x%03X, expected the watchpoint of V1.", stop.Reason, stop.PC)
+	}
+}
+
+func TestOpcodeBreakpoint(t *testing.T) {
+	debugger := newTestDebugger(t, testProgram)
+	if err := debugger.SetOpcodeBreakpoint("dxyn"); err != nil {
+		t.Fatal(err)
+	}
+	debugger.Continue()
+	if stop := debugger.RunUntilStop(100); stop.Reason != StopOpcodeBreakpoint || stop.PC != 0x20A {
+		t.Fatalf("Stopped on %s at 0x%03X, expected DXYN at 0x20A.", stop.Reason, stop.PC)
+	}
+	if IsOpcodePattern("0x20A") || !IsOpcodePattern("FX0A") {
+		t.Fatal("Addresses and opcode patterns are confused.")
+	}
+}
+
+func TestStepDisplayWait(t *testing.T) {
+	// DRW V0, V0, 1; LD V1, 0x01; LD V2, 0x02
+	program := []byte{0xD0, 0x01, 0x61, 0x01, 0x62, 0x02}
+	debugger := newConfiguredTestDebugger(t, device.Config{Quirks: device.QuirksPresets["vip"]}, program)
+	for _, expected := range []uint16{0x202, 0x204, 0x206} {
+		// A step after the draw ends the frame it waits for.
+		if stop := debugger.Step(); stop.PC != expected {
+			t.Fatalf("Step stopped at 0x%03X, expected 0x%03X.", stop.PC, expected)
+		}
+	}
+	if debugger.ReadRegister(1) != 0x01 || debugger.ReadRegister(2) != 0x02 {
+		t.Fatal("Instructions after the draw were not executed.")
+	}
+}
+
+func TestStepFramePaused(t *testing.T) {
+	debugger := newTestDebugger(t, testProgram)
+	if cycles, ran, _ := debugger.StepFrameUnlessPaused(8); cycles != 0 || ran || debugger.processor.NextInstruction() != 0x200 {
+		t.Fatalf("Paused frame ran %d cycles.", cycles)
+	}
+	debugger.Continue()
+	if cycles, _ := debugger.StepFrame(8); cycles != 8 {
+		t.Fatalf("Running frame ran %d cycles, expected 8.", cycles)
+	}
+}
@@ -0,0 +1,479 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Serves the GDB Remote Serial Protocol for a debugger, so that
+// standard debugger frontends can attach over TCP.
+type GDBServer struct {
+	debugger *Debugger
+}
+
+// Create a new GDB server for the debugger.
+func NewGDBServer(debugger *Debugger) *GDBServer {
+	server := new(GDBServer)
+	server.debugger = debugger
+	return server
+}
+
+// Accept connections from the listener one at a time
+// until it is closed, and return the error of accepting.
+func (s *GDBServer) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		s.ServeConn(conn)
+	}
+}
+
+// Serve a single client until it disconnects, then remove the
+// breakpoints and resume the execution unless it was killed.
+func (s *GDBServer) ServeConn(conn io.ReadWriteCloser) {
+	session := &gdbSession{
+		debugger:   s.debugger,
+		conn:       conn,
+		packets:    make(chan string),
+		interrupts: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	go session.readPackets()
+	if !session.serve() {
+		s.debugger.Detach()
+	}
+	// Stop the reader, which may be sending a packet sent after the detach.
+	close(session.done)
+	conn.Close()
+}
+
+// What happens after a packet is handled.
+type gdbAction int
+
+const (
+	// Send the reply and wait for the next packet.
+	gdbReply gdbAction = iota
+	// The execution was resumed, reply once it stops.
+	gdbResume
+	// Send the reply and end the session.
+	gdbDetach
+	// The program was killed, end the session without a reply.
+	gdbKill
+)
+
+// A connection of a GDB client.
+type gdbSession struct {
+	debugger *Debugger
+	conn     io.ReadWriteCloser
+	// Guards writes to the connection.
+	writeMutex sync.Mutex
+	// Set once the client disabled the acknowledgements.
+	noAck int32
+	// Packets received from the client, closed on disconnection.
+	packets chan string
+	// Signalled when the client interrupts the execution.
+	interrupts chan struct{}
+	// Closed once the packets are no longer handled.
+	done chan struct{}
+}
+
+// Read the packets and interrupts of the client, acknowledging
+// the packets with valid checksums.
+func (s *gdbSession) readPackets() {
+	defer close(s.packets)
+	reader := bufio.NewReader(s.conn)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		switch b {
+		case 0x03:
+			select {
+			case s.interrupts <- struct{}{}:
+			default:
+			}
+			continue
+		case '$':
+		default:
+			// Acknowledgements and noise between packets.
+			continue
+		}
+		data, err := reader.ReadString('#')
+		if err != nil {
+			return
+		}
+		data = data[:len(data)-1]
+		var checksum [2]byte
+		if _, err := io.ReadFull(reader, checksum[:]); err != nil {
+			return
+		}
+		valid := fmt.Sprintf("%02x", gdbChecksum(data)) == strings.ToLower(string(checksum[:]))
+		if atomic.LoadInt32(&s.noAck) == 0 {
+			ack := "+"
+			if !valid {
+				ack = "-"
+			}
+			s.write(ack)
+		}
+		if valid {
+			select {
+			case s.packets <- gdbUnescape(data):
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// Handle the packets of the client, returns true if the program was killed.
+func (s *gdbSession) serve() bool {
+	stops := s.debugger.Stops()
+	resumed := false
+	for {
+		select {
+		case packet, ok := <-s.packets:
+			if !ok {
+				return false
+			}
+			reply, action := s.handle(packet)
+			switch action {
+			case gdbResume:
+				resumed = true
+				continue
+			case gdbKill:
+				return true
+			}
+			s.writePacket(reply)
+			if action == gdbDetach {
+				return false
+			}
+		case <-s.interrupts:
+			if resumed {
+				s.debugger.Pause()
+			}
+		case stop := <-stops:
+			if resumed {
+				resumed = false
+				s.writePacket(gdbStopReply(stop))
+			}
+		}
+	}
+}
+
+// Handle a packet and return the reply.
+func (s *gdbSession) handle(packet string) (string, gdbAction) {
+	if packet == "" {
+		return "", gdbReply
+	}
+	d := s.debugger
+	command, arguments := packet[0], packet[1:]
+	switch command {
+	case '?':
+		return gdbStopReply(d.LastStop()), gdbReply
+	case 'g':
+		var reply strings.Builder
+		for register := Register(0); register < RegisterCount; register++ {
+			reply.WriteString(gdbEncodeRegister(register, d.ReadRegister(register)))
+		}
+		return reply.String(), gdbReply
+	case 'G':
+		return s.writeRegisters(arguments), gdbReply
+	case 'p':
+		register, err := strconv.ParseUint(arguments, 16, 8)
+		if err != nil || Register(register) >= RegisterCount {
+			return "E01", gdbReply
+		}
+		return gdbEncodeRegister(Register(register), d.ReadRegister(Register(register))), gdbReply
+	case 'P':
+		return s.writeRegister(arguments), gdbReply
+	case 'm':
+		return s.readMemory(arguments), gdbReply
+	case 'M':
+		return s.writeMemory(arguments), gdbReply
+	case 'Z', 'z':
+		return s.breakpoint(command == 'Z', arguments), gdbReply
+	case 'c', 's':
+		if arguments != "" {
+			address, err := strconv.ParseUint(arguments, 16, 16)
+			if err != nil {
+				return "E01", gdbReply
+			}
+			d.WriteRegister(RegisterPC, uint16(address))
+		}
+		if command == 's' {
+			return gdbStopReply(d.Step()), gdbReply
+		}
+		// Drop the stop of an earlier execution.
+		select {
+		case <-d.Stops():
+		default:
+		}
+		d.Continue()
+		return "", gdbResume
+	case 'D':
+		return "OK", gdbDetach
+	case 'k':
+		d.Kill()
+		return "", gdbKill
+	case 'H', 'T':
+		// There is only a single thread.
+		return "OK", gdbReply
+	case 'q':
+		return s.query(arguments), gdbReply
+	case 'Q':
+		if arguments == "StartNoAckMode" {
+			atomic.StoreInt32(&s.noAck, 1)
+			return "OK", gdbReply
+		}
+	}
+	// Unsupported packets are answered with an empty reply.
+	return "", gdbReply
+}
+
+// Answer a general query.
+func (s *gdbSession) query(query string) string {
+	switch {
+	case strings.HasPrefix(query, "Supported"):
+		return "PacketSize=4000;qXfer:features:read+;QStartNoAckMode+;swbreak+"
+	case query == "Attached":
+		return "1"
+	case query == "C":
+		return "QC1"
+	case query == "fThreadInfo":
+		return "m1"
+	case query == "sThreadInfo":
+		return "l"
+	case query == "Symbol::":
+		return "OK"
+	case strings.HasPrefix(query, "Xfer:features:read:target.xml:"):
+		var offset, length int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(query, "Xfer:features:read:target.xml:"), "%x,%x", &offset, &length); err != nil {
+			return "E01"
+		}
+		description := gdbTargetDescription()
+		if offset >= len(description) {
+			return "l"
+		}
+		if offset+length >= len(description) {
+			return "l" + description[offset:]
+		}
+		return "m" + description[offset:offset+length]
+	}
+	return ""
+}
+
+// Handle a G packet with the values of all registers.
+func (s *gdbSession) writeRegisters(arguments string) string {
+	for register := Register(0); register < RegisterCount; register++ {
+		digits := register.Size() * 2
+		if len(arguments) < digits {
+			return "E01"
+		}
+		value, err := gdbDecodeRegister(arguments[:digits])
+		if err != nil {
+			return "E01"
+		}
+		arguments = arguments[digits:]
+		// The stack pointer is read only.
+		if register != RegisterSP {
+			s.debugger.WriteRegister(register, value)
+		}
+	}
+	return "OK"
+}
+
+// Handle a P packet with the number and the value of a register.
+func (s *gdbSession) writeRegister(arguments string) string {
+	parts := strings.SplitN(arguments, "=", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	register, err := strconv.ParseUint(parts[0], 16, 8)
+	if err != nil || Register(register) >= RegisterCount {
+		return "E01"
+	}
+	value, err := gdbDecodeRegister(parts[1])
+	if err != nil {
+		return "E01"
+	}
+	if err := s.debugger.WriteRegister(Register(register), value); err != nil {
+		return "E01"
+	}
+	return "OK"
+}
+
+// Parse the address and the length of a memory packet and
+// limit the length to the memory.
+func (s *gdbSession) memoryRange(arguments string) (uint16, int, bool) {
+	var address, length uint32
+	if _, err := fmt.Sscanf(arguments, "%x,%x", &address, &length); err != nil {
+		return 0, 0, false
+	}
+	size := s.debugger.MemorySize()
+	if address >= size {
+		return 0, 0, false
+	}
+	if length > size-address {
+		length = size - address
+	}
+	return uint16(address), int(length), true
+}
+
+// Handle an m packet reading memory.
+func (s *gdbSession) readMemory(arguments string) string {
+	address, length, ok := s.memoryRange(arguments)
+	if !ok {
+		return "E01"
+	}
+	return hex.EncodeToString(s.debugger.ReadMemory(address, length))
+}
+
+// Handle an M packet writing memory.
+func (s *gdbSession) writeMemory(arguments string) string {
+	parts := strings.SplitN(arguments, ":", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	address, length, ok := s.memoryRange(parts[0])
+	data, err := hex.DecodeString(parts[1])
+	if !ok || err != nil || len(data) != length {
+		return "E01"
+	}
+	if err := s.debugger.WriteMemory(address, data); err != nil {
+		return "E01"
+	}
+	return "OK"
+}
+
+// Handle Z and z packets setting and clearing software breakpoints.
+func (s *gdbSession) breakpoint(set bool, arguments string) string {
+	var kind, address, size uint32
+	if _, err := fmt.Sscanf(arguments, "%d,%x,%x", &kind, &address, &size); err != nil {
+		return "E01"
+	}
+	if kind != 0 {
+		return ""
+	}
+	if set {
+		s.debugger.SetBreakpoint(uint16(address))
+	} else {
+		s.debugger.ClearBreakpoint(uint16(address))
+	}
+	return "OK"
+}
+
+// Write raw data to the client.
+func (s *gdbSession) write(data string) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	io.WriteString(s.conn, data)
+}
+
+// Write a packet to the client.
+func (s *gdbSession) writePacket(data string) {
+	s.write(fmt.Sprintf("$%s#%02x", data, gdbChecksum(data)))
+}
+
+// Return the checksum of the data of a packet.
+func gdbChecksum(data string) byte {
+	var checksum byte
+	for i := 0; i < len(data); i++ {
+		checksum += data[i]
+	}
+	return checksum
+}
+
+// Remove the escapes of binary data in a packet.
+func gdbUnescape(data string) string {
+	if !strings.Contains(data, "}") {
+		return data
+	}
+	var unescaped strings.Builder
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			unescaped.WriteByte(data[i] ^ 0x20)
+		} else {
+			unescaped.WriteByte(data[i])
+		}
+	}
+	return unescaped.String()
+}
+
+// Encode the value of a register in target byte order, little endian.
+func gdbEncodeRegister(register Register, value uint16) string {
+	if register.Size() == 1 {
+		return fmt.Sprintf("%02x", byte(value))
+	}
+	return fmt.Sprintf("%02x%02x", byte(value), byte(value>>8))
+}
+
+// Decode the little endian value of a register.
+func gdbDecodeRegister(digits string) (uint16, error) {
+	data, err := hex.DecodeString(digits)
+	if err != nil || len(data) == 0 || len(data) > 2 {
+		return 0, fmt.Errorf("invalid register value %q", digits)
+	}
+	value := uint16(data[0])
+	if len(data) == 2 {
+		value |= uint16(data[1]) << 8
+	}
+	return value, nil
+}
+
+// Signals reported for the reasons of the stops.
+var gdbSignals = map[StopReason]int{
+	StopStep:             5,
+	StopBreakpoint:       5,
+	StopOpcodeBreakpoint: 5,
+	StopWatchpoint:       5,
+	StopPause:            2,
+	// SIGILL
+	StopFault: 4,
+}
+
+// Return the stop reply packet of the stop.
+func gdbStopReply(stop Stop) string {
+	switch stop.Reason {
+	case StopHalt:
+		return "W00"
+	case StopBreakpoint:
+		return fmt.Sprintf("T%02xthread:1;swbreak:;", gdbSignals[stop.Reason])
+	default:
+		return fmt.Sprintf("T%02xthread:1;", gdbSignals[stop.Reason])
+	}
+}
+
+// Return the target description, the registers are numbered
+// in the order of the Register constants.
+func gdbTargetDescription() string {
+	var description strings.Builder
+	description.WriteString(`<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+<feature name="org.chip8.core">
+`)
+	for register := Register(0); register < RegisterCount; register++ {
+		registerType := fmt.Sprintf("uint%d", register.Size()*8)
+		switch register {
+		case RegisterI:
+			registerType = "data_ptr"
+		case RegisterPC:
+			registerType = "code_ptr"
+		}
+		fmt.Fprintf(&description, "<reg name=\"%s\" bitsize=\"%d\" type=\"%s\" regnum=\"%d\"/>\n",
+			strings.ToLower(register.String()), register.Size()*8, registerType, register)
+	}
+	description.WriteString("</feature>\n</target>\n")
+	return description.String()
+}
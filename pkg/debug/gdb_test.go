@@ -0,0 +1,120 @@
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Send a packet to the server and return its reply.
+func gdbExchange(t *testing.T, conn net.Conn, reader *bufio.Reader, packet string) string {
+	fmt.Fprintf(conn, "$%s#%02x", packet, gdbChecksum(packet))
+	if ack, err := reader.ReadByte(); err != nil || ack != '+' {
+		t.Fatalf("Packet %q was not acknowledged.", packet)
+	}
+	if _, err := reader.ReadString('$'); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := reader.ReadString('#')
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Discard(2)
+	fmt.Fprint(conn, "+")
+	return strings.TrimSuffix(reply, "#")
+}
+
+func TestGDBServer(t *testing.T) {
+	debugger := newTestDebugger(t, testProgram)
+	client, server := net.Pipe()
+	defer client.Close()
+	go NewGDBServer(debugger).ServeConn(server)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				debugger.StepFrame(8)
+			}
+		}
+	}()
+	reader := bufio.NewReader(client)
+	if reply := gdbExchange(t, client, reader, "qSupported:swbreak+"); !strings.Contains(reply, "qXfer:features:read+") {
+		t.Fatalf("Unexpected features %q.", reply)
+	}
+	if reply := gdbExchange(t, client, reader, "qXfer:features:read:target.xml:0,1000"); !strings.Contains(reply, `name="pc"`) {
+		t.Fatalf("Unexpected target description %q.", reply)
+	}
+	if reply := gdbExchange(t, client, reader, "Z0,20a,2"); reply != "OK" {
+		t.Fatalf("Setting a breakpoint replied %q.", reply)
+	}
+	if reply := gdbExchange(t, client, reader, "c"); reply != "T05thread:1;swbreak:;" {
+		t.Fatalf("Continuing replied %q.", reply)
+	}
+	if reply := gdbExchange(t, client, reader, "p11"); reply != "0a02" {
+		t.Fatalf("PC is %q, expected 0a02.", reply)
+	}
+	if reply := gdbExchange(t, client, reader, "m208,4"); reply != "6203d001" {
+		t.Fatalf("Memory is %q.", reply)
+	}
+	if reply := gdbExchange(t, client, reader, "P1=7f"); reply != "OK" || debugger.ReadRegister(1) != 0x7F {
+		t.Fatalf("Writing V1 replied %q.", reply)
+	}
+	if reply := gdbExchange(t, client, reader, "s"); reply != "T05thread:1;" || debugger.ReadRegister(RegisterPC) != 0x20C {
+		t.Fatalf("Stepping replied %q.", reply)
+	}
+	if reply := gdbExchange(t, client, reader, "z0,20a,2"); reply != "OK" {
+		t.Fatalf("Clearing a breakpoint replied %q.", reply)
+	}
+	// The program loops forever, interrupt it.
+	fmt.Fprint(client, "$c#63")
+	if ack, err := reader.ReadByte(); err != nil || ack != '+' {
+		t.Fatal("Continuing was not acknowledged.")
+	}
+	fmt.Fprint(client, "\x03")
+	reply, err := reader.ReadString('#')
+	if err != nil || reply != "$T02thread:1;#" {
+		t.Fatalf("Interrupting replied %q.", reply)
+	}
+}
+
+// A connection that reads the given data and discards the writes.
+type gdbTestConn struct {
+	io.Reader
+}
+
+func (gdbTestConn) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (gdbTestConn) Close() error {
+	return nil
+}
+
+func TestGDBReaderStops(t *testing.T) {
+	// A packet that arrives after the session ended is never received.
+	session := &gdbSession{
+		conn:       gdbTestConn{strings.NewReader("$g#67$g#67")},
+		packets:    make(chan string),
+		interrupts: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	stopped := make(chan struct{})
+	go func() {
+		session.readPackets()
+		close(stopped)
+	}()
+	close(session.done)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Reader is blocked on a packet after the session ended.")
+	}
+}
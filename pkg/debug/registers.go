@@ -0,0 +1,171 @@
+package debug
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+	"github.com/ambertide/chip8/pkg/isa"
+)
+
+// A register of the processor, V0 to VF are 0 to 15.
+type Register int
+
+const (
+	RegisterI Register = iota + 16
+	// The address of the next instruction.
+	RegisterPC
+	RegisterSP
+	RegisterDT
+	RegisterST
+	// Number of registers.
+	RegisterCount
+)
+
+var registerNames = map[Register]string{
+	RegisterI:  "I",
+	RegisterPC: "PC",
+	RegisterSP: "SP",
+	RegisterDT: "DT",
+	RegisterST: "ST",
+}
+
+func (r Register) String() string {
+	if r < RegisterI {
+		return fmt.Sprintf("V%X", int(r))
+	}
+	return registerNames[r]
+}
+
+// Return the size of the register in bytes.
+func (r Register) Size() int {
+	switch r {
+	case RegisterI, RegisterPC, RegisterSP:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// Parse the name of a register, such as VA, I or DT.
+func ParseRegister(name string) (Register, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for register, registerName := range registerNames {
+		if name == registerName {
+			return register, nil
+		}
+	}
+	if len(name) == 2 && name[0] == 'V' {
+		if index, err := strconv.ParseUint(name[1:], 16, 8); err == nil {
+			return Register(index), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown register %q", name)
+}
+
+// Read the value of the register from the processor.
+func ReadRegister(p *device.Processor, register Register) uint16 {
+	switch register {
+	case RegisterI:
+		return p.ReadIRegister()
+	case RegisterPC:
+		return p.NextInstruction()
+	case RegisterSP:
+		return p.StackPointer()
+	case RegisterDT:
+		return uint16(p.DelayTimer())
+	case RegisterST:
+		return uint16(p.SoundTimer())
+	default:
+		return uint16(p.ReadRegister(uint8(register)))
+	}
+}
+
+// Write the value to the register of the processor, the
+// stack pointer is read only.
+func WriteRegister(p *device.Processor, register Register, value uint16) error {
+	switch register {
+	case RegisterI:
+		p.WriteIRegister(value)
+	case RegisterPC:
+		p.SetNextInstruction(value)
+	case RegisterSP:
+		return fmt.Errorf("%s is read only", register)
+	case RegisterDT:
+		p.WriteDelayTimer(byte(value))
+	case RegisterST:
+		p.WriteSoundTimer(byte(value))
+	default:
+		p.WriteRegister(uint8(register), byte(value))
+	}
+	return nil
+}
+
+// Read the value of the register while paused.
+func (d *Debugger) ReadRegister(register Register) uint16 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return ReadRegister(d.processor, register)
+}
+
+// Write the value to the register while paused.
+func (d *Debugger) WriteRegister(register Register, value uint16) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return WriteRegister(d.processor, register, value)
+}
+
+// Read a range of memory, addresses outside of the memory read as zero.
+func (d *Debugger) ReadMemory(address uint16, length int) []byte {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = d.processor.ReadMemory(address + uint16(i))
+	}
+	return data
+}
+
+// Decode the instruction at the address with the instructions
+// of the platform of the processor.
+func (d *Debugger) Instruction(address uint16) isa.Instruction {
+	code := d.ReadMemory(address, 4)
+	instruction := d.processor.Platform().Opcodes().Decode(uint16(code[0])<<8 | uint16(code[1]))
+	if instruction.Kind == isa.LoadILong {
+		instruction.NNN = uint16(code[2])<<8 | uint16(code[3])
+	}
+	return instruction
+}
+
+// Write the data to the memory, returns an error if any
+// of the addresses is reserved or outside of the memory.
+func (d *Debugger) WriteMemory(address uint16, data []byte) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for i, value := range data {
+		if !d.processor.WriteMemory(address+uint16(i), value) {
+			return fmt.Errorf("cannot write to 0x%03X", address+uint16(i))
+		}
+	}
+	return nil
+}
+
+// Return the size of the memory of the processor.
+func (d *Debugger) MemorySize() uint32 {
+	return d.processor.MemorySize()
+}
+
+// Return the stack, the most recently pushed address last.
+func (d *Debugger) Stack() []uint16 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.processor.Stack()
+}
+
+// Return a copy of the display.
+func (d *Debugger) Frame() device.Frame {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.processor.Frame()
+}
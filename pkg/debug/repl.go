@@ -0,0 +1,251 @@
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const replHelp = `Commands:
+  s, step                  Execute the next instruction.
+  n, next                  Execute the next instruction, stepping over calls.
+  o, out                   Run until the current subroutine returns.
+  c, continue              Run until a breakpoint, interrupt to pause.
+  b, break ADDR|OPCODE     Break at an address or on an opcode such as DXYN,
+                           or op F00A for an opcode without X, Y or N.
+  d, delete ADDR|OPCODE    Delete a breakpoint.
+  w, watch REG|ADDR[-END]  Break when a register or a memory range changes.
+  unwatch REG|ADDR[-END]   Delete a watchpoint.
+  i, info                  List the breakpoints and the watchpoints.
+  p, print [REG|ADDR [N]]  Print the registers, a register or N bytes of memory.
+  set REG|ADDR VALUE...    Set a register or memory.
+  stack                    Print the stack.
+  display                  Draw the display.
+  h, help                  Print this help.
+  q, quit                  Exit the debugger.
+`
+
+// A line based terminal interface to the debugger.
+type REPL struct {
+	debugger *Debugger
+	output   io.Writer
+	// Number of cycles in a frame while running.
+	cycles int
+}
+
+// Create a new terminal interface to the debugger, which runs
+// the given number of cycles in a frame while running.
+func NewREPL(debugger *Debugger, output io.Writer, cycles int) *REPL {
+	repl := new(REPL)
+	repl.debugger = debugger
+	repl.output = output
+	repl.cycles = cycles
+	return repl
+}
+
+// Read and execute commands until the input ends or quit is entered.
+func (r *REPL) Run(input io.Reader) error {
+	scanner := bufio.NewScanner(input)
+	r.printStop(r.debugger.LastStop())
+	for {
+		fmt.Fprint(r.output, "(chip8) ")
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "q" || fields[0] == "quit" {
+			return nil
+		}
+		if err := r.Execute(fields[0], fields[1:]); err != nil {
+			fmt.Fprintln(r.output, "error:", err)
+		}
+	}
+}
+
+// Execute a single command.
+func (r *REPL) Execute(command string, arguments []string) error {
+	d := r.debugger
+	switch command {
+	case "s", "step":
+		r.printStop(d.Step())
+	case "n", "next":
+		d.StepOver()
+		r.printStop(d.RunUntilStop(r.cycles))
+	case "o", "out":
+		d.StepOut()
+		r.printStop(d.RunUntilStop(r.cycles))
+	case "c", "continue":
+		d.Continue()
+		r.printStop(d.RunUntilStop(r.cycles))
+	case "b", "break":
+		return r.setBreakpoint(arguments)
+	case "d", "delete":
+		return r.deleteBreakpoint(arguments)
+	case "w", "watch":
+		if len(arguments) != 1 {
+			return fmt.Errorf("watch takes a register or an address range")
+		}
+		return d.Watch(arguments[0])
+	case "unwatch":
+		if len(arguments) != 1 || !d.Unwatch(arguments[0]) {
+			return fmt.Errorf("no such watchpoint")
+		}
+	case "i", "info":
+		r.printInfo()
+	case "p", "print":
+		return r.print(arguments)
+	case "set":
+		return r.set(arguments)
+	case "stack":
+		for i, address := range d.Stack() {
+			fmt.Fprintf(r.output, "#%d 0x%03X\n", i, address)
+		}
+	case "display":
+		frame := d.Frame()
+		return frame.WriteASCII(r.output)
+	case "h", "help":
+		fmt.Fprint(r.output, replHelp)
+	default:
+		return fmt.Errorf("unknown command %q, try help", command)
+	}
+	return nil
+}
+
+// Print where and why the debugger stopped.
+func (r *REPL) printStop(stop Stop) {
+	switch {
+	case stop.Err != nil:
+		fmt.Fprintf(r.output, "Stopped on %s: %v\n", stop.Reason, stop.Err)
+	case stop.Detail != "":
+		fmt.Fprintf(r.output, "Stopped on %s %s\n", stop.Reason, stop.Detail)
+	default:
+		fmt.Fprintf(r.output, "Stopped on %s\n", stop.Reason)
+	}
+	r.printInstruction(stop.PC)
+}
+
+// Print the instruction at the address.
+func (r *REPL) printInstruction(address uint16) {
+	opcode := r.debugger.ReadMemory(address, 2)
+	fmt.Fprintf(r.output, "0x%03X: %02X%02X  %v\n", address, opcode[0], opcode[1], r.debugger.Instruction(address))
+}
+
+func (r *REPL) setBreakpoint(arguments []string) error {
+	if len(arguments) == 0 || len(arguments) > 2 {
+		return fmt.Errorf("break takes an address or an opcode pattern")
+	}
+	expression := strings.Join(arguments, " ")
+	if pattern, ok := CutOpcodePattern(expression); ok {
+		return r.debugger.SetOpcodeBreakpoint(pattern)
+	}
+	address, err := ParseAddress(expression)
+	if err != nil {
+		return err
+	}
+	r.debugger.SetBreakpoint(address)
+	return nil
+}
+
+func (r *REPL) deleteBreakpoint(arguments []string) error {
+	if len(arguments) == 0 || len(arguments) > 2 {
+		return fmt.Errorf("delete takes an address or an opcode pattern")
+	}
+	expression := strings.Join(arguments, " ")
+	deleted := false
+	if pattern, ok := CutOpcodePattern(expression); ok {
+		deleted = r.debugger.ClearOpcodeBreakpoint(pattern)
+	} else if address, err := ParseAddress(expression); err == nil {
+		deleted = r.debugger.ClearBreakpoint(address)
+	}
+	if !deleted {
+		return fmt.Errorf("no such breakpoint")
+	}
+	return nil
+}
+
+func (r *REPL) printInfo() {
+	for _, address := range r.debugger.Breakpoints() {
+		fmt.Fprintf(r.output, "breakpoint 0x%03X\n", address)
+	}
+	for _, pattern := range r.debugger.OpcodeBreakpoints() {
+		fmt.Fprintf(r.output, "breakpoint %s\n", pattern)
+	}
+	for _, name := range r.debugger.Watchpoints() {
+		fmt.Fprintf(r.output, "watchpoint %s\n", name)
+	}
+}
+
+// Print all registers, a register or a range of memory.
+func (r *REPL) print(arguments []string) error {
+	if len(arguments) == 0 {
+		for register := Register(0); register < RegisterCount; register++ {
+			fmt.Fprintf(r.output, "%-2s = 0x%0*X", register, register.Size()*2, r.debugger.ReadRegister(register))
+			if register%4 == 3 || register >= RegisterI {
+				fmt.Fprintln(r.output)
+			} else {
+				fmt.Fprint(r.output, "  ")
+			}
+		}
+		return nil
+	}
+	if register, err := ParseRegister(arguments[0]); err == nil {
+		value := r.debugger.ReadRegister(register)
+		fmt.Fprintf(r.output, "%s = 0x%0*X (%d)\n", register, register.Size()*2, value, value)
+		return nil
+	}
+	address, err := ParseAddress(arguments[0])
+	if err != nil {
+		return err
+	}
+	length := 1
+	if len(arguments) > 1 {
+		if length, err = strconv.Atoi(arguments[1]); err != nil || length <= 0 {
+			return fmt.Errorf("invalid length %q", arguments[1])
+		}
+	}
+	data := r.debugger.ReadMemory(address, length)
+	for i := 0; i < len(data); i += 16 {
+		end := i + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		fmt.Fprintf(r.output, "0x%03X:", int(address)+i)
+		for _, value := range data[i:end] {
+			fmt.Fprintf(r.output, " %02X", value)
+		}
+		fmt.Fprintln(r.output)
+	}
+	return nil
+}
+
+// Set a register to a value, or memory to a sequence of bytes.
+func (r *REPL) set(arguments []string) error {
+	if len(arguments) < 2 {
+		return fmt.Errorf("set takes a register or an address and a value")
+	}
+	values := make([]uint16, len(arguments)-1)
+	for i, argument := range arguments[1:] {
+		value, err := strconv.ParseUint(argument, 0, 16)
+		if err != nil {
+			return fmt.Errorf("invalid value %q", argument)
+		}
+		values[i] = uint16(value)
+	}
+	if register, err := ParseRegister(arguments[0]); err == nil {
+		return r.debugger.WriteRegister(register, values[0])
+	}
+	address, err := ParseAddress(arguments[0])
+	if err != nil {
+		return err
+	}
+	data := make([]byte, len(values))
+	for i, value := range values {
+		data[i] = byte(value)
+	}
+	return r.debugger.WriteMemory(address, data)
+}
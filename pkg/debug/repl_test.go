@@ -0,0 +1,23 @@
+package debug
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestREPLOpcodeBreakpoint(t *testing.T) {
+	debugger := newTestDebugger(t, testProgram)
+	var output bytes.Buffer
+	repl := NewREPL(debugger, &output, 8)
+	if err := repl.Run(strings.NewReader("b op 00e0\nb op F00A\nb DXYN\nd op F00A\nb 0x20A\nq\n")); err != nil {
+		t.Fatal(err)
+	}
+	if patterns := debugger.OpcodeBreakpoints(); !reflect.DeepEqual(patterns, []string{"00E0", "DXYN"}) {
+		t.Fatalf("Opcode breakpoints are %v, expected 00E0 and DXYN.\n%s", patterns, output.String())
+	}
+	if addresses := debugger.Breakpoints(); !reflect.DeepEqual(addresses, []uint16{0x20A}) {
+		t.Fatalf("Breakpoints are %v, expected 0x20A.", addresses)
+	}
+}
@@ -0,0 +1,106 @@
+package debug
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Maps the addresses of a ROM to the lines and the labels of its
+// source, stored as JSON next to the ROM with the .sym extension.
+type SymbolMap struct {
+	// Addresses of the labels by their names.
+	Labels map[string]uint16 `json:"labels"`
+	// Source lines of the instructions and the data, sorted by address.
+	Lines []SourceLine `json:"lines"`
+}
+
+// A line of source that assembled to the bytes at the address.
+type SourceLine struct {
+	Address uint16 `json:"address"`
+	// Path of the source file, relative to the symbol map.
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// Load the symbol map from the file at the path, the source files are
+// made absolute by resolving them relative to the directory of the map.
+func LoadSymbolMap(path string) (*SymbolMap, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	symbols, err := ReadSymbolMap(file)
+	if err != nil {
+		return nil, err
+	}
+	directory, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range symbols.Lines {
+		if !filepath.IsAbs(line.File) {
+			symbols.Lines[i].File = filepath.Join(directory, line.File)
+		}
+	}
+	return symbols, nil
+}
+
+// Read a symbol map as JSON.
+func ReadSymbolMap(r io.Reader) (*SymbolMap, error) {
+	symbols := new(SymbolMap)
+	if err := json.NewDecoder(r).Decode(symbols); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(symbols.Lines, func(i, j int) bool { return symbols.Lines[i].Address < symbols.Lines[j].Address })
+	return symbols, nil
+}
+
+// Write the symbol map as JSON.
+func (m *SymbolMap) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(m)
+}
+
+// Return the source line of the address, if any starts there.
+func (m *SymbolMap) Line(address uint16) (SourceLine, bool) {
+	i := sort.Search(len(m.Lines), func(i int) bool { return m.Lines[i].Address >= address })
+	if i < len(m.Lines) && m.Lines[i].Address == address {
+		return m.Lines[i], true
+	}
+	return SourceLine{}, false
+}
+
+// Return the first source line of the file at or after the line,
+// since breakpoints on blank lines move to the next instruction.
+func (m *SymbolMap) Address(file string, line int) (SourceLine, bool) {
+	file = filepath.Clean(file)
+	found := false
+	var closest SourceLine
+	for _, sourceLine := range m.Lines {
+		if filepath.Clean(sourceLine.File) != file || sourceLine.Line < line {
+			continue
+		}
+		if !found || sourceLine.Line < closest.Line {
+			closest, found = sourceLine, true
+		}
+	}
+	return closest, found
+}
+
+// Return the name of the closest label at or before the address.
+func (m *SymbolMap) Label(address uint16) (string, bool) {
+	name, found := "", false
+	var closest uint16
+	for label, labelAddress := range m.Labels {
+		if labelAddress > address || found && (labelAddress < closest || labelAddress == closest && label > name) {
+			continue
+		}
+		name, closest, found = label, labelAddress, true
+	}
+	return name, found
+}
@@ -0,0 +1,78 @@
+package disasm
+
+import (
+	"github.com/ambertide/chip8/pkg/emulator/device"
+	"github.com/ambertide/chip8/pkg/isa"
+)
+
+// How the execution continues after an instruction.
+type flow int
+
+const (
+	// Continue with the next instruction.
+	flowNext flow = iota
+	// Continue at the target only.
+	flowJump
+	// Continue at the target and then the next instruction.
+	flowCall
+	// Continue with the next instruction or the one after it.
+	flowSkip
+	// The continuation is not known statically, as for RET,
+	// EXIT and jumps relative to a register.
+	flowStop
+)
+
+// What the target address of an instruction refers to.
+type targetKind int
+
+const (
+	targetNone targetKind = iota
+	targetCode
+	targetSubroutine
+	targetData
+)
+
+// A decoded instruction with its control flow.
+type instruction struct {
+	isa.Instruction
+	flow flow
+	// What the address NNN of the instruction refers to.
+	targetKind targetKind
+}
+
+// Return the Cowgod syntax of the instruction, the target
+// address is written as the given operand.
+func (i instruction) format(target string) string {
+	if i.targetKind == targetNone {
+		return i.String()
+	}
+	return i.Format(func(uint16) string { return target })
+}
+
+// Decode the opcode on the platform, the next word is only used by
+// the long XO-CHIP load. Returns false for opcodes the processor
+// does not execute.
+func decode(opcode uint16, next uint16, platform device.Platform) (instruction, bool) {
+	i := instruction{Instruction: platform.Opcodes().Decode(opcode)}
+	switch i.Kind {
+	case isa.Invalid:
+		return i, false
+	case isa.Return, isa.Exit:
+		i.flow = flowStop
+	case isa.Jump:
+		i.flow, i.targetKind = flowJump, targetCode
+	case isa.Call:
+		i.flow, i.targetKind = flowCall, targetSubroutine
+	case isa.SkipEqualImmediate, isa.SkipNotEqualImmediate, isa.SkipEqual,
+		isa.SkipNotEqual, isa.SkipKeyPressed, isa.SkipKeyNotPressed:
+		i.flow = flowSkip
+	case isa.LoadI:
+		i.targetKind = targetData
+	case isa.LoadILong:
+		i.NNN, i.targetKind = next, targetData
+	case isa.JumpOffset:
+		// The offset is only known at run time.
+		i.flow, i.targetKind = flowStop, targetCode
+	}
+	return i, true
+}
@@ -0,0 +1,211 @@
+// Contains a disassembler, which follows the control flow of a ROM
+// to separate its code from its data.
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+	"github.com/ambertide/chip8/pkg/isa"
+)
+
+// The disassembly of a ROM.
+type Disassembly struct {
+	rom      []byte
+	origin   uint16
+	platform device.Platform
+	// Instructions reached from the start by their addresses.
+	instructions map[uint16]instruction
+	// Set for the bytes of the instructions.
+	code []bool
+	// What the addresses referred to by the instructions are.
+	labels map[uint16]targetKind
+}
+
+// Disassemble the ROM loaded at the start address of the platform,
+// following the jumps, calls and skips from the start.
+func Disassemble(rom []byte, platform device.Platform) *Disassembly {
+	d := &Disassembly{
+		rom:          rom,
+		origin:       device.RamStartLocation,
+		platform:     platform,
+		instructions: make(map[uint16]instruction),
+		code:         make([]bool, len(rom)),
+		labels:       make(map[uint16]targetKind),
+	}
+	if platform == device.ETI660 {
+		d.origin = device.ETI660StartLocation
+	}
+	d.labels[d.origin] = targetSubroutine
+	d.follow()
+	return d
+}
+
+// Return the address the ROM is loaded at.
+func (d *Disassembly) Origin() uint16 {
+	return d.origin
+}
+
+// Return the addresses of the instructions reached from the start in order.
+func (d *Disassembly) Addresses() []uint16 {
+	addresses := make([]uint16, 0, len(d.instructions))
+	for address := range d.instructions {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+	return addresses
+}
+
+// Return the instruction at the address, returns false if
+// the address was not reached from the start.
+func (d *Disassembly) Instruction(address uint16) (isa.Instruction, bool) {
+	decoded, ok := d.instructions[address]
+	return decoded.Instruction, ok
+}
+
+// Return the word at the address, zero outside of the ROM.
+func (d *Disassembly) word(address uint16) uint16 {
+	offset := int(address) - int(d.origin)
+	if offset < 0 || offset+1 >= len(d.rom) {
+		return 0
+	}
+	return uint16(d.rom[offset])<<8 | uint16(d.rom[offset+1])
+}
+
+// Decode the instruction at the address, returns false if the address
+// is outside of the ROM, or the instruction is invalid or overlaps code.
+func (d *Disassembly) decode(address uint16) (instruction, bool) {
+	offset := int(address) - int(d.origin)
+	if offset < 0 || offset+1 >= len(d.rom) {
+		return instruction{}, false
+	}
+	decoded, ok := decode(d.word(address), d.word(address+2), d.platform)
+	if !ok || offset+decoded.Size() > len(d.rom) {
+		return instruction{}, false
+	}
+	for i := offset; i < offset+decoded.Size(); i++ {
+		if d.code[i] {
+			return instruction{}, false
+		}
+	}
+	return decoded, true
+}
+
+// Decode all instructions reachable from the start.
+func (d *Disassembly) follow() {
+	pending := []uint16{d.origin}
+	for len(pending) > 0 {
+		address := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, ok := d.instructions[address]; ok {
+			continue
+		}
+		decoded, ok := d.decode(address)
+		if !ok {
+			continue
+		}
+		d.instructions[address] = decoded
+		offset := int(address) - int(d.origin)
+		for i := offset; i < offset+decoded.Size(); i++ {
+			d.code[i] = true
+		}
+		next := address + uint16(decoded.Size())
+		d.addLabel(decoded)
+		switch decoded.flow {
+		case flowNext:
+			pending = append(pending, next)
+		case flowJump:
+			pending = append(pending, decoded.NNN)
+		case flowCall:
+			pending = append(pending, next, decoded.NNN)
+		case flowSkip:
+			if d.platform == device.XOChip && d.word(next) == 0xF000 {
+				// Skips pass over both words of the long load, which
+				// is never decoded from its second word.
+				pending = append(pending, next, next+4)
+			} else {
+				pending = append(pending, next, next+2)
+			}
+		}
+	}
+}
+
+// Precedence of the kinds of labels, subroutines take precedence
+// over other code, which takes precedence over data.
+var labelPrecedence = map[targetKind]int{targetData: 1, targetCode: 2, targetSubroutine: 3}
+
+// Prefixes of the names of the labels.
+var labelPrefixes = map[targetKind]string{targetData: "data", targetCode: "label", targetSubroutine: "sub"}
+
+// Label the address the instruction refers to.
+func (d *Disassembly) addLabel(decoded instruction) {
+	if decoded.targetKind == targetNone {
+		return
+	}
+	if labelPrecedence[decoded.targetKind] > labelPrecedence[d.labels[decoded.NNN]] {
+		d.labels[decoded.NNN] = decoded.targetKind
+	}
+}
+
+// Return the label of the address if it starts a line of the
+// listing, otherwise the address itself.
+func (d *Disassembly) name(address uint16) string {
+	if label, ok := d.label(address); ok {
+		return label
+	}
+	return fmt.Sprintf("0x%03X", address)
+}
+
+// Return the label of the address, if it has one and starts a line.
+func (d *Disassembly) label(address uint16) (string, bool) {
+	kind, ok := d.labels[address]
+	offset := int(address) - int(d.origin)
+	if !ok || offset < 0 || offset >= len(d.rom) {
+		return "", false
+	}
+	if _, isInstruction := d.instructions[address]; !isInstruction && d.code[offset] {
+		return "", false
+	}
+	if address == d.origin {
+		return "start", true
+	}
+	return fmt.Sprintf("%s_%03X", labelPrefixes[kind], address), true
+}
+
+// Write the listing, an instruction or a byte of data on each line,
+// commented with its address and bytes. Data bytes are previewed
+// as a row of a sprite.
+func (d *Disassembly) Write(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	for offset := 0; offset < len(d.rom); {
+		address := d.origin + uint16(offset)
+		if label, ok := d.label(address); ok {
+			fmt.Fprintf(writer, "%s:\n", label)
+		}
+		if decoded, ok := d.instructions[address]; ok {
+			text := decoded.format(d.name(decoded.NNN))
+			fmt.Fprintf(writer, "\t%-24s; %03X: % X\n", text, address, d.rom[offset:offset+decoded.Size()])
+			offset += decoded.Size()
+			continue
+		}
+		value := d.rom[offset]
+		fmt.Fprintf(writer, "\t%-24s; %03X: %02X %s\n", fmt.Sprintf("db 0x%02X", value), address, value, spriteRow(value))
+		offset++
+	}
+	return writer.Flush()
+}
+
+// Return the byte as a row of a sprite.
+func spriteRow(value byte) string {
+	row := make([]byte, 8)
+	for i := range row {
+		row[i] = '.'
+		if value&(0x80>>i) != 0 {
+			row[i] = '#'
+		}
+	}
+	return string(row)
+}
@@ -0,0 +1,69 @@
+package disasm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+func TestDisassemble(t *testing.T) {
+	rom := []byte{
+		0x00, 0xE0, // CLS
+		0x22, 0x0A, // CALL sub_20A
+		0x3F, 0x01, // SE VF, 0x01
+		0x12, 0x02, // JP label_202
+		0x12, 0x08, // JP label_208
+		0xA2, 0x12, // LD I, data_212
+		0xD0, 0x15, // DRW V0, V1, 5
+		0x8E, 0x06, // SHR VE, V0
+		0x00, 0xEE, // RET
+		0xF0, 0x90, // Sprite
+	}
+	var listing bytes.Buffer
+	if err := Disassemble(rom, device.Chip8).Write(&listing); err != nil {
+		t.Fatal(err)
+	}
+	expected := `start:
+	CLS                     ; 200: 00 E0
+label_202:
+	CALL sub_20A            ; 202: 22 0A
+	SE VF, 0x01             ; 204: 3F 01
+	JP label_202            ; 206: 12 02
+label_208:
+	JP label_208            ; 208: 12 08
+sub_20A:
+	LD I, data_212          ; 20A: A2 12
+	DRW V0, V1, 5           ; 20C: D0 15
+	SHR VE, V0              ; 20E: 8E 06
+	RET                     ; 210: 00 EE
+data_212:
+	db 0xF0                 ; 212: F0 ####....
+	db 0x90                 ; 213: 90 #..#....
+`
+	if listing.String() != expected {
+		t.Fatalf("Unexpected listing:\n%s", listing.String())
+	}
+}
+
+func TestDisassembleSkipLongLoad(t *testing.T) {
+	rom := []byte{
+		0x30, 0x00, // SE V0, 0x00
+		0xF0, 0x00, 0x03, 0x00, // LD I, LONG 0x300
+		0x12, 0x06, // JP label_206
+	}
+	var listing bytes.Buffer
+	if err := Disassemble(rom, device.XOChip).Write(&listing); err != nil {
+		t.Fatal(err)
+	}
+	// The skip target is not decoded from the second word of the long load.
+	expected := `start:
+	SE V0, 0x00             ; 200: 30 00
+	LD I, LONG 0x300        ; 202: F0 00 03 00
+label_206:
+	JP label_206            ; 206: 12 06
+`
+	if listing.String() != expected {
+		t.Fatalf("Unexpected listing:\n%s", listing.String())
+	}
+}
@@ -0,0 +1,373 @@
+// Contains an emulation of the RCA COSMAC VIP, running the
+// original Chip-8 interpreter on an RCA CDP1802 processor.
+package cosmac
+
+// The devices connected to the buses of the CDP1802.
+type Bus interface {
+	// Read a byte from the memory.
+	Read(address uint16) byte
+	// Write a byte to the memory.
+	Write(address uint16, value byte)
+	// Handle an OUT instruction to the port (1-7).
+	Output(port byte, value byte)
+	// Handle an INP instruction from the port (1-7).
+	Input(port byte) byte
+	// Return the state of the external flag (1-4).
+	Flag(flag byte) bool
+}
+
+// An RCA CDP1802 processor, the state is exported so
+// that it can be inspected by the machine.
+type CDP1802 struct {
+	// Sixteen 16-bit scratchpad registers.
+	R [16]uint16
+	// The accumulator and the data flag.
+	D  byte
+	DF byte
+	// Designators of the program counter and
+	// the index register.
+	P byte
+	X byte
+	// Holds X and P during interrupts.
+	T byte
+	// Interrupt enable flip-flop.
+	IE bool
+	// The Q output flip-flop.
+	Q bool
+	// Set by IDL until a DMA or interrupt request.
+	Idle bool
+	// Number of machine cycles executed so far.
+	Cycles uint64
+	bus    Bus
+}
+
+// Create a new processor connected to the bus.
+func NewCDP1802(bus Bus) *CDP1802 {
+	cpu := new(CDP1802)
+	cpu.bus = bus
+	cpu.Reset()
+	return cpu
+}
+
+// Reset the processor, which starts the execution
+// from address 0 with R0 as the program counter.
+func (c *CDP1802) Reset() {
+	c.X, c.P, c.Q = 0, 0, false
+	c.R[0] = 0
+	c.IE = true
+	c.Idle = false
+}
+
+// Read the byte at R(X).
+func (c *CDP1802) readX() byte {
+	return c.bus.Read(c.R[c.X])
+}
+
+// Read the immediate byte at R(P) and increment R(P).
+func (c *CDP1802) readImmediate() byte {
+	value := c.bus.Read(c.R[c.P])
+	c.R[c.P]++
+	return value
+}
+
+// Store the result of an addition with carry in D and DF.
+func (c *CDP1802) add(a byte, b byte, carry byte) {
+	result := uint16(a) + uint16(b) + uint16(carry)
+	c.D = byte(result)
+	c.DF = byte(result >> 8)
+}
+
+// Store the result of a - b with borrow in D and DF,
+// where DF is set if there is no borrow.
+func (c *CDP1802) subtract(a byte, b byte, borrow byte) {
+	result := uint16(a) - uint16(b) - uint16(borrow)
+	c.D = byte(result)
+	c.DF = 1 - byte(result>>8)&1
+}
+
+// Return the condition of a branch instruction, where
+// the lower three bits of n select the condition.
+func (c *CDP1802) branchCondition(n byte) bool {
+	switch n & 0x7 {
+	case 0:
+		return true
+	case 1:
+		return c.Q
+	case 2:
+		return c.D == 0
+	case 3:
+		return c.DF == 1
+	default:
+		return c.bus.Flag(n&0x7 - 3)
+	}
+}
+
+// Handle an interrupt request, returns true if the
+// interrupt is accepted.
+func (c *CDP1802) Interrupt() bool {
+	if !c.IE {
+		return false
+	}
+	c.T = c.X<<4 | c.P
+	c.X, c.P = 2, 1
+	c.IE = false
+	c.Idle = false
+	c.Cycles++
+	return true
+}
+
+// Handle a DMA output request and return the byte at R0.
+func (c *CDP1802) DMAOut() byte {
+	value := c.bus.Read(c.R[0])
+	c.R[0]++
+	c.Idle = false
+	c.Cycles++
+	return value
+}
+
+// Execute a single instruction and return the number
+// of machine cycles it took.
+func (c *CDP1802) Step() int {
+	if c.Idle {
+		// Wait a cycle for a DMA or interrupt request.
+		c.Cycles++
+		return 1
+	}
+	opcode := c.readImmediate()
+	i, n := opcode>>4, opcode&0xF
+	cycles := 2
+	switch i {
+	case 0x0:
+		if n == 0 {
+			// IDL: Wait for a DMA or interrupt request.
+			c.Idle = true
+		} else {
+			// LDN: Load via N.
+			c.D = c.bus.Read(c.R[n])
+		}
+	case 0x1:
+		// INC: Increment register N.
+		c.R[n]++
+	case 0x2:
+		// DEC: Decrement register N.
+		c.R[n]--
+	case 0x3:
+		// Short branches, the upper half of N inverts the condition.
+		condition := c.branchCondition(n)
+		if n&0x8 != 0 {
+			condition = !condition
+		}
+		if condition {
+			address := c.bus.Read(c.R[c.P])
+			c.R[c.P] = c.R[c.P]&0xFF00 | uint16(address)
+		} else {
+			c.R[c.P]++
+		}
+	case 0x4:
+		// LDA: Load advance.
+		c.D = c.bus.Read(c.R[n])
+		c.R[n]++
+	case 0x5:
+		// STR: Store via N.
+		c.bus.Write(c.R[n], c.D)
+	case 0x6:
+		c.executeInputOutput(n)
+	case 0x7:
+		c.executeControl(n)
+	case 0x8:
+		// GLO: Get low register N.
+		c.D = byte(c.R[n])
+	case 0x9:
+		// GHI: Get high register N.
+		c.D = byte(c.R[n] >> 8)
+	case 0xA:
+		// PLO: Put low register N.
+		c.R[n] = c.R[n]&0xFF00 | uint16(c.D)
+	case 0xB:
+		// PHI: Put high register N.
+		c.R[n] = c.R[n]&0x00FF | uint16(c.D)<<8
+	case 0xC:
+		c.executeLongBranch(n)
+		cycles = 3
+	case 0xD:
+		// SEP: Set P.
+		c.P = n
+	case 0xE:
+		// SEX: Set X.
+		c.X = n
+	case 0xF:
+		c.executeArithmetic(n)
+	}
+	c.Cycles += uint64(cycles)
+	return cycles
+}
+
+// Execute IRX, OUT and INP instructions.
+func (c *CDP1802) executeInputOutput(n byte) {
+	switch {
+	case n == 0:
+		// IRX: Increment R(X).
+		c.R[c.X]++
+	case n < 8:
+		// OUT: Output M(R(X)) and increment R(X).
+		c.bus.Output(n, c.readX())
+		c.R[c.X]++
+	case n == 8:
+		// Reserved on the CDP1802.
+	default:
+		// INP: Input to M(R(X)) and D.
+		c.D = c.bus.Input(n - 8)
+		c.bus.Write(c.R[c.X], c.D)
+	}
+}
+
+// Execute control and memory reference instructions.
+func (c *CDP1802) executeControl(n byte) {
+	switch n {
+	case 0x0, 0x1:
+		// RET and DIS: Restore X and P from M(R(X)).
+		value := c.readX()
+		c.R[c.X]++
+		c.X, c.P = value>>4, value&0xF
+		c.IE = n == 0x0
+	case 0x2:
+		// LDXA: Load via X and advance.
+		c.D = c.readX()
+		c.R[c.X]++
+	case 0x3:
+		// STXD: Store via X and decrement.
+		c.bus.Write(c.R[c.X], c.D)
+		c.R[c.X]--
+	case 0x4:
+		// ADC: Add with carry.
+		c.add(c.readX(), c.D, c.DF)
+	case 0x5:
+		// SDB: Subtract D with borrow.
+		c.subtract(c.readX(), c.D, 1-c.DF)
+	case 0x6:
+		// SHRC: Shift right with carry.
+		carry := c.DF
+		c.DF = c.D & 0x1
+		c.D = c.D>>1 | carry<<7
+	case 0x7:
+		// SMB: Subtract memory with borrow.
+		c.subtract(c.D, c.readX(), 1-c.DF)
+	case 0x8:
+		// SAV: Save T.
+		c.bus.Write(c.R[c.X], c.T)
+	case 0x9:
+		// MARK: Push X and P to the stack at R2.
+		c.T = c.X<<4 | c.P
+		c.bus.Write(c.R[2], c.T)
+		c.X = c.P
+		c.R[2]--
+	case 0xA:
+		// REQ: Reset Q.
+		c.Q = false
+	case 0xB:
+		// SEQ: Set Q.
+		c.Q = true
+	case 0xC:
+		// ADCI: Add with carry immediate.
+		c.add(c.readImmediate(), c.D, c.DF)
+	case 0xD:
+		// SDBI: Subtract D with borrow immediate.
+		c.subtract(c.readImmediate(), c.D, 1-c.DF)
+	case 0xE:
+		// SHLC: Shift left with carry.
+		carry := c.DF
+		c.DF = c.D >> 7
+		c.D = c.D<<1 | carry
+	case 0xF:
+		// SMBI: Subtract memory with borrow immediate.
+		c.subtract(c.D, c.readImmediate(), 1-c.DF)
+	}
+}
+
+// Execute long branch and long skip instructions.
+func (c *CDP1802) executeLongBranch(n byte) {
+	switch n {
+	case 0x4:
+		// NOP: No operation.
+		return
+	case 0xC:
+		// LSIE: Long skip if interrupts are enabled.
+		if c.IE {
+			c.R[c.P] += 2
+		}
+		return
+	}
+	// Long skips test Q, D and DF in their lower two bits,
+	// LSNQ, LSNZ and LSNF skip if the condition is false.
+	var condition bool
+	isSkip := n&0x4 != 0
+	switch {
+	case isSkip && n&0x8 == 0:
+		condition = !c.branchCondition(n & 0x3)
+	case isSkip:
+		condition = c.branchCondition(n & 0x3)
+	default:
+		condition = c.branchCondition(n)
+		if n&0x8 != 0 {
+			condition = !condition
+		}
+	}
+	switch {
+	case isSkip && condition:
+		c.R[c.P] += 2
+	case isSkip:
+		return
+	case condition:
+		high := c.bus.Read(c.R[c.P])
+		low := c.bus.Read(c.R[c.P] + 1)
+		c.R[c.P] = uint16(high)<<8 | uint16(low)
+	default:
+		c.R[c.P] += 2
+	}
+}
+
+// Execute the arithmetic and logic instructions.
+func (c *CDP1802) executeArithmetic(n byte) {
+	var operand byte
+	if n&0x8 != 0 {
+		// The upper half uses immediate operands.
+		if n != 0xE {
+			operand = c.readImmediate()
+		}
+	} else if n != 0x6 {
+		operand = c.readX()
+	}
+	switch n & 0x7 {
+	case 0x0:
+		// LDX and LDI: Load.
+		c.D = operand
+	case 0x1:
+		// OR and ORI.
+		c.D |= operand
+	case 0x2:
+		// AND and ANI.
+		c.D &= operand
+	case 0x3:
+		// XOR and XRI.
+		c.D ^= operand
+	case 0x4:
+		// ADD and ADI.
+		c.add(operand, c.D, 0)
+	case 0x5:
+		// SD and SDI: Subtract D.
+		c.subtract(operand, c.D, 0)
+	case 0x6:
+		if n == 0x6 {
+			// SHR: Shift right.
+			c.DF = c.D & 0x1
+			c.D >>= 1
+		} else {
+			// SHL: Shift left.
+			c.DF = c.D >> 7
+			c.D <<= 1
+		}
+	case 0x7:
+		// SM and SMI: Subtract memory.
+		c.subtract(c.D, operand, 0)
+	}
+}
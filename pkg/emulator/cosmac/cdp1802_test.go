@@ -0,0 +1,63 @@
+package cosmac
+
+import "testing"
+
+// A bus with 64K of RAM and no devices.
+type testBus struct {
+	memory [0x10000]byte
+}
+
+func (b *testBus) Read(address uint16) byte         { return b.memory[address] }
+func (b *testBus) Write(address uint16, value byte) { b.memory[address] = value }
+func (b *testBus) Output(port byte, value byte)     {}
+func (b *testBus) Input(port byte) byte             { return 0 }
+func (b *testBus) Flag(flag byte) bool              { return false }
+
+// Run the program until the processor becomes idle.
+func runTestProgram(program []byte) *CDP1802 {
+	bus := new(testBus)
+	copy(bus.memory[:], program)
+	cpu := NewCDP1802(bus)
+	for !cpu.Idle {
+		cpu.Step()
+	}
+	return cpu
+}
+
+func TestArithmetic(t *testing.T) {
+	// LDI 0xF0; ADI 0x20; PLO R3; LDI 0x10; SMI 0x20; PHI R3; IDL
+	cpu := runTestProgram([]byte{0xF8, 0xF0, 0xFC, 0x20, 0xA3, 0xF8, 0x10, 0xFF, 0x20, 0xB3, 0x00})
+	if cpu.R[3] != 0xF010 {
+		t.Fatalf("R3 is %04X, expected F010.", cpu.R[3])
+	}
+	if cpu.DF != 0 {
+		t.Fatalf("DF is %d after a borrow, expected 0.", cpu.DF)
+	}
+}
+
+func TestBranches(t *testing.T) {
+	// 00: LDI 0x00; LBZ 0x0008; IDL; IDL
+	// 08: SEQ; LSQ; IDL; IDL; BQ 0x10
+	// 10: LDI 0x2A; PLO R4; IDL
+	cpu := runTestProgram([]byte{
+		0xF8, 0x00, 0xC2, 0x00, 0x08, 0x00, 0x00, 0x00,
+		0x7B, 0xCD, 0x00, 0x00, 0x31, 0x10, 0x00, 0x00,
+		0xF8, 0x2A, 0xA4, 0x00,
+	})
+	if cpu.R[4] != 0x2A {
+		t.Fatalf("R4 is %04X, expected 002A.", cpu.R[4])
+	}
+}
+
+func TestReturn(t *testing.T) {
+	// 00: LDI 0x20; PLO R2; LDI 0x10; PLO R3; SEX R2; RET
+	// 10: IDL
+	// 20: X=1, P=3
+	program := make([]byte, 0x21)
+	copy(program, []byte{0xF8, 0x20, 0xA2, 0xF8, 0x10, 0xA3, 0xE2, 0x70})
+	program[0x20] = 0x13
+	cpu := runTestProgram(program)
+	if cpu.X != 1 || cpu.P != 3 || !cpu.IE || cpu.R[2] != 0x21 {
+		t.Fatalf("RET restored X=%d P=%d IE=%v R2=%04X, expected X=1 P=3 IE=true R2=0021.", cpu.X, cpu.P, cpu.IE, cpu.R[2])
+	}
+}
@@ -0,0 +1,80 @@
+package cosmac
+
+// Timing of the CDP1861 video display controller in
+// machine cycles and scanlines of the CDP1802.
+const (
+	CyclesPerLine  = 14
+	LinesPerFrame  = 262
+	CyclesPerFrame = CyclesPerLine * LinesPerFrame
+	// The interrupt is requested two lines before the display
+	// area, 29 cycles before the first DMA request.
+	interruptLine = 78
+	// The first and the last line of the display area.
+	firstDisplayLine = 80
+	lastDisplayLine  = 207
+	// The cycle of the line the DMA requests start at.
+	dmaStartCycle = 1
+	// Number of bytes transferred by DMA for each line.
+	BytesPerLine = 8
+	// Number of lines the EF1 flag is asserted for before the
+	// display area and before the end of the display area.
+	flagLines = 4
+)
+
+// Number of lines in the display area.
+const DisplayLines = lastDisplayLine - firstDisplayLine + 1
+
+// An RCA CDP1861 video display controller, which requests an
+// interrupt before the display area and pulls each of its lines
+// from the memory with DMA.
+type cdp1861 struct {
+	// Enabled by INP 1 and disabled by OUT 1.
+	enabled bool
+	// Set once the interrupt of the frame is accepted.
+	interrupted bool
+	// The last line whose data is transferred.
+	transferredLine int
+	// Pixels of the display area of the current frame.
+	lines [DisplayLines][BytesPerLine]byte
+}
+
+// Return the line for the cycle within the frame.
+func lineOfCycle(frameCycle int) int {
+	return frameCycle / CyclesPerLine
+}
+
+// Start a new frame.
+func (v *cdp1861) startFrame() {
+	v.interrupted = false
+	v.transferredLine = -1
+	v.lines = [DisplayLines][BytesPerLine]byte{}
+}
+
+// Returns true if the interrupt should be requested.
+func (v *cdp1861) interruptRequested(frameCycle int) bool {
+	line := lineOfCycle(frameCycle)
+	return v.enabled && !v.interrupted && line >= interruptLine && line < firstDisplayLine
+}
+
+// Returns true if the line of the cycle should be transferred.
+func (v *cdp1861) dmaRequested(frameCycle int) bool {
+	line := lineOfCycle(frameCycle)
+	return v.enabled && line >= firstDisplayLine && line <= lastDisplayLine &&
+		line != v.transferredLine && frameCycle%CyclesPerLine >= dmaStartCycle
+}
+
+// Returns true if the EF1 flag is asserted during the cycle.
+func (v *cdp1861) flag(frameCycle int) bool {
+	line := lineOfCycle(frameCycle)
+	return (line >= firstDisplayLine-flagLines && line < firstDisplayLine) ||
+		(line > lastDisplayLine-flagLines && line <= lastDisplayLine)
+}
+
+// Transfer a line of the display area from the processor.
+func (v *cdp1861) transferLine(frameCycle int, cpu *CDP1802) {
+	line := lineOfCycle(frameCycle)
+	v.transferredLine = line
+	for i := 0; i < BytesPerLine; i++ {
+		v.lines[line-firstDisplayLine][i] = cpu.DMAOut()
+	}
+}
@@ -0,0 +1,191 @@
+package cosmac
+
+import (
+	"fmt"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+const (
+	// Size of the monitor ROM, mirrored above 0x8000.
+	MonitorSize = 0x200
+	// Chip-8 programs are loaded after the interpreter.
+	ProgramStartLocation = 0x200
+	// Default amount of RAM, the VIP could be expanded to 4K.
+	DefaultRAMSize = 0x1000
+	// Every scanline of a Chip-8 pixel is repeated four
+	// times by the interrupt routine of the interpreter.
+	linesPerPixel = 4
+)
+
+// An RCA COSMAC VIP running its monitor ROM and a Chip-8
+// interpreter on the emulated CDP1802, timing and behaviour
+// of the interpreter are thus exact by construction.
+type VIP struct {
+	cpu   *CDP1802
+	video cdp1861
+	ram   []byte
+	rom   [MonitorSize]byte
+	// After a reset, the ROM is mapped to address 0 as well
+	// until an address above 0x8000 is accessed.
+	romAtZero bool
+	// Key selected by OUT 2, whose state is read from EF3.
+	keyLatch byte
+	// Cycle within the current frame.
+	frameCycle int
+	// Set if Q is set at any point within the frame.
+	soundActive bool
+	// Buffers used to communicate between Goroutines,
+	// shared with the Chip-8 processor.
+	screenBuffer *device.FrameBuffer
+	keyState     *device.KeyState
+	soundBuffer  *device.SoundBuffer
+}
+
+// Create a new VIP with the given monitor ROM image and RAM size.
+func NewVIP(screenBuffer *device.FrameBuffer, keyState *device.KeyState, soundBuffer *device.SoundBuffer, monitor []byte, ramSize int) (*VIP, error) {
+	if len(monitor) > MonitorSize {
+		return nil, fmt.Errorf("monitor image is %d bytes, expected at most %d", len(monitor), MonitorSize)
+	}
+	vip := new(VIP)
+	vip.screenBuffer = screenBuffer
+	vip.keyState = keyState
+	vip.soundBuffer = soundBuffer
+	vip.ram = make([]byte, ramSize)
+	copy(vip.rom[:], monitor)
+	vip.cpu = NewCDP1802(vip)
+	vip.Reset()
+	return vip, nil
+}
+
+// Reset the VIP, which starts the monitor.
+func (v *VIP) Reset() {
+	v.cpu.Reset()
+	v.romAtZero = true
+	v.video = cdp1861{}
+	v.video.startFrame()
+	v.frameCycle = 0
+}
+
+// Load the Chip-8 interpreter image to the start of the RAM.
+func (v *VIP) LoadInterpreter(interpreter []byte) error {
+	if len(interpreter) > ProgramStartLocation {
+		return fmt.Errorf("interpreter image is %d bytes, expected at most %d", len(interpreter), ProgramStartLocation)
+	}
+	copy(v.ram, interpreter)
+	return nil
+}
+
+// Load a Chip-8 program after the interpreter.
+func (v *VIP) LoadProgram(program []byte) error {
+	if ProgramStartLocation+len(program) > len(v.ram) {
+		return fmt.Errorf("program is %d bytes, expected at most %d", len(program), len(v.ram)-ProgramStartLocation)
+	}
+	copy(v.ram[ProgramStartLocation:], program)
+	return nil
+}
+
+// Return the processor of the VIP.
+func (v *VIP) CPU() *CDP1802 {
+	return v.cpu
+}
+
+// Read a byte from the memory.
+func (v *VIP) Read(address uint16) byte {
+	if address >= 0x8000 {
+		v.romAtZero = false
+		return v.rom[address%MonitorSize]
+	}
+	if v.romAtZero {
+		return v.rom[address%MonitorSize]
+	}
+	return v.ram[int(address)%len(v.ram)]
+}
+
+// Write a byte to the memory, the ROM cannot be written.
+func (v *VIP) Write(address uint16, value byte) {
+	if address >= 0x8000 {
+		v.romAtZero = false
+		return
+	}
+	v.ram[int(address)%len(v.ram)] = value
+}
+
+// Handle the OUT instructions.
+func (v *VIP) Output(port byte, value byte) {
+	switch port {
+	case 1:
+		// OUT 1 disables the display.
+		v.video.enabled = false
+	case 2:
+		// OUT 2 selects the key to be read from EF3.
+		v.keyLatch = value & 0xF
+	}
+}
+
+// Handle the INP instructions.
+func (v *VIP) Input(port byte) byte {
+	if port == 1 {
+		// INP 1 enables the display.
+		v.video.enabled = true
+	}
+	return 0
+}
+
+// Return the state of the external flags.
+func (v *VIP) Flag(flag byte) bool {
+	switch flag {
+	case 1:
+		// EF1 is driven by the CDP1861.
+		return v.video.flag(v.frameCycle)
+	case 3:
+		// EF3 is asserted if the selected key is pressed.
+		return v.keyState.Mask()&(1<<v.keyLatch) != 0
+	default:
+		return false
+	}
+}
+
+// Run the VIP for a single frame of the CDP1861 and
+// update the screen and the sound buffers.
+func (v *VIP) StepFrame() {
+	v.soundActive = false
+	for v.frameCycle < CyclesPerFrame {
+		start := v.cpu.Cycles
+		switch {
+		case v.video.interruptRequested(v.frameCycle) && v.cpu.IE:
+			v.video.interrupted = v.cpu.Interrupt()
+		case v.video.dmaRequested(v.frameCycle):
+			v.video.transferLine(v.frameCycle, v.cpu)
+		default:
+			v.cpu.Step()
+		}
+		v.soundActive = v.soundActive || v.cpu.Q
+		v.frameCycle += int(v.cpu.Cycles - start)
+	}
+	// Carry the cycles of the last instruction to the next frame.
+	v.frameCycle -= CyclesPerFrame
+	v.syncBuffers()
+	v.video.startFrame()
+}
+
+// Update the screen and sound buffers from the frame.
+func (v *VIP) syncBuffers() {
+	var frame device.Frame
+	frame.Width = device.LowResolutionWidth
+	frame.Height = DisplayLines / linesPerPixel
+	for y := 0; y < frame.Height; y++ {
+		var row uint64
+		for _, value := range v.video.lines[y*linesPerPixel] {
+			row = row<<8 | uint64(value)
+		}
+		frame.Planes[0][y][0] = row
+	}
+	v.screenBuffer.Publish(frame)
+	v.soundBuffer.Publish(device.Sound{Active: v.soundActive})
+}
+
+// The VIP runs until it is reset.
+func (v *VIP) ShouldHalt() bool {
+	return false
+}
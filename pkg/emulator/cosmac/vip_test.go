@@ -0,0 +1,141 @@
+package cosmac
+
+import (
+	"testing"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+// Create a VIP with the monitor and the buffers of its frontend.
+func newTestVIP(t *testing.T, monitor []byte) (*VIP, *device.FrameBuffer) {
+	var screenBuffer device.FrameBuffer
+	var keyState device.KeyState
+	var soundBuffer device.SoundBuffer
+	vip, err := NewVIP(&screenBuffer, &keyState, &soundBuffer, monitor, DefaultRAMSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vip, &screenBuffer
+}
+
+func TestVIPMemoryMap(t *testing.T) {
+	monitor := make([]byte, MonitorSize)
+	for i := range monitor {
+		monitor[i] = byte(i) ^ 0x5A
+	}
+	vip, _ := newTestVIP(t, monitor)
+	vip.Write(0x0005, 0x42)
+	if value := vip.Read(0x0005); value != monitor[5] {
+		t.Fatalf("Address 0x0005 reads %02X after a reset, expected the ROM %02X.", value, monitor[5])
+	}
+	if value := vip.Read(0x8205); value != monitor[5] {
+		t.Fatalf("Address 0x8205 reads %02X, expected the mirrored ROM %02X.", value, monitor[5])
+	}
+	if value := vip.Read(0xFFFF); value != monitor[MonitorSize-1] {
+		t.Fatalf("Address 0xFFFF reads %02X, expected the mirrored ROM %02X.", value, monitor[MonitorSize-1])
+	}
+	if value := vip.Read(0x0005); value != 0x42 {
+		t.Fatalf("Address 0x0005 reads %02X after accessing the ROM, expected the RAM 42.", value)
+	}
+	vip.Write(0x8005, 0x00)
+	if value := vip.Read(0x8005); value != monitor[5] {
+		t.Fatal("ROM was written.")
+	}
+	vip.Write(0x1006, 0x24)
+	if value := vip.Read(0x0006); value != 0x24 {
+		t.Fatalf("Address 0x0006 reads %02X, expected the RAM mirrored from 0x1006.", value)
+	}
+	vip.Reset()
+	if value := vip.Read(0x0005); value != monitor[5] {
+		t.Fatal("ROM is not mapped to address 0 after a reset.")
+	}
+	if err := vip.LoadProgram(make([]byte, DefaultRAMSize)); err == nil {
+		t.Fatal("Program larger than the RAM was loaded.")
+	}
+}
+
+// A monitor that jumps to the mirror of the ROM, enables the display and
+// idles in a loop. Its interrupt routine points R0 to the display at 0x300
+// and pushes the X and P of the loop, then branches back to the RET before
+// its entry so that R1 points to the entry again.
+var displayMonitor = []byte{
+	0xC0, 0x80, 0x03, // 00: LBR 0x8003
+	0xF8, 0x80, 0xB1, // 03: LDI 0x80; PHI R1
+	0xF8, 0x20, 0xA1, // 06: LDI 0x20; PLO R1
+	0xF8, 0x80, 0xB3, // 09: LDI 0x80; PHI R3
+	0xF8, 0x10, 0xA3, // 0C: LDI 0x10; PLO R3
+	0xD3,             // 0F: SEP R3
+	0xF8, 0x01, 0xB2, // 10: LDI 0x01; PHI R2
+	0xF8, 0x00, 0xA2, // 13: LDI 0x00; PLO R2
+	0xE2, 0x69, // 16: SEX R2; INP 1
+	0x30, 0x18, // 18: BR 0x18
+	0x00, 0x00, 0x00, 0x00, 0x00,
+	0x70,             // 1F: RET
+	0xF8, 0x03, 0xB0, // 20: LDI 0x03; PHI R0
+	0xF8, 0x00, 0xA0, // 23: LDI 0x00; PLO R0
+	0xF8, 0x23, 0x52, // 26: LDI 0x23; STR R2
+	0x30, 0x1F, // 29: BR 0x1F
+}
+
+func TestVIPDisplay(t *testing.T) {
+	vip, screenBuffer := newTestVIP(t, displayMonitor)
+	// Every line transfers the next 8 bytes, and every fourth line is shown.
+	vip.Write(0x300, 0xAA)
+	vip.Write(0x308, 0xFF)
+	vip.Write(0x320, 0x0F)
+	for frame := 1; frame <= 3; frame++ {
+		vip.StepFrame()
+		// The loop is interrupted once in each frame.
+		if stack := vip.CPU().R[2]; stack != 0x100+uint16(frame) {
+			t.Fatalf("R2 is %04X after frame %d, expected one interrupt per frame.", stack, frame)
+		}
+	}
+	if address := vip.CPU().R[0]; address != 0x300+DisplayLines*BytesPerLine {
+		t.Fatalf("R0 is %04X after the frame, expected %d lines of DMA.", address, DisplayLines)
+	}
+	frame := screenBuffer.Latest()
+	for position, colour := range map[[2]int]byte{{0, 0}: 1, {1, 0}: 0, {2, 0}: 1, {0, 1}: 0, {4, 1}: 1, {7, 1}: 1} {
+		if actual := frame.Pixel(position[0], position[1]); actual != colour {
+			t.Fatalf("Pixel %v is %d, expected %d.", position, actual, colour)
+		}
+	}
+}
+
+func TestCDP1861Timing(t *testing.T) {
+	video := cdp1861{enabled: true}
+	video.startFrame()
+	lineCycle := func(line int, cycle int) int {
+		return line*CyclesPerLine + cycle
+	}
+	if video.interruptRequested(lineCycle(interruptLine-1, CyclesPerLine-1)) || !video.interruptRequested(lineCycle(interruptLine, 0)) {
+		t.Fatalf("Interrupt is not requested from line %d.", interruptLine)
+	}
+	if video.dmaRequested(lineCycle(firstDisplayLine-1, 5)) || video.dmaRequested(lineCycle(firstDisplayLine, 0)) ||
+		!video.dmaRequested(lineCycle(firstDisplayLine, dmaStartCycle)) {
+		t.Fatalf("DMA does not start at cycle %d of line %d.", dmaStartCycle, firstDisplayLine)
+	}
+	// The interrupt is requested 29 cycles before the first DMA request.
+	if first := lineCycle(firstDisplayLine, dmaStartCycle) - lineCycle(interruptLine, 0); first != 29 {
+		t.Fatalf("Interrupt is requested %d cycles before the DMA.", first)
+	}
+	video.transferredLine = firstDisplayLine
+	if video.dmaRequested(lineCycle(firstDisplayLine, 8)) || !video.dmaRequested(lineCycle(firstDisplayLine+1, dmaStartCycle)) {
+		t.Fatal("DMA is not requested once per line.")
+	}
+	if video.dmaRequested(lineCycle(lastDisplayLine+1, dmaStartCycle)) {
+		t.Fatal("DMA is requested after the display area.")
+	}
+	for line, asserted := range map[int]bool{75: false, 76: true, 79: true, 80: false, 203: false, 204: true, 207: true, 208: false} {
+		if video.flag(lineCycle(line, 0)) != asserted {
+			t.Fatalf("EF1 on line %d is %v, expected %v.", line, !asserted, asserted)
+		}
+	}
+	video.interrupted = true
+	if video.interruptRequested(lineCycle(interruptLine, 0)) {
+		t.Fatal("Interrupt is requested again after it was accepted.")
+	}
+	video = cdp1861{}
+	if video.interruptRequested(lineCycle(interruptLine, 0)) || video.dmaRequested(lineCycle(firstDisplayLine, dmaStartCycle)) {
+		t.Fatal("Disabled display requested an interrupt or DMA.")
+	}
+}
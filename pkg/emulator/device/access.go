@@ -0,0 +1,118 @@
+package device
+
+// Methods that expose the state of the processor to
+// native routines and tools built on the processor.
+
+// Read the general purpose register VX.
+func (p *Processor) ReadRegister(x uint8) byte {
+	return p.registers.ReadRegister(x & 0xF)
+}
+
+// Write to the general purpose register VX.
+func (p *Processor) WriteRegister(x uint8, value byte) {
+	p.registers.WriteRegister(x&0xF, value)
+}
+
+// Read the I register.
+func (p *Processor) ReadIRegister() uint16 {
+	return p.registers.ReadIRegister()
+}
+
+// Write to the I register.
+func (p *Processor) WriteIRegister(value uint16) {
+	p.registers.WriteIRegister(value)
+}
+
+// Return the address of the instruction being executed.
+func (p *Processor) ProgramCounter() uint16 {
+	return p.registers.GetProgramCounter()
+}
+
+// Return the address of the next instruction to be executed.
+func (p *Processor) NextInstruction() uint16 {
+	// Cycle increments the PC before fetching.
+	return p.registers.GetProgramCounter() + 2
+}
+
+// Set the address of the next instruction to be executed.
+func (p *Processor) SetNextInstruction(address uint16) {
+	p.setStartLocation(address)
+}
+
+// Return the number of addresses on the stack.
+func (p *Processor) StackPointer() uint16 {
+	return p.stack.stackPointer
+}
+
+// Return a copy of the addresses on the stack, the
+// most recently pushed one last.
+func (p *Processor) Stack() []uint16 {
+	addresses := make([]uint16, p.stack.stackPointer)
+	copy(addresses, p.stack.addresses[:])
+	return addresses
+}
+
+// Return the value of the delay timer.
+func (p *Processor) DelayTimer() byte {
+	return p.registers.delayTimer
+}
+
+// Return the value of the sound timer.
+func (p *Processor) SoundTimer() byte {
+	return p.registers.soundTimer
+}
+
+// Set the value of the delay timer.
+func (p *Processor) WriteDelayTimer(value byte) {
+	p.registers.delayTimer = value
+}
+
+// Set the value of the sound timer.
+func (p *Processor) WriteSoundTimer(value byte) {
+	p.registers.soundTimer = value
+}
+
+// Return the platform the processor emulates.
+func (p *Processor) Platform() Platform {
+	return p.platform
+}
+
+// Return the quirks the processor runs with.
+func (p *Processor) Quirks() Quirks {
+	return p.quirks
+}
+
+// Return the size of the memory of the platform.
+func (p *Processor) MemorySize() uint32 {
+	return p.memory.Size()
+}
+
+// Read a single cell from memory, addresses outside of
+// the memory of the platform read as zero.
+func (p *Processor) ReadMemory(address uint16) byte {
+	value, _ := p.memory.ReadMemory(address)
+	return value
+}
+
+// Write a single cell of memory, returns false if the
+// address is in the reserved range or out of bounds.
+func (p *Processor) WriteMemory(address uint16, value byte) bool {
+	return !isAddressInReservedRange(address) && p.memory.WriteMemory(address, value) == nil
+}
+
+// Return a copy of the display.
+func (p *Processor) Frame() Frame {
+	return p.display.screen
+}
+
+// Clear the display.
+func (p *Processor) ClearDisplay() {
+	p.display.ClearDisplay()
+}
+
+// Draw an 8 pixel wide sprite at (x, y) honouring the clipping
+// quirk, returns true if any pixels are erased.
+func (p *Processor) DrawSprite(x byte, y byte, sprite []byte) bool {
+	collidedRows, _ := p.display.DrawSprite(x, y, 8, sprite, p.quirks.ClipSprites)
+	return collidedRows > 0
+}
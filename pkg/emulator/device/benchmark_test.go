@@ -0,0 +1,74 @@
+package device
+
+import "testing"
+
+// Representative loops of ROMs, each runs forever.
+var benchmarkPrograms = []struct {
+	name     string
+	platform Platform
+	quirks   string
+	program  []byte
+}{
+	// LD V0, 0x05; LD V1, 0x03; ADD V0, V1; SUB V0, V1; SHR V0, V1; SHL V0, V1;
+	// OR V0, V1; AND V0, V1; XOR V0, V1; SUBN V0, V1; ADD V1, 0x01; SE V1, 0x00;
+	// JP 0x204; JP 0x200
+	{"Arithmetic", Chip8, "cowgod", []byte{
+		0x60, 0x05, 0x61, 0x03, 0x80, 0x14, 0x80, 0x15, 0x80, 0x16, 0x80, 0x1E,
+		0x80, 0x11, 0x80, 0x12, 0x80, 0x13, 0x80, 0x17, 0x71, 0x01, 0x31, 0x00,
+		0x12, 0x04, 0x12, 0x00,
+	}},
+	// LD I, 0x20A; DRW V0, V1, 8; ADD V0, 0x01; RND V1, 0x1F; JP 0x200; sprite
+	{"Draw", Chip8, "cowgod", []byte{
+		0xA2, 0x0A, 0xD0, 0x18, 0x70, 0x01, 0xC1, 0x1F, 0x12, 0x00,
+		0x3C, 0x42, 0x81, 0xA5, 0x81, 0x99, 0x42, 0x3C,
+	}},
+	// LD I, 0x300; LD V5, 0x7B; LD B, V5; LD [I], V5; LD V5, [I]; ADD I, V5;
+	// LD F, V5; LD R, V5; LD V5, R; CALL 0x216; JP 0x200; RET
+	{"Memory", SuperChip, "schip", []byte{
+		0xA3, 0x00, 0x65, 0x7B, 0xF5, 0x33, 0xF5, 0x55, 0xF5, 0x65, 0xF5, 0x1E,
+		0xF5, 0x29, 0xF5, 0x75, 0xF5, 0x85, 0x22, 0x16, 0x12, 0x00, 0x00, 0xEE,
+	}},
+	// LD I, LONG 0x0300; LD [I], V0-V3; LD V0-V3, [I]; PLANE 3; DRW V0, V1, 0;
+	// AUDIO; ADD V0, 0x01; JP 0x200. Drawing the 16x16 sprite on both planes
+	// takes most of the frame and is the same with the JIT, so the JIT gains
+	// little on this loop and may be within the noise of the interpreter.
+	{"XOChip", XOChip, "xochip", []byte{
+		0xF0, 0x00, 0x03, 0x00, 0x50, 0x32, 0x50, 0x33, 0xF3, 0x01, 0xD0, 0x10,
+		0xF0, 0x02, 0x70, 0x01, 0x12, 0x00,
+	}},
+}
+
+// Create a processor for the platform and load the given program.
+func newBenchmarkProcessor(platform Platform, quirks string, jit bool, program []byte) *Processor {
+	processor, _ := newTestProcessor(Config{Platform: platform, Quirks: QuirksPresets[quirks], JIT: jit}, program)
+	return processor
+}
+
+func TestCycleAllocations(t *testing.T) {
+	for _, test := range benchmarkPrograms {
+		processor := newBenchmarkProcessor(test.platform, test.quirks, false, test.program)
+		allocations := testing.AllocsPerRun(1000, func() {
+			if err := processor.Cycle(); err != nil {
+				t.Fatalf("Program %s failed with %v.", test.name, err)
+			}
+		})
+		if allocations != 0 {
+			t.Fatalf("Program %s allocated %v times per cycle.", test.name, allocations)
+		}
+	}
+}
+
+func BenchmarkCycle(b *testing.B) {
+	for _, benchmark := range benchmarkPrograms {
+		b.Run(benchmark.name, func(b *testing.B) {
+			processor := newBenchmarkProcessor(benchmark.platform, benchmark.quirks, false, benchmark.program)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := processor.Cycle(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package device
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Holds the last complete frame published by the machine, frames
+// are never modified once published so they can be read from any
+// goroutine without tearing.
+type FrameBuffer struct {
+	frame atomic.Value
+}
+
+// Publish a copy of the frame.
+func (b *FrameBuffer) Publish(frame Frame) {
+	b.frame.Store(&frame)
+}
+
+// Return the last published frame, which must not be modified.
+func (b *FrameBuffer) Latest() *Frame {
+	frame, _ := b.frame.Load().(*Frame)
+	if frame == nil {
+		return &Frame{}
+	}
+	return frame
+}
+
+// Holds the state of the sixteen keys as a bitmask, which is
+// written by the frontend and read by the machine.
+type KeyState struct {
+	mask uint32
+}
+
+// Replace the state of all keys.
+func (k *KeyState) Set(mask uint16) {
+	atomic.StoreUint32(&k.mask, uint32(mask))
+}
+
+// Mark the key as pressed.
+func (k *KeyState) Press(key byte) {
+	k.update(func(mask uint32) uint32 { return mask | 1<<(key&0xF) })
+}
+
+// Mark the key as released.
+func (k *KeyState) Release(key byte) {
+	k.update(func(mask uint32) uint32 { return mask &^ (1 << (key & 0xF)) })
+}
+
+// Atomically replace the mask with the result of the function.
+func (k *KeyState) update(fn func(uint32) uint32) {
+	for {
+		mask := atomic.LoadUint32(&k.mask)
+		if atomic.CompareAndSwapUint32(&k.mask, mask, fn(mask)) {
+			return
+		}
+	}
+}
+
+// Return the bitmask of the pressed keys.
+func (k *KeyState) Mask() uint16 {
+	return uint16(atomic.LoadUint32(&k.mask))
+}
+
+// Holds the sound state published by the machine once a frame.
+type SoundBuffer struct {
+	mutex sync.Mutex
+	sound Sound
+}
+
+// Publish the sound state.
+func (b *SoundBuffer) Publish(sound Sound) {
+	b.mutex.Lock()
+	b.sound = sound
+	b.mutex.Unlock()
+}
+
+// Return the last published sound state.
+func (b *SoundBuffer) Latest() Sound {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.sound
+}
@@ -0,0 +1,30 @@
+package device
+
+import "bytes"
+
+// A block of code compiled ahead of time, such as by the static
+// recompiler, which runs in place of the interpreter as long as
+// the code it was compiled from is not modified. The instructions
+// of the block must not wait, halt, fault or write to the memory.
+type CompiledBlock struct {
+	// Address of the first instruction and the code of the block.
+	Address uint16
+	Code    []byte
+	// Number of instructions the block runs.
+	Length int
+	// Run the instructions and set the next instruction.
+	Run func(p *Processor)
+}
+
+// Cache the compiled blocks whose code is in the memory.
+func (p *Processor) loadCompiledBlocks() {
+	var code [MaxBlockSize]byte
+	for _, compiled := range p.compiledBlocks {
+		start, stop := uint32(compiled.Address), uint32(compiled.Address)+uint32(len(compiled.Code))
+		if len(compiled.Code) > MaxBlockSize || p.memory.BlockReadFromMemory(start, stop, code[:]) != nil ||
+			!bytes.Equal(code[:len(compiled.Code)], compiled.Code) || p.memory.blocks.blocks[start] != nil {
+			continue
+		}
+		p.memory.blocks.add(&block{start: start, stop: stop, run: compiled.Run, length: compiled.Length})
+	}
+}
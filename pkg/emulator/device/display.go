@@ -1,54 +1,276 @@
 package device
 
+import (
+	"bufio"
+	"io"
+	"math/bits"
+)
+
+// Dimensions of the display in the low and
+// high resolution modes.
+const (
+	LowResolutionWidth   = 64
+	LowResolutionHeight  = 32
+	HighResolutionWidth  = 128
+	HighResolutionHeight = 64
+	// The ETI-660 has a taller low resolution mode.
+	ETI660Height = 48
+)
+
+// Number of bitplanes of the display, only the first
+// one is used outside of XO-CHIP.
+const PlaneCount = 2
+
+// A single bitplane of the display, each row is stored as
+// two words, the leftmost pixel is the most significant bit
+// of the first word and only the first Width bits are used.
+type Plane [HighResolutionHeight][2]uint64
+
+// A snapshot of the display with up to 128x64 pixels.
+type Frame struct {
+	// Dimensions of the display in the current mode.
+	Width  int
+	Height int
+	Planes [PlaneCount]Plane
+}
+
+// Return the colour of the pixel at (x, y), where each
+// bit of the colour is set if the pixel is lit in the
+// corresponding plane.
+func (f *Frame) Pixel(x int, y int) byte {
+	var colour byte
+	for i := range f.Planes {
+		if f.Planes[i][y][x/64]&(1<<(63-x%64)) != 0 {
+			colour |= 1 << i
+		}
+	}
+	return colour
+}
+
+// Characters of the pixels in the ASCII art depending
+// on the planes they are lit in.
+var pixelCharacters = [4]byte{'.', '#', '+', '*'}
+
+// Write the frame as ASCII art, a line for each row.
+func (f *Frame) WriteASCII(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			writer.WriteByte(pixelCharacters[f.Pixel(x, y)])
+		}
+		writer.WriteByte('\n')
+	}
+	return writer.Flush()
+}
+
+// Toggle the pixel at (x, y) of the plane and return
+// true if it was lit before.
+func (p *Plane) togglePixel(x int, y int) bool {
+	mask := uint64(1) << (63 - x%64)
+	wasLit := p[y][x/64]&mask != 0
+	p[y][x/64] ^= mask
+	return wasLit
+}
+
 type chip8Display struct {
-	// A 64x32 pixel screen
-	// Can easilly be represented
-	// This way.
-	screen [32]uint64
-	// Global buffer used to
-	// Communicate between Goroutines.
-	screenBuffer *[32]uint64
+	// A 64x32 pixel screen in low resolution mode,
+	// 128x64 in high resolution mode.
+	screen Frame
+	hires  bool
+	// Dimensions of the low resolution mode.
+	lowResolutionWidth  int
+	lowResolutionHeight int
+	// Bitmask of the planes affected by drawing, clearing
+	// and scrolling.
+	selectedPlanes byte
+	// Holds the selected planes returned by planes, so
+	// that drawing does not allocate.
+	planeBuffer [PlaneCount]*Plane
+	// Complete frames are published to the buffer
+	// to communicate between Goroutines.
+	screenBuffer *FrameBuffer
 }
 
-func newDisplay(screenBuffer *[32]uint64) *chip8Display {
+func newDisplay(screenBuffer *FrameBuffer, platform Platform) *chip8Display {
 	display := new(chip8Display)
 	display.screenBuffer = screenBuffer
+	display.lowResolutionWidth, display.lowResolutionHeight = platform.LowResolutionSize()
+	display.selectedPlanes = 0x1
+	display.SetHighResolution(false)
+	display.SyncBuffer()
 	return display
 }
 
+// Publish the current frame, called once the frame is complete.
 func (d *chip8Display) SyncBuffer() {
-	copy((*d.screenBuffer)[:], d.screen[:])
+	d.screenBuffer.Publish(d.screen)
+}
+
+// Returns true if the display is in high resolution mode.
+func (d *chip8Display) IsHighResolution() bool {
+	return d.hires
+}
+
+// Switch between the high and low resolution modes,
+// this also clears the display.
+func (d *chip8Display) SetHighResolution(hires bool) {
+	d.hires = hires
+	if hires {
+		d.screen.Width, d.screen.Height = HighResolutionWidth, HighResolutionHeight
+	} else {
+		d.screen.Width, d.screen.Height = d.lowResolutionWidth, d.lowResolutionHeight
+	}
+	d.screen.Planes = [PlaneCount]Plane{}
+}
+
+// Select the planes affected by the drawing instructions.
+func (d *chip8Display) SelectPlanes(planes byte) {
+	d.selectedPlanes = planes & 0x3
 }
 
-// Clear the display.
+// Return the number of selected planes.
+func (d *chip8Display) SelectedPlaneCount() int {
+	return bits.OnesCount8(d.selectedPlanes)
+}
+
+// Return the selected planes in order.
+func (d *chip8Display) planes() []*Plane {
+	planes := d.planeBuffer[:0]
+	for i := range d.screen.Planes {
+		if d.selectedPlanes&(1<<i) != 0 {
+			planes = append(planes, &d.screen.Planes[i])
+		}
+	}
+	return planes
+}
+
+// Clear the selected planes of the display.
 func (d *chip8Display) ClearDisplay() {
-	for i := 0; i < 32; i++ {
-		d.screen[i] = 0
-	}
-	d.SyncBuffer()
-}
-
-// Draw a sprite of height height into the screen
-// Starting from x and y, return true if any pixels
-// are erased.
-func (d *chip8Display) DrawSprite(x byte, y byte, height byte, sprite []byte) bool {
-	collusion := false
-	for i, spriteRow := range sprite[:height] {
-		displayRow := d.screen[(i+int(y))%32]
-		// Convert sprite row to have space.
-		paddedSpriteRow := uint64(spriteRow)
-		// Align the sprite row to its XOR location.
-		alignedSpriteRow := paddedSpriteRow
-		if x < 56 {
-			alignedSpriteRow = paddedSpriteRow << (56 - x)
-		} else {
-			alignedSpriteRow = paddedSpriteRow >> (x - 56)
-		}
-		// Check for collusion
-		collusion = collusion || (alignedSpriteRow&displayRow != 0)
-		// And XOR the screen.
-		d.screen[(i+int(y))%32] ^= alignedSpriteRow
-	}
-	d.SyncBuffer()
-	return collusion
+	for _, plane := range d.planes() {
+		*plane = Plane{}
+	}
+}
+
+// Draw a sprite of the given width (8 or 16) into the selected
+// planes starting from x and y and return the number of rows in
+// which pixels are erased. The sprite holds the data for each
+// selected plane one after another. If clip is true, the parts
+// of the sprite outside the screen are discarded, otherwise they
+// wrap around to the opposite side. The number of rows clipped at
+// the bottom of the screen is returned as well.
+func (d *chip8Display) DrawSprite(x byte, y byte, width int, sprite []byte, clip bool) (int, int) {
+	planes := d.planes()
+	if len(planes) == 0 {
+		return 0, 0
+	}
+	planeSize := len(sprite) / len(planes)
+	collidedRows, clippedRows := 0, 0
+	for i, plane := range planes {
+		collided, clipped := d.drawPlaneSprite(plane, x, y, width, sprite[i*planeSize:(i+1)*planeSize], clip)
+		if collided > collidedRows {
+			collidedRows = collided
+		}
+		if clipped > clippedRows {
+			clippedRows = clipped
+		}
+	}
+	return collidedRows, clippedRows
+}
+
+// Draw a sprite into a single plane.
+func (d *chip8Display) drawPlaneSprite(plane *Plane, x byte, y byte, width int, sprite []byte, clip bool) (int, int) {
+	collidedRows, clippedRows := 0, 0
+	bytesPerRow := width / 8
+	// The starting coordinates always wrap around.
+	startX, startY := int(x)%d.screen.Width, int(y)%d.screen.Height
+	for i := 0; i*bytesPerRow < len(sprite); i++ {
+		rowIndex := startY + i
+		if rowIndex >= d.screen.Height {
+			if clip {
+				clippedRows = len(sprite)/bytesPerRow - i
+				break
+			}
+			rowIndex %= d.screen.Height
+		}
+		// Left align the sprite row within 16 bits.
+		spriteRow := uint16(sprite[i*bytesPerRow]) << 8
+		if bytesPerRow == 2 {
+			spriteRow |= uint16(sprite[i*bytesPerRow+1])
+		}
+		collusion := false
+		for j := 0; j < width; j++ {
+			if spriteRow&(0x8000>>j) == 0 {
+				continue
+			}
+			columnIndex := startX + j
+			if columnIndex >= d.screen.Width {
+				if clip {
+					break
+				}
+				columnIndex %= d.screen.Width
+			}
+			// XOR the screen and check for collusion.
+			collusion = plane.togglePixel(columnIndex, rowIndex) || collusion
+		}
+		if collusion {
+			collidedRows++
+		}
+	}
+	return collidedRows, clippedRows
+}
+
+// Scroll the selected planes down by n rows.
+func (d *chip8Display) ScrollDown(n byte) {
+	height := d.screen.Height
+	rows := int(n)
+	if rows > height {
+		rows = height
+	}
+	for _, plane := range d.planes() {
+		copy(plane[rows:height], plane[:height-rows])
+		for i := 0; i < rows; i++ {
+			plane[i] = [2]uint64{}
+		}
+	}
+}
+
+// Scroll the selected planes up by n rows.
+func (d *chip8Display) ScrollUp(n byte) {
+	height := d.screen.Height
+	rows := int(n)
+	if rows > height {
+		rows = height
+	}
+	for _, plane := range d.planes() {
+		copy(plane[:height-rows], plane[rows:height])
+		for i := height - rows; i < height; i++ {
+			plane[i] = [2]uint64{}
+		}
+	}
+}
+
+// Scroll the selected planes right by n pixels.
+func (d *chip8Display) ScrollRight(n byte) {
+	for _, plane := range d.planes() {
+		for i := range plane {
+			row := &plane[i]
+			row[1] = row[1]>>n | row[0]<<(64-n)
+			row[0] >>= n
+			if !d.hires {
+				// Clear the bits shifted out of the screen.
+				row[1] = 0
+			}
+		}
+	}
+}
+
+// Scroll the selected planes left by n pixels.
+func (d *chip8Display) ScrollLeft(n byte) {
+	for _, plane := range d.planes() {
+		for i := range plane {
+			row := &plane[i]
+			row[0] = row[0]<<n | row[1]>>(64-n)
+			row[1] <<= n
+		}
+	}
 }
@@ -0,0 +1,84 @@
+package device
+
+import "fmt"
+
+// An error raised by a faulting instruction, which
+// records the location of the instruction.
+type fault interface {
+	error
+	setLocation(pc uint16, opcode uint16)
+}
+
+// Returned by Cycle if the instruction is not known
+// on the platform of the processor.
+type ErrUnknownOpcode struct {
+	PC     uint16
+	Opcode uint16
+}
+
+func (e *ErrUnknownOpcode) Error() string {
+	return fmt.Sprintf("unknown opcode %04X at 0x%03X", e.Opcode, e.PC)
+}
+
+func (e *ErrUnknownOpcode) setLocation(pc uint16, opcode uint16) {
+	e.PC, e.Opcode = pc, opcode
+}
+
+// Returned by Cycle if a subroutine is called when the stack is full.
+type ErrStackOverflow struct {
+	PC     uint16
+	Opcode uint16
+}
+
+func (e *ErrStackOverflow) Error() string {
+	return fmt.Sprintf("stack overflow by %04X at 0x%03X", e.Opcode, e.PC)
+}
+
+func (e *ErrStackOverflow) setLocation(pc uint16, opcode uint16) {
+	e.PC, e.Opcode = pc, opcode
+}
+
+// Returned by Cycle if a subroutine returns when the stack is empty.
+type ErrStackUnderflow struct {
+	PC     uint16
+	Opcode uint16
+}
+
+func (e *ErrStackUnderflow) Error() string {
+	return fmt.Sprintf("stack underflow by %04X at 0x%03X", e.Opcode, e.PC)
+}
+
+func (e *ErrStackUnderflow) setLocation(pc uint16, opcode uint16) {
+	e.PC, e.Opcode = pc, opcode
+}
+
+// Returned by Cycle if an instruction accesses an address
+// outside of the memory of the platform.
+type ErrMemoryOutOfBounds struct {
+	PC      uint16
+	Opcode  uint16
+	Address uint32
+}
+
+func (e *ErrMemoryOutOfBounds) Error() string {
+	return fmt.Sprintf("memory access to 0x%X out of bounds by %04X at 0x%03X", e.Address, e.Opcode, e.PC)
+}
+
+func (e *ErrMemoryOutOfBounds) setLocation(pc uint16, opcode uint16) {
+	e.PC, e.Opcode = pc, opcode
+}
+
+// Returned by Cycle if a machine code subroutine with no native
+// routine is called while the policy is FaultMachineCalls.
+type ErrUnhandledMachineCall struct {
+	PC     uint16
+	Opcode uint16
+}
+
+func (e *ErrUnhandledMachineCall) Error() string {
+	return fmt.Sprintf("unhandled machine code call %04X at 0x%03X", e.Opcode, e.PC)
+}
+
+func (e *ErrUnhandledMachineCall) setLocation(pc uint16, opcode uint16) {
+	e.PC, e.Opcode = pc, opcode
+}
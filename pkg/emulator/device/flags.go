@@ -0,0 +1,50 @@
+package device
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+)
+
+// Number of RPL user flags available to FX75 and FX85.
+const RPLFlagCount = 16
+
+// The RPL user flags of the HP-48, persisted
+// to a file between runs of a program.
+type chip8Flags struct {
+	flags [RPLFlagCount]byte
+	// Path to the file the flags are persisted to,
+	// flags are not persisted if it is empty.
+	path string
+}
+
+// Set the file the flags are persisted to and load
+// the flags from it if it exists.
+func (f *chip8Flags) SetPath(path string) {
+	f.path = path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Could not read RPL flags from %s: %v", path, err)
+		}
+		return
+	}
+	copy(f.flags[:], data)
+}
+
+// Store the first count flags from the source and persist them.
+func (f *chip8Flags) SaveFlags(source []byte, count uint8) {
+	copy(f.flags[:count], source)
+	if f.path == "" {
+		return
+	}
+	if err := os.WriteFile(f.path, f.flags[:], 0644); err != nil {
+		log.Printf("Could not write RPL flags to %s: %v", f.path, err)
+	}
+}
+
+// Return the first count flags.
+func (f *chip8Flags) LoadFlags(count uint8) []byte {
+	return f.flags[:count]
+}
@@ -1,138 +1,142 @@
 package device
 
-import (
-	"math/rand"
-)
+import "github.com/ambertide/chip8/pkg/isa"
 
-type LogicalInstructionType uint8
-
-const (
-	Load LogicalInstructionType = iota
-	Or
-	And
-	Xor
-	Add
-	Sub
-	Shr
-	Subn
-	Shl = 0xE
-)
-
-// Execute system instructions RET and CLR
-func (p *Processor) executeSystemInstruction(instruction string) {
-	switch instruction {
-	case "0000":
-		break
-	case "00E0":
+// Execute system instructions RET and CLR as well as
+// the SUPER-CHIP display and exit instructions, and
+// calls to machine code subroutines.
+func (p *Processor) executeSystemInstruction(instruction isa.Instruction) error {
+	switch instruction.Kind {
+	case isa.ClearScreen:
 		// CLR: Clear Screen
 		//log.Print("INSTRUCTION: Clear the display.\n")
 		p.display.ClearDisplay()
-	case "00EE":
+	case isa.Return:
 		// RET: Return from subroutine.
 		//log.Print("INSTRUCTION: Return from subroutine.\n")
-		p.registers.SetProgramCounter(p.stack.Pop())
-	default:
-		//log.Panicf("ERROR: Unknown Instruction %s.", instruction)
+		address, err := p.stack.Pop()
+		if err != nil {
+			return err
+		}
+		p.registers.SetProgramCounter(address)
+	case isa.ScrollRight:
+		// SCR: Scroll right by 4 pixels.
+		p.display.ScrollRight(4)
+	case isa.ScrollLeft:
+		// SCL: Scroll left by 4 pixels.
+		p.display.ScrollLeft(4)
+	case isa.Exit:
+		// EXIT: Exit the interpreter.
+		p.halted = true
+	case isa.LowResolution:
+		// LOW: Switch to the low resolution mode.
+		p.display.SetHighResolution(false)
+	case isa.HighResolution:
+		// HIGH: Switch to the high resolution mode.
+		p.display.SetHighResolution(true)
+	case isa.ScrollDown:
+		// SCD: Scroll down by N rows.
+		p.display.ScrollDown(instruction.N)
+	case isa.ScrollUp:
+		// SCU: Scroll up by N rows.
+		p.display.ScrollUp(instruction.N)
+	case isa.MachineCall:
+		// 0000 is not a call.
+		if instruction.NNN != 0 {
+			// SYS: Call a machine code subroutine.
+			return p.executeMachineCall(instruction.NNN)
+		}
+	}
+	return nil
+}
+
+// Skip the next instruction, XO-CHIP skips over both
+// words of the long F000 NNNN instruction.
+func (p *Processor) skipNextInstruction() {
+	p.registers.IncrementProgramCounter()
+	if next, err := p.fetchInstruction(); err == nil && p.platform == XOChip && next == 0xF000 {
+		p.registers.IncrementProgramCounter()
 	}
 }
 
 // Execute skip instructions that skip a number of intsructions
-// Depending on a condition. SE, SNE, SE, SNE.
-func (p *Processor) executeSkipInstructions(instructionChar string, instruction uint16) {
-	byteValue := byte(instruction & 0xFF) // For 3XNN and 4XNN
-	register := getRegisterIndex(instructionChar[1])
-	register2 := getRegisterIndex(instructionChar[2]) // For 5XY0
-	msn := instructionChar[0]                         // Most significant nibble
-	lsn := instructionChar[3]                         // Least significant nibble
+// Depending on a condition. SE, SNE, SE, SNE, SKP, SKNP.
+func (p *Processor) executeSkipInstructions(instruction isa.Instruction) {
+	register, register2 := instruction.X, instruction.Y
 	switch {
-	case msn == '3' && p.registers.ReadRegister(register) == byteValue:
+	case instruction.Kind == isa.SkipEqualImmediate && p.registers.ReadRegister(register) == instruction.NN:
 		// Incrementing the program counter now will effectively
-		// Skip this instruction.
+		// Skip the next instruction.
 		//log.Print("INSTRUCTION: Skip Variant 1.\n")
-		p.registers.IncrementProgramCounter()
-	case msn == '4' && p.registers.ReadRegister(register) != byteValue:
+		p.skipNextInstruction()
+	case instruction.Kind == isa.SkipNotEqualImmediate && p.registers.ReadRegister(register) != instruction.NN:
 		//log.Print("INSTRUCTION: Skip Variant 2.\n")
-		p.registers.IncrementProgramCounter()
-	case msn == '5' && lsn == '0' && p.registers.CompareRegisters(register, register2):
+		p.skipNextInstruction()
+	case instruction.Kind == isa.SkipEqual && p.registers.CompareRegisters(register, register2):
 		//log.Print("INSTRUCTION: Skip Variant 3.\n")
-		p.registers.IncrementProgramCounter()
-	case msn == '9' && lsn == '0' && !p.registers.CompareRegisters(register, register2):
+		p.skipNextInstruction()
+	case instruction.Kind == isa.SkipNotEqual && !p.registers.CompareRegisters(register, register2):
 		//log.Print("INSTRUCTION: Skip Variant 4.\n")
-		p.registers.IncrementProgramCounter()
-	case msn == 'E' && (instruction<<8 == 0x9E00) && p.keyboards.IsKeyPressed(p.registers.ReadRegister(register)):
+		p.skipNextInstruction()
+	case instruction.Kind == isa.SkipKeyPressed && p.keyboards.IsKeyPressed(p.registers.ReadRegister(register)):
 		//log.Print("INSTRUCTION: Skip Variant 5.\n")
-		p.registers.IncrementProgramCounter()
-	case msn == 'E' && (instruction<<8 == 0xA100) && !p.keyboards.IsKeyPressed(p.registers.ReadRegister(register)):
+		p.skipNextInstruction()
+	case instruction.Kind == isa.SkipKeyNotPressed && !p.keyboards.IsKeyPressed(p.registers.ReadRegister(register)):
 		//log.Print("INSTRUCTION: Skip Variant 6.\n")
-		p.registers.IncrementProgramCounter()
+		p.skipNextInstruction()
 	}
 }
 
-// Given the indexes for two registers and the operation type execute
-// the operation.
-func (p *Processor) executeLogicalInstructions(x uint8, y uint8, operationType LogicalInstructionType, instruction uint16) {
-	switch operationType {
-	case Load:
+// Given the indexes for two registers and the kind of the
+// operation execute the operation.
+func (p *Processor) executeLogicalInstructions(x uint8, y uint8, kind isa.Kind) {
+	vx, vy := p.registers.ReadRegister(x), p.registers.ReadRegister(y)
+	switch kind {
+	case isa.Move:
 		//log.Printf("INSTRUCTION: Arithmatic Logic Unit Load V%d, V%d.\n", x, y)
-		p.registers.RegisterOperation(x, y, func(b1 byte, b2 byte) byte { return b2 })
-	case Or:
+		p.registers.WriteRegister(x, vy)
+	case isa.Or:
 		//log.Printf("INSTRUCTION: Arithmatic Logic Unit Or V%d, V%d.\n", x, y)
-		p.registers.RegisterOperation(x, y, func(b1 byte, b2 byte) byte { return b1 | b2 })
-	case And:
+		p.registers.WriteRegister(x, vx|vy)
+		p.resetCarryQuirk()
+	case isa.And:
 		//log.Printf("INSTRUCTION: Arithmatic Logic Unit And V%d, V%d.\n", x, y)
-		p.registers.RegisterOperation(x, y, func(b1, b2 byte) byte { return b1 & b2 })
-	case Xor:
+		p.registers.WriteRegister(x, vx&vy)
+		p.resetCarryQuirk()
+	case isa.Xor:
 		//log.Printf("INSTRUCTION: Arithmatic Logic Unit Xor V%d, V%d.\n", x, y)
-		p.registers.RegisterOperation(x, y, func(b1, b2 byte) byte { return b1 ^ b2 })
-	case Add:
+		p.registers.WriteRegister(x, vx^vy)
+		p.resetCarryQuirk()
+	case isa.Add:
 		//log.Printf("INSTRUCTION: Arithmatic Logic Unit Add V%d, V%d.\n", x, y)
-		p.registers.RegisterOperationWithCarry(x, y, func(b1, b2 byte) byte { return b1 + b2 },
-			func(b1, b2 byte) byte {
-				if (uint16(b1) + uint16(b2)) > 255 {
-					return 1
-				} else {
-					return 0
-				}
-			},
-		)
-	case Sub:
+		p.registers.WriteRegisterWithFlag(x, vx+vy, uint16(vx)+uint16(vy) > 255)
+	case isa.Sub:
 		//log.Printf("INSTRUCTION: Arithmatic Logic Unit Sub V%d, V%d.\n", x, y)
-		p.registers.RegisterOperationWithCarry(x, y, func(b1, b2 byte) byte { return b1 - b2 },
-			func(b1, b2 byte) byte {
-				if b1 > b2 {
-					return 1
-				} else {
-					return 0
-				}
-			},
-		)
-	case Shr:
+		p.registers.WriteRegisterWithFlag(x, vx-vy, vx > vy)
+	case isa.ShiftRight:
 		//log.Printf("INSTRUCTION: Arithmatic Logic Unit Shr V%d, V%d.\n", x, y)
-		p.registers.RegisterOperationWithCarry(x, y, func(b1, b2 byte) byte { return b1 >> 1 },
-			func(b1, b2 byte) byte {
-				return b1 & 0x1
-			},
-		)
-	case Subn:
+		if !p.quirks.ShiftVX {
+			// Shift VY into VX instead.
+			vx = vy
+		}
+		p.registers.WriteRegisterWithFlag(x, vx>>1, vx&0x1 == 1)
+	case isa.SubN:
 		//log.Printf("INSTRUCTION: Arithmatic Logic Unit Subn V%d, V%d.\n", x, y)
-		p.registers.RegisterOperationWithCarry(x, y, func(b1, b2 byte) byte { return b2 - b1 },
-			func(b1, b2 byte) byte {
-				if b2 > b1 {
-					return 1
-				} else {
-					return 0
-				}
-			},
-		)
-	case Shl:
+		p.registers.WriteRegisterWithFlag(x, vy-vx, vy > vx)
+	case isa.ShiftLeft:
 		//log.Printf("INSTRUCTION: Arithmatic Logic Unit Shl V%d, V%d.\n", x, y)
-		p.registers.RegisterOperationWithCarry(x, y, func(b1, b2 byte) byte { return b1 << 1 },
-			func(b1, b2 byte) byte {
-				return b1 >> 7
-			},
-		)
-	default:
-		//log.Panicf("ERROR: Unknown Instruction %04X.", instruction)
+		if !p.quirks.ShiftVX {
+			// Shift VY into VX instead.
+			vx = vy
+		}
+		p.registers.WriteRegisterWithFlag(x, vx<<1, vx>>7 == 1)
+	}
+}
+
+// Reset VF after a bitwise operation if the quirk is enabled.
+func (p *Processor) resetCarryQuirk() {
+	if p.quirks.ResetVF {
+		p.registers.SetCarry(false)
 	}
 }
 
@@ -140,124 +144,220 @@ func (p *Processor) executeLogicalInstructions(x uint8, y uint8, operationType L
 // Randomly generated number.
 func (p *Processor) executeRandomAnd(register uint8, immediate byte) {
 	//log.Print("INSTRUCTION: Execute random number generation.\n")
-	randomByte := byte(rand.Intn(255))
+	randomByte := p.random.NextByte()
 	p.registers.WriteRegister(register, randomByte&immediate)
 }
 
 // Draw to the screen the sprite loaded from n bytes from the memory address at
 // Register I starting from screen coordinates (x, y) set VF to true if
-// there is collision.
-func (p *Processor) executeDrawInstruction(x uint8, y uint8, n byte) {
+// there is collision. If n is zero, a 16x16 sprite is drawn instead. In
+// the high resolution mode of SUPER-CHIP, VF is set to the number of rows
+// with collision, XO-CHIP sets it to 0 or 1 in both modes.
+func (p *Processor) executeDrawInstruction(x uint8, y uint8, n byte) error {
 	//log.Printf("INSTRUCTION: Draw at (V%d, V%d)\n", x, y)
-	memoryAddress := p.registers.ReadIRegister()
-	spriteData := p.memory.BlockReadFromMemory(memoryAddress, memoryAddress+uint16(n))
+	memoryAddress := uint32(p.registers.ReadIRegister())
+	width, spriteSize := 8, uint32(n)
+	if n == 0 {
+		width, spriteSize = 16, 32
+	}
+	// Each selected plane has its own sprite data.
+	spriteSize *= uint32(p.display.SelectedPlaneCount())
+	var spriteBuffer [PlaneCount * 32]byte
+	spriteData := spriteBuffer[:spriteSize]
+	if err := p.memory.BlockReadFromMemory(memoryAddress, memoryAddress+spriteSize, spriteData); err != nil {
+		return err
+	}
 	startX, startY := p.registers.ReadRegister(x), p.registers.ReadRegister(y)
-	collision := p.display.DrawSprite(startX, startY, n, spriteData)
-	p.registers.SetCarry(collision)
+	collidedRows, clippedRows := p.display.DrawSprite(startX, startY, width, spriteData, p.quirks.ClipSprites)
+	if p.platform == SuperChip && p.display.IsHighResolution() {
+		// Rows clipped at the bottom of the screen count as well.
+		p.registers.WriteRegister(15, byte(collidedRows+clippedRows))
+	} else {
+		p.registers.SetCarry(collidedRows > 0)
+	}
+	if p.quirks.DisplayWait {
+		p.waitForVBlank()
+	}
+	return nil
 }
 
-func (p *Processor) executeRegisterInstructions(register uint8, instruction uint16) {
-	// There are 9 subtypes of F operations.
-	subtype := instruction & 0xFF
-	switch subtype {
-	case 0x07:
+func (p *Processor) executeRegisterInstructions(instruction isa.Instruction) error {
+	register := instruction.X
+	switch instruction.Kind {
+	case isa.LoadILong:
+		// LD: Load the next word to I.
+		p.registers.IncrementProgramCounter()
+		address, err := p.fetchInstruction()
+		if err != nil {
+			return err
+		}
+		p.registers.WriteIRegister(address)
+	case isa.SelectPlanes:
+		// PLANE: Select the drawing planes.
+		p.display.SelectPlanes(register)
+	case isa.LoadAudio:
+		// AUDIO: Load the audio pattern from memory.
+		addrStart := uint32(p.registers.ReadIRegister())
+		var pattern [AudioPatternSize]byte
+		if err := p.memory.BlockReadFromMemory(addrStart, addrStart+AudioPatternSize, pattern[:]); err != nil {
+			return err
+		}
+		p.registers.SetAudioPattern(pattern[:])
+	case isa.ReadDelay:
 		// LD: Load delay timer to VX
 		//log.Print("INSTRUCTION: Store DT.\n")
 		p.registers.LoadDelayTimer(register)
-	case 0x0A:
+	case isa.WaitKey:
 		// LD: Wait and load key to VX
 		//log.Print("INSTRUCTION: Wait for Key.\n")
-		p.registers.WriteRegister(register, p.keyboards.WaitForKeyPress())
-	case 0x15:
+		p.keyWaitRegister = register
+		p.keyboards.StartKeyWait()
+	case isa.SetDelay:
 		// LD: Load VX to delay timer
 		//log.Print("INSTRUCTION: Write DT\n")
 		p.registers.SetDelayTimer(register)
-	case 0x18:
+	case isa.SetSound:
 		// LD: Set Sound timer to VX
 		//log.Print("INSTRUCTION: Write ST\n")
 		p.registers.SetSoundTimer(register)
-	case 0x1E:
+	case isa.AddI:
 		// ADD: Accumulate VX to I
 		//log.Print("INSTRUCTION: Accumulate I\n")
 		p.registers.AccumulateIRegister(register)
-	case 0x29:
+	case isa.LoadDigit:
 		// LD: Set I to the location for the sprite
 		// of the digit in the register.
 		//log.Print("INSTRUCTION: Set I to sprite.\n")
 		p.registers.SetIDigitSprite(register)
-	case 0x33:
+	case isa.LoadLargeDigit:
+		// LD: Set I to the location for the large
+		// sprite of the digit in the register.
+		p.registers.SetILargeDigitSprite(register)
+	case isa.SetPitch:
+		// PITCH: Set the audio pattern playback rate.
+		p.registers.SetPitch(register)
+	case isa.StoreBCD:
 		// LD: Store BCD representation of VX in memory.
 		//log.Print("INSTRUCTION: Load BCD\n")
 		bcd := p.registers.ReadRegisterBCD(register)
-		addrrStart := p.registers.ReadIRegister()
-		p.memory.BlockWriteToMemory(addrrStart, addrrStart+3, bcd[:])
-	case 0x55:
+		addrrStart := uint32(p.registers.ReadIRegister())
+		return p.memory.BlockWriteToMemory(addrrStart, addrrStart+3, bcd[:])
+	case isa.Store:
 		// LD: Store registers to memory.
 		//log.Print("INSTRUCTION: Dump registers to memory.\n")
 		addrStart := p.registers.ReadIRegister()
 		registers := p.registers.BlockReadRegisters()
-		p.memory.BlockWriteToMemory(addrStart, addrStart+uint16(register+1), registers[:register+1])
-	case 0x65:
+		err := p.memory.BlockWriteToMemory(uint32(addrStart), uint32(addrStart)+uint32(register)+1, registers[:register+1])
+		if err != nil {
+			return err
+		}
+		if p.quirks.IncrementI {
+			p.registers.WriteIRegister(addrStart + uint16(register) + 1)
+		}
+	case isa.Load:
 		// LD: Load registers from memory.
 		//log.Print("INSTRUCTION: Load registers from memory.\n")
 		addrStart := p.registers.ReadIRegister()
-		registers := p.memory.BlockReadFromMemory(addrStart, addrStart+uint16(register+1))
+		var registers [16]byte
+		if err := p.memory.BlockReadFromMemory(uint32(addrStart), uint32(addrStart)+uint32(register)+1, registers[:register+1]); err != nil {
+			return err
+		}
+		p.registers.BlockWriteRegisters(registers, register+1)
+		if p.quirks.IncrementI {
+			p.registers.WriteIRegister(addrStart + uint16(register) + 1)
+		}
+	case isa.StoreFlags:
+		// LD: Store registers to the RPL user flags.
+		registers := p.registers.BlockReadRegisters()
+		p.flags.SaveFlags(registers[:register+1], register+1)
+	case isa.LoadFlags:
+		// LD: Load registers from the RPL user flags.
 		var registersCopy [16]byte
-		copy(registersCopy[:register+1], registers[:register+1])
+		copy(registersCopy[:], p.flags.LoadFlags(register+1))
 		p.registers.BlockWriteRegisters(registersCopy, register+1)
-		//fmt.Printf("0x%03X => %#v\n%#v\n%#v", addrStart, registers, registersCopy, p.registers.generalPurpose)
-	default:
-		//log.Panicf("ERROR: Unknown Instruction %04X.", instruction)
 	}
+	return nil
 }
 
-// Execute the next instruction
-func (p *Processor) executeInstruction(instruction uint16) {
-	instructionCharacter := getInstructionChar(instruction)
-	register := getRegisterIndex(instructionCharacter[1])  // For many instructions.
-	register2 := getRegisterIndex(instructionCharacter[2]) // For some instructions.
-	immediate := byte(instruction & 0xFF)                  // For some instructions.
-	switch instructionCharacter[0] {
-	case '0':
-		p.executeSystemInstruction(instructionCharacter)
-	case '1':
+// Execute the XO-CHIP instructions that store or load
+// the registers from x to y to the memory at I.
+func (p *Processor) executeRangeInstructions(instruction isa.Instruction) error {
+	x, y := instruction.X, instruction.Y
+	addrStart := uint32(p.registers.ReadIRegister())
+	count := registerRangeLength(x, y)
+	switch instruction.Kind {
+	case isa.StoreRange:
+		// LD: Store registers VX to VY to memory.
+		registers := p.registers.RangeReadRegisters(x, y)
+		return p.memory.BlockWriteToMemory(addrStart, addrStart+uint32(count), registers[:count])
+	case isa.LoadRange:
+		// LD: Load registers VX to VY from memory.
+		var registers [16]byte
+		if err := p.memory.BlockReadFromMemory(addrStart, addrStart+uint32(count), registers[:count]); err != nil {
+			return err
+		}
+		p.registers.RangeWriteRegisters(x, y, registers)
+	}
+	return nil
+}
+
+// Execute the decoded instruction.
+func (p *Processor) execute(instruction isa.Instruction) error {
+	register, register2 := instruction.X, instruction.Y // For many instructions.
+	switch instruction.Kind {
+	case isa.Invalid:
+		return &ErrUnknownOpcode{}
+	case isa.MachineCall, isa.ClearScreen, isa.Return, isa.ScrollDown, isa.ScrollUp,
+		isa.ScrollRight, isa.ScrollLeft, isa.Exit, isa.LowResolution, isa.HighResolution:
+		return p.executeSystemInstruction(instruction)
+	case isa.Jump:
 		// JP: Jump to the location.
 		//log.Print("INSTRUCTION: Jump to location.\n")
-		p.registers.SetProgramCounter((instruction & 0x0FFF) - 2)
-	case '2':
+		p.registers.SetProgramCounter(instruction.NNN - 2)
+	case isa.Call:
 		// CALL: Call a subroutine.
 		//log.Print("INSTRUCTION: Call a subroutine.\n")
-		p.stack.Push(p.registers.GetProgramCounter())
-		p.registers.SetProgramCounter((instruction & 0x0FFF) - 2)
-	case '3', '4', '5', '9', 'E':
-		p.executeSkipInstructions(instructionCharacter, instruction)
-	case '6':
+		if err := p.stack.Push(p.registers.GetProgramCounter()); err != nil {
+			return err
+		}
+		p.registers.SetProgramCounter(instruction.NNN - 2)
+	case isa.StoreRange, isa.LoadRange:
+		return p.executeRangeInstructions(instruction)
+	case isa.SkipEqualImmediate, isa.SkipNotEqualImmediate, isa.SkipEqual,
+		isa.SkipNotEqual, isa.SkipKeyPressed, isa.SkipKeyNotPressed:
+		p.executeSkipInstructions(instruction)
+	case isa.LoadImmediate:
 		// LD, load immediate value to register.
 		//log.Print("INSTRUCTION: Write an immediate value to a register.\n")
-		p.registers.WriteRegister(register, immediate)
-	case '7':
+		p.registers.WriteRegister(register, instruction.NN)
+	case isa.AddImmediate:
 		// ADD, add immediate value to register.
 		//log.Print("INSTRUCTION: Add an immediate value to a register.\n")
-		p.registers.AddRegisterImmediate(register, immediate)
-	case '8':
-		p.executeLogicalInstructions(register, register2, LogicalInstructionType(instruction&0xF), instruction)
-	case 'A':
+		p.registers.AddRegisterImmediate(register, instruction.NN)
+	case isa.Move, isa.Or, isa.And, isa.Xor, isa.Add, isa.Sub, isa.ShiftRight, isa.SubN, isa.ShiftLeft:
+		p.executeLogicalInstructions(register, register2, instruction.Kind)
+	case isa.LoadI:
 		// LD: Load to I register.
 		//log.Print("INSTRUCTION: Write to an I register.\n")
-		p.registers.WriteIRegister(instruction & 0xFFF)
-	case 'B':
+		p.registers.WriteIRegister(instruction.NNN)
+	case isa.JumpOffset:
 		// JP: Jump to V0 + NNN.
 		//log.Print("INSTRUCTION: Jump to a location V0 + immediate.\n")
-		p.registers.SetProgramCounter((uint16(p.registers.ReadRegister(0)) + instruction&0xFFF) - 2)
-	case 'C':
+		offsetRegister := uint8(0)
+		if p.quirks.JumpVX {
+			// Jump to VX + XNN instead.
+			offsetRegister = register
+		}
+		p.registers.SetProgramCounter((uint16(p.registers.ReadRegister(offsetRegister)) + instruction.NNN) - 2)
+	case isa.Random:
 		// RND: Set VX tp Random byte AND immediate
-		p.executeRandomAnd(register, immediate)
-	case 'D':
+		p.executeRandomAnd(register, instruction.NN)
+	case isa.Draw:
 		// DRW draw a sprite to the screen.
-		p.executeDrawInstruction(register, register2, byte(instruction&0xF))
-	case 'F':
+		return p.executeDrawInstruction(register, register2, instruction.N)
+	default:
 		// Register instructions
-		p.executeRegisterInstructions(register, instruction)
+		return p.executeRegisterInstructions(instruction)
 	}
-
+	return nil
 }
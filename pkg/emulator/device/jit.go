@@ -0,0 +1,215 @@
+package device
+
+import "github.com/ambertide/chip8/pkg/isa"
+
+// Maximum number of instructions translated into a block.
+const maxBlockLength = 64
+
+// Maximum size in bytes of a translated or compiled block.
+const MaxBlockSize = maxBlockLength * 4
+
+// A pre-decoded instruction of a block.
+type blockStep struct {
+	opcode  uint16
+	execute func(p *Processor) error
+}
+
+// A straight-line run of code translated into closures, which
+// ends with the first instruction that may not continue with the
+// next one, wait, or write to the memory.
+type block struct {
+	// Addresses of the first byte and after the last byte.
+	start uint32
+	stop  uint32
+	steps []blockStep
+	// Runs the instructions of a block compiled ahead of
+	// time instead of the steps.
+	run    func(p *Processor)
+	length int
+}
+
+// Caches the translated blocks by the address of their first
+// instruction and evicts them when their memory is written.
+type blockCache struct {
+	blocks []*block
+	// Number of cached blocks covering each address.
+	coverage []uint16
+}
+
+func newBlockCache(size uint32) *blockCache {
+	return &blockCache{blocks: make([]*block, size), coverage: make([]uint16, size)}
+}
+
+// Add a block to the cache.
+func (c *blockCache) add(b *block) {
+	c.blocks[b.start] = b
+	for address := b.start; address < b.stop; address++ {
+		c.coverage[address]++
+	}
+}
+
+// Remove the blocks that cover any address between the
+// start and stop addresses.
+func (c *blockCache) invalidate(start uint32, stop uint32) {
+	covered := false
+	for address := start; address < stop && address < uint32(len(c.coverage)); address++ {
+		covered = covered || c.coverage[address] != 0
+	}
+	if !covered {
+		return
+	}
+	first := uint32(0)
+	if start > MaxBlockSize {
+		first = start - MaxBlockSize
+	}
+	for address := first; address < stop && address < uint32(len(c.blocks)); address++ {
+		b := c.blocks[address]
+		if b == nil || b.stop <= start {
+			continue
+		}
+		c.blocks[address] = nil
+		for covered := b.start; covered < b.stop; covered++ {
+			c.coverage[covered]--
+		}
+	}
+}
+
+// Returns true if no instruction of the block may follow
+// an instruction of the kind.
+func endsBlock(kind isa.Kind) bool {
+	switch kind {
+	case isa.Invalid, isa.MachineCall, isa.Return, isa.Exit, isa.Jump, isa.Call, isa.JumpOffset,
+		isa.SkipEqualImmediate, isa.SkipNotEqualImmediate, isa.SkipEqual, isa.SkipNotEqual,
+		isa.SkipKeyPressed, isa.SkipKeyNotPressed, isa.Draw, isa.WaitKey,
+		isa.Store, isa.StoreRange, isa.StoreBCD:
+		return true
+	}
+	return false
+}
+
+// Translate the code starting at the address into a block, returns
+// nil if not even its first instruction is within the memory.
+func (p *Processor) translate(address uint16) *block {
+	b := &block{start: uint32(address), stop: uint32(address)}
+	table := p.platform.Opcodes()
+	for len(b.steps) < maxBlockLength && b.stop+2 <= p.memory.Size() {
+		opcode := p.readWord(b.stop)
+		instruction := table.Decode(opcode)
+		if instruction.Kind == isa.LoadILong {
+			if b.stop+4 > p.memory.Size() {
+				break
+			}
+			instruction.NNN = p.readWord(b.stop + 2)
+		}
+		b.steps = append(b.steps, blockStep{opcode, translateInstruction(instruction)})
+		b.stop += uint32(instruction.Size())
+		if endsBlock(instruction.Kind) {
+			break
+		}
+	}
+	if len(b.steps) == 0 {
+		return nil
+	}
+	return b
+}
+
+// Read the word at the address, which must be within the memory.
+func (p *Processor) readWord(address uint32) uint16 {
+	mostSignificantByte, _ := p.memory.ReadMemory(uint16(address))
+	leastSignificantByte, _ := p.memory.ReadMemory(uint16(address + 1))
+	return uint16(mostSignificantByte)<<8 | uint16(leastSignificantByte)
+}
+
+// Return a closure that executes the instruction, the most common
+// instructions skip the dispatch on the kind of the instruction.
+func translateInstruction(instruction isa.Instruction) func(p *Processor) error {
+	x, y := instruction.X, instruction.Y
+	switch instruction.Kind {
+	case isa.LoadImmediate:
+		return func(p *Processor) error {
+			p.registers.WriteRegister(x, instruction.NN)
+			return nil
+		}
+	case isa.AddImmediate:
+		return func(p *Processor) error {
+			p.registers.AddRegisterImmediate(x, instruction.NN)
+			return nil
+		}
+	case isa.Move, isa.Or, isa.And, isa.Xor, isa.Add, isa.Sub, isa.ShiftRight, isa.SubN, isa.ShiftLeft:
+		return func(p *Processor) error {
+			p.executeLogicalInstructions(x, y, instruction.Kind)
+			return nil
+		}
+	case isa.LoadI:
+		return func(p *Processor) error {
+			p.registers.WriteIRegister(instruction.NNN)
+			return nil
+		}
+	case isa.LoadILong:
+		// The second word was read during the translation.
+		return func(p *Processor) error {
+			p.registers.IncrementProgramCounter()
+			p.registers.WriteIRegister(instruction.NNN)
+			return nil
+		}
+	case isa.Jump:
+		return func(p *Processor) error {
+			p.registers.SetProgramCounter(instruction.NNN - 2)
+			return nil
+		}
+	case isa.SelectPlanes:
+		return func(p *Processor) error {
+			p.display.SelectPlanes(x)
+			return nil
+		}
+	case isa.StoreRange, isa.LoadRange:
+		return func(p *Processor) error {
+			return p.executeRangeInstructions(instruction)
+		}
+	}
+	return func(p *Processor) error {
+		return p.execute(instruction)
+	}
+}
+
+// Run the cached block of the next instruction up to the given number
+// of cycles, translating it first if the JIT is enabled, and return the
+// number of cycles run. Falls back to a single cycle while the processor
+// waits or if there is no block.
+func (p *Processor) runBlock(cycles int) (int, error) {
+	if p.IsWaiting() {
+		return 1, p.Cycle()
+	}
+	address := p.registers.GetProgramCounter() + 2
+	if uint32(address) >= p.memory.Size() {
+		return 1, p.Cycle()
+	}
+	b := p.memory.blocks.blocks[address]
+	if b == nil && p.jit {
+		if b = p.translate(address); b != nil {
+			p.memory.blocks.add(b)
+		}
+	}
+	if b == nil || b.run != nil && b.length > cycles {
+		return 1, p.Cycle()
+	}
+	if b.run != nil {
+		b.run(p)
+		return b.length, nil
+	}
+	for i, step := range b.steps {
+		if i == cycles || i > 0 && p.ShouldHalt() {
+			return i, nil
+		}
+		p.registers.IncrementProgramCounter()
+		programCounter := p.registers.GetProgramCounter()
+		if err := step.execute(p); err != nil {
+			if f, ok := err.(fault); ok {
+				// Record where the fault occured.
+				f.setLocation(programCounter, step.opcode)
+			}
+			return i + 1, err
+		}
+	}
+	return len(b.steps), nil
+}
@@ -0,0 +1,97 @@
+package device
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Rewrites the immediate of the instruction at 0x20C on every
+// iteration after it was translated: ADD V3, 0x01; LD V0, 0x64;
+// LD V1, V3; LD I, 0x20C; LD [I], V1; LD VE, 0x00; LD V4, 0x00;
+// ADD V5, V4; JP 0x200
+var selfModifyingProgram = []byte{
+	0x73, 0x01, 0x60, 0x64, 0x81, 0x30, 0xA2, 0x0C, 0xF1, 0x55,
+	0x6E, 0x00, 0x64, 0x00, 0x85, 0x44, 0x12, 0x00,
+}
+
+// Run the program with and without the JIT for a number of frames
+// and compare the states after every frame.
+func testJITMatchesInterpreter(t *testing.T, name string, platform Platform, quirks string, program []byte) {
+	interpreter := newBenchmarkProcessor(platform, quirks, false, program)
+	jit := newBenchmarkProcessor(platform, quirks, true, program)
+	for frame := 0; frame < 200; frame++ {
+		interpreterCycles, interpreterErr := interpreter.StepFrame(37)
+		jitCycles, jitErr := jit.StepFrame(37)
+		if (interpreterErr == nil) != (jitErr == nil) {
+			t.Fatalf("Program %s failed with %v and %v on frame %d.", name, interpreterErr, jitErr, frame)
+		}
+		if interpreterCycles != jitCycles {
+			t.Fatalf("Program %s ran %d cycles and %d with the JIT on frame %d.", name, interpreterCycles, jitCycles, frame)
+		}
+		if !bytes.Equal(interpreter.MarshalState(), jit.MarshalState()) {
+			t.Fatalf("Program %s differs with the JIT on frame %d.", name, frame)
+		}
+	}
+}
+
+func TestJITMatchesInterpreter(t *testing.T) {
+	for _, test := range benchmarkPrograms {
+		testJITMatchesInterpreter(t, test.name, test.platform, test.quirks, test.program)
+	}
+	testJITMatchesInterpreter(t, "SelfModifying", Chip8, "cowgod", selfModifyingProgram)
+}
+
+func TestJITInvalidatesBlocks(t *testing.T) {
+	processor := newBenchmarkProcessor(Chip8, "cowgod", true, selfModifyingProgram)
+	processor.StepFrame(len(selfModifyingProgram) / 2)
+	if processor.memory.blocks.blocks[0x20A] == nil {
+		t.Fatalf("Block at 0x20A was not cached.")
+	}
+	processor.WriteMemory(0x20D, 0x05)
+	if processor.memory.blocks.blocks[0x20A] != nil {
+		t.Fatalf("Block at 0x20A was not invalidated by a write to 0x20D.")
+	}
+	if processor.memory.blocks.blocks[0x200] == nil {
+		t.Fatalf("Block at 0x200 was invalidated by a write to 0x20D.")
+	}
+}
+
+func BenchmarkStepFrame(b *testing.B) {
+	for _, benchmark := range benchmarkPrograms {
+		for _, jit := range []bool{false, true} {
+			name := benchmark.name + "/Interpreter"
+			if jit {
+				name = benchmark.name + "/JIT"
+			}
+			b.Run(name, func(b *testing.B) {
+				processor := newBenchmarkProcessor(benchmark.platform, benchmark.quirks, jit, benchmark.program)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := processor.StepFrame(1000); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCompiledBlocks(t *testing.T) {
+	// LD V0, 0x01; JP 0x200 compiled into LD V0, 0x02; JP 0x200.
+	program := []byte{0x60, 0x01, 0x12, 0x00}
+	compiled := CompiledBlock{Address: 0x200, Code: program, Length: 2, Run: func(p *Processor) {
+		p.WriteRegister(0x0, 0x02)
+		p.SetNextInstruction(0x200)
+	}}
+	processor, _ := newTestProcessor(Config{Quirks: QuirksPresets["cowgod"], CompiledBlocks: []CompiledBlock{compiled}}, program)
+	processor.StepFrame(10)
+	if processor.ReadRegister(0x0) != 0x02 {
+		t.Fatalf("Compiled block was not run, V0 is 0x%02X.", processor.ReadRegister(0x0))
+	}
+	processor.WriteMemory(0x201, 0x03)
+	processor.StepFrame(10)
+	if processor.ReadRegister(0x0) != 0x03 {
+		t.Fatalf("Compiled block was run after its code was written, V0 is 0x%02X.", processor.ReadRegister(0x0))
+	}
+}
@@ -1,13 +1,19 @@
 package device
 
 type chip8Keyboard struct {
-	keyboardMask *uint16
+	keyState *KeyState
+	// Set while FX0A waits for a key.
+	waiting bool
+	// Set once a key is pressed during the wait, if
+	// the wait ends when it is released.
+	keyPressed bool
+	pressedKey byte
 }
 
 // Returns true if a key is pressed.
 func (k *chip8Keyboard) IsKeyPressed(keyValue byte) bool {
 	keymask := uint16(1) << keyValue // Calculate mask from value.
-	mask := *k.keyboardMask
+	mask := k.keyState.Mask()
 	return mask&keymask != 0
 }
 
@@ -25,21 +31,49 @@ func DecodeKey(keyboardMask uint16) byte {
 	return 0
 }
 
-// Halt program execution until key is pressed.
-func (k *chip8Keyboard) WaitForKeyPress() byte {
-	////log.Println("Waiting for key press.")
-	for {
-		keyboradMask := *k.keyboardMask
-		if keyboradMask != 0 {
-			return DecodeKey(keyboradMask)
+// Start waiting for a key.
+func (k *chip8Keyboard) StartKeyWait() {
+	k.waiting = true
+	k.keyPressed = false
+}
+
+// Returns true while waiting for a key.
+func (k *chip8Keyboard) IsWaitingForKey() bool {
+	return k.waiting
+}
+
+// Abandon the wait without a key.
+func (k *chip8Keyboard) CancelKeyWait() {
+	k.waiting = false
+	k.keyPressed = false
+}
+
+// Check the keys during a wait and return the key and true
+// once the wait is over. If release is true, the wait ends
+// once the pressed key is released, as on the COSMAC VIP,
+// otherwise as soon as a key is pressed.
+func (k *chip8Keyboard) PollKeyWait(release bool) (byte, bool) {
+	mask := k.keyState.Mask()
+	if !k.keyPressed {
+		if mask == 0 {
+			return 0, false
+		}
+		k.keyPressed = true
+		k.pressedKey = DecodeKey(mask)
+		if release {
+			return 0, false
 		}
+	} else if mask&(1<<k.pressedKey) != 0 {
+		return 0, false
 	}
+	k.CancelKeyWait()
+	return k.pressedKey, true
 }
 
-// Initialise a new keyboard whose buffer is shared
+// Initialise a new keyboard whose state is shared
 // Between emulator logic and device logic.
-func NewKeyboard(keyboardBuffer *uint16) *chip8Keyboard {
+func NewKeyboard(keyState *KeyState) *chip8Keyboard {
 	keyboard := new(chip8Keyboard)
-	keyboard.keyboardMask = keyboardBuffer
+	keyboard.keyState = keyState
 	return keyboard
 }
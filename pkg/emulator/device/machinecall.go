@@ -0,0 +1,73 @@
+package device
+
+import (
+	"fmt"
+	"log"
+)
+
+// A native routine run by 0NNN in place of the machine
+// code subroutine at NNN, with full access to the processor.
+type MachineRoutine func(p *Processor)
+
+// Determines what happens when a program calls a machine
+// code subroutine with no registered routine.
+type MachineCallPolicy uint8
+
+const (
+	// Unhandled calls are skipped silently.
+	IgnoreMachineCalls MachineCallPolicy = iota
+	// Unhandled calls are logged and skipped.
+	LogMachineCalls
+	// Unhandled calls fault the processor.
+	FaultMachineCalls
+)
+
+var machineCallPolicyNames = map[string]MachineCallPolicy{
+	"ignore": IgnoreMachineCalls,
+	"log":    LogMachineCalls,
+	"fault":  FaultMachineCalls,
+}
+
+// Return the machine call policy with the given name.
+func MachineCallPolicyByName(name string) (MachineCallPolicy, error) {
+	policy, ok := machineCallPolicyNames[name]
+	if !ok {
+		return IgnoreMachineCalls, fmt.Errorf("unknown machine call policy %q", name)
+	}
+	return policy, nil
+}
+
+// Register a native routine to be run when the program
+// calls the machine code subroutine at the address.
+func (p *Processor) RegisterMachineRoutine(address uint16, routine MachineRoutine) {
+	if p.machineRoutines == nil {
+		p.machineRoutines = make(map[uint16]MachineRoutine)
+	}
+	p.machineRoutines[address&0xFFF] = routine
+}
+
+// Remove the native routine registered for the address.
+func (p *Processor) UnregisterMachineRoutine(address uint16) {
+	delete(p.machineRoutines, address&0xFFF)
+}
+
+// Set the policy for calls with no registered routine.
+func (p *Processor) SetMachineCallPolicy(policy MachineCallPolicy) {
+	p.machineCallPolicy = policy
+}
+
+// Execute the SYS instruction, calling the machine code
+// subroutine at the address.
+func (p *Processor) executeMachineCall(address uint16) error {
+	if routine, ok := p.machineRoutines[address]; ok {
+		routine(p)
+		return nil
+	}
+	switch p.machineCallPolicy {
+	case LogMachineCalls:
+		log.Printf("Unhandled machine code call to 0x%03X at 0x%03X.", address, p.registers.GetProgramCounter())
+	case FaultMachineCalls:
+		return &ErrUnhandledMachineCall{}
+	}
+	return nil
+}
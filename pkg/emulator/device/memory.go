@@ -3,6 +3,16 @@ package device
 
 const RamStartLocation = 0x200
 
+// ETI-660 programs are loaded after the interpreter
+// which occupies the start of the RAM.
+const ETI660StartLocation = 0x600
+
+// Locations of the fonts in the reserved memory.
+const (
+	SmallFontLocation = 0x000
+	LargeFontLocation = 0x050
+)
+
 // Givena a chip-8 adress, calculate the location
 // of the corresponding value in the ram array.
 func calculateRAMOffset(address uint16) uint16 {
@@ -17,92 +27,120 @@ func isAddressInReservedRange(address uint16) bool {
 type chip8Memory struct {
 	// Reserved for the Interpreter.
 	reserved [512]byte
-	// Program space
-	ram [3584]byte
+	// Program space, large enough for XO-CHIP.
+	ram [0x10000 - RamStartLocation]byte
+	// Size of the addressable memory of the platform.
+	size uint32
+	// Translated blocks of code, evicted when their
+	// memory is written, nil unless the JIT is enabled.
+	blocks *blockCache
+}
+
+// Return an error if the addresses from start up to
+// stop are outside of the memory of the platform.
+func (m *chip8Memory) checkBounds(start uint32, stop uint32) error {
+	if start >= m.size {
+		return &ErrMemoryOutOfBounds{Address: start}
+	}
+	if stop > m.size {
+		return &ErrMemoryOutOfBounds{Address: m.size}
+	}
+	return nil
 }
 
 // Read a single cell from memory.
-func (m *chip8Memory) ReadMemory(address uint16) byte {
+func (m *chip8Memory) ReadMemory(address uint16) (byte, error) {
+	if err := m.checkBounds(uint32(address), uint32(address)+1); err != nil {
+		return 0, err
+	}
 	if isAddressInReservedRange(address) {
-		return m.reserved[address]
+		return m.reserved[address], nil
 	} else {
-		return m.ram[calculateRAMOffset(address)]
+		return m.ram[calculateRAMOffset(address)], nil
 	}
 }
 
-// Write a single cell of memory.
-func (m *chip8Memory) WriteMemory(address uint16, value byte) bool {
-	if isAddressInReservedRange(address) {
-		return false
-	} else {
+// Write a single cell of memory, writes to the
+// reserved range are ignored.
+func (m *chip8Memory) WriteMemory(address uint16, value byte) error {
+	if err := m.checkBounds(uint32(address), uint32(address)+1); err != nil {
+		return err
+	}
+	if !isAddressInReservedRange(address) {
 		m.ram[calculateRAMOffset(address)] = value
-		return true
+		m.invalidate(uint32(address), uint32(address)+1)
 	}
+	return nil
 }
 
-// Read from a block of memory between the start and stop addresses.
-func (m *chip8Memory) BlockWriteToMemory(start uint16, stop uint16, data []byte) bool {
-	if start < 0x200 {
+// Write to a block of memory between the start and stop addresses,
+// writes starting in the reserved range are ignored.
+func (m *chip8Memory) BlockWriteToMemory(start uint32, stop uint32, data []byte) error {
+	if err := m.checkBounds(start, stop); err != nil {
+		return err
+	}
+	if start < RamStartLocation {
 		// Reserved memory cannot be manipulated.
-		return false
+		return nil
 	}
 	// Calculate the destination slice.
-	dst := m.ram[calculateRAMOffset(start):calculateRAMOffset(stop)]
+	dst := m.ram[start-RamStartLocation : stop-RamStartLocation]
 	// And copy the data.
 	copy(dst, data)
-	return true
+	m.invalidate(start, stop)
+	return nil
 }
 
-// Read a block of memory between the start and stop adresses.
-func (m *chip8Memory) BlockReadFromMemory(start uint16, stop uint16) []byte {
-	// Create a buffer to hold copied values
-	// Preallocate it as well.
-	buffer := make([]byte, stop-start)
+// Read a block of memory between the start and stop adresses
+// into the buffer, which must hold at least stop - start bytes.
+func (m *chip8Memory) BlockReadFromMemory(start uint32, stop uint32, buffer []byte) error {
+	if err := m.checkBounds(start, stop); err != nil {
+		return err
+	}
 	// Since the read request may cross the reserved boundry.
 	// We must calculate the ranges we will copy from them.
-	var reservedStart, reservedStop, ramStart, ramStop uint16
-	if isAddressInReservedRange(start) {
-		reservedStart = start
-	} else {
-		ramStart = calculateRAMOffset(start)
+	reservedStart, reservedStop := start, stop
+	var ramStart, ramStop uint32
+	if start >= RamStartLocation {
+		reservedStart = RamStartLocation
+		ramStart = start - RamStartLocation
 	}
-	if isAddressInReservedRange(stop) {
-		reservedStop = stop
-	} else {
-		ramStop = calculateRAMOffset(stop)
+	if stop >= RamStartLocation {
+		reservedStop = RamStartLocation
+		ramStop = stop - RamStartLocation
 	}
 	// Finally we must calculate the stop point of the reserved
 	// Copy in the buffer.
 	seperator := reservedStop - reservedStart
 	// Now we can finally copy our values.
 	copy(buffer[:seperator], m.reserved[reservedStart:reservedStop])
-	copy(buffer[seperator:], m.ram[ramStart:ramStop])
-	return buffer
+	copy(buffer[seperator:stop-start], m.ram[ramStart:ramStop])
+	return nil
 }
 
 // Load a program to the chip8 memory given the size and the data
 // of the program. isETI660 is used to determine the loading start
 // location.
-func (m *chip8Memory) loadProgram(program []byte, programSize uint16, isETI660 bool) {
+func (m *chip8Memory) loadProgram(program []byte, programSize uint16, isETI660 bool) error {
 	var startLocation uint16 = RamStartLocation // The RAM start location
 	if isETI660 {
-		// ETI600 programs start in another location.
-		startLocation += 0x400
+		// ETI660 programs start in another location.
+		startLocation = ETI660StartLocation
 	}
 	// Write the program to memory.
-	m.BlockWriteToMemory(startLocation, startLocation+programSize, program)
+	return m.BlockWriteToMemory(uint32(startLocation), uint32(startLocation)+uint32(programSize), program)
 }
 
 // Load a traditional Chip-8 program to the memory
 // Given its data and program size.
-func (m *chip8Memory) LoadProgram(program []byte, programSize uint16) {
-	m.loadProgram(program, programSize, false)
+func (m *chip8Memory) LoadProgram(program []byte, programSize uint16) error {
+	return m.loadProgram(program, programSize, false)
 }
 
-// Load an ETI600 Chip-8 program to the memory
+// Load an ETI660 Chip-8 program to the memory
 // Given its data and program size.
-func (m *chip8Memory) LoadETIProgram(program []byte, programSize uint16) {
-	m.loadProgram(program, programSize, true)
+func (m *chip8Memory) LoadETIProgram(program []byte, programSize uint16) error {
+	return m.loadProgram(program, programSize, true)
 }
 
 // Load the reserved sections of the memory
@@ -126,11 +164,45 @@ func (m *chip8Memory) LoadReserved() {
 		0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
 		0xF0, 0x80, 0xF0, 0x80, 0x80, // F
 	}
-	copy(m.reserved[0:81], characterSprites)
+	copy(m.reserved[SmallFontLocation:], characterSprites)
+	// SUPER-CHIP 8x10 sprites.
+	largeCharacterSprites := []uint8{
+		0xFF, 0xFF, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, // 0
+		0x18, 0x78, 0x78, 0x18, 0x18, 0x18, 0x18, 0x18, 0xFF, 0xFF, // 1
+		0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // 2
+		0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 3
+		0xC3, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0x03, 0x03, 0x03, 0x03, // 4
+		0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 5
+		0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, // 6
+		0xFF, 0xFF, 0x03, 0x03, 0x06, 0x0C, 0x18, 0x18, 0x18, 0x18, // 7
+		0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, // 8
+		0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 9
+		0x7E, 0xFF, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, // A
+		0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, // B
+		0x3C, 0xFF, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0xFF, 0x3C, // C
+		0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC, // D
+		0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // E
+		0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0, // F
+	}
+	copy(m.reserved[LargeFontLocation:], largeCharacterSprites)
+}
+
+// Evict the translated blocks of code between the start
+// and stop addresses after the memory was written.
+func (m *chip8Memory) invalidate(start uint32, stop uint32) {
+	if m.blocks != nil {
+		m.blocks.invalidate(start, stop)
+	}
+}
+
+// Return the size of the addressable memory.
+func (m *chip8Memory) Size() uint32 {
+	return m.size
 }
 
-func newMemory() *chip8Memory {
+func newMemory(size uint32) *chip8Memory {
 	memory := new(chip8Memory)
+	memory.size = size
 	memory.LoadReserved()
 	return memory
 }
@@ -0,0 +1,109 @@
+package device
+
+import (
+	"fmt"
+
+	"github.com/ambertide/chip8/pkg/isa"
+)
+
+// The platform a program is written for, which
+// determines the available instructions and memory.
+type Platform uint8
+
+const (
+	// The original Chip-8, extended with the
+	// SUPER-CHIP 1.1 instructions.
+	Chip8 Platform = iota
+	// SUPER-CHIP 1.1.
+	SuperChip
+	// XO-CHIP with 64K memory, two bitplanes and
+	// the audio pattern buffer.
+	XOChip
+	// The ETI-660 with programs starting at 0x600 and
+	// a 64x48 display.
+	ETI660
+)
+
+var platformNames = map[string]Platform{
+	"chip8":  Chip8,
+	"schip":  SuperChip,
+	"xochip": XOChip,
+	"eti660": ETI660,
+}
+
+// Return the platform with the given name.
+func PlatformByName(name string) (Platform, error) {
+	platform, ok := platformNames[name]
+	if !ok {
+		return Chip8, fmt.Errorf("unknown platform %q", name)
+	}
+	return platform, nil
+}
+
+// Return the name of the platform, as taken by PlatformByName.
+func (p Platform) String() string {
+	switch p {
+	case Chip8:
+		return "chip8"
+	case SuperChip:
+		return "schip"
+	case XOChip:
+		return "xochip"
+	case ETI660:
+		return "eti660"
+	}
+	return fmt.Sprintf("Platform(%d)", uint8(p))
+}
+
+// Return the quirks profile programs written
+// for the platform expect.
+func (p Platform) DefaultQuirks() Quirks {
+	switch p {
+	case SuperChip:
+		return QuirksPresets["schip"]
+	case XOChip:
+		return QuirksPresets["xochip"]
+	default:
+		return QuirksPresets["cowgod"]
+	}
+}
+
+// Return the instructions the processor executes on the platform,
+// the original Chip-8 and the ETI-660 include the SUPER-CHIP ones.
+func (p Platform) Opcodes() *isa.Table {
+	if p == XOChip {
+		return isa.XOChip
+	}
+	return isa.SuperChip
+}
+
+// Return the size of the addressable memory.
+func (p Platform) MemorySize() uint32 {
+	if p == XOChip {
+		return 0x10000
+	}
+	return 0x1000
+}
+
+// Return the dimensions of the display in the low resolution mode.
+func (p Platform) LowResolutionSize() (int, int) {
+	if p == ETI660 {
+		return LowResolutionWidth, ETI660Height
+	}
+	return LowResolutionWidth, LowResolutionHeight
+}
+
+// Configuration of a processor.
+type Config struct {
+	Platform          Platform
+	Quirks            Quirks
+	MachineCallPolicy MachineCallPolicy
+	// Seed of the random number generator used by CXNN.
+	Seed int64
+	// Run frames by translating straight-line runs of code into
+	// cached closures instead of decoding every instruction.
+	JIT bool
+	// Blocks of the program compiled ahead of time, which run in
+	// place of the interpreter until their code is modified.
+	CompiledBlocks []CompiledBlock
+}
@@ -1,30 +1,6 @@
 package device
 
-import (
-	"fmt"
-	"math/rand"
-	"time"
-)
-
-// Convert an instruction to its character version.
-func getInstructionChar(instruction uint16) string {
-	return fmt.Sprintf("%04X", instruction)
-}
-
-// Get register index from its hexadecimal representation.
-func getRegisterIndex(hex byte) byte {
-	switch {
-	case '0' <= hex && hex <= '9':
-		return byte(hex) - 48
-	case 'a' <= hex && hex <= 'f':
-		return byte(hex) - 87
-	case 'A' <= hex && hex <= 'F':
-		return byte(hex) - 55
-	default:
-		return 128
-	}
-
-}
+import "crypto/sha256"
 
 // Main processor of the Chip-8
 type Processor struct {
@@ -33,60 +9,231 @@ type Processor struct {
 	display   *chip8Display
 	stack     *chip8Stack
 	keyboards *chip8Keyboard
+	flags     *chip8Flags
+	random    *chip8Random
+	platform  Platform
+	quirks    Quirks
+	// Set when the program exits.
+	halted bool
+	// Native routines called by 0NNN.
+	machineRoutines   map[uint16]MachineRoutine
+	machineCallPolicy MachineCallPolicy
+	// Set when the processor is waiting for the
+	// vertical blank to continue execution.
+	waitingForVBlank bool
+	vblankFrame      uint64
+	// The register FX0A stores the key in.
+	keyWaitRegister uint8
+	// Seed of the random number generator, kept for resets.
+	seed int64
+	// Set when frames run translated blocks of code.
+	jit bool
+	// Blocks compiled ahead of time, cached when their
+	// code is loaded.
+	compiledBlocks []CompiledBlock
+	// SHA-256 hash of the loaded program, save states
+	// are only loaded for the same program.
+	romHash [sha256.Size]byte
 }
 
-func NewProcessor(screenBuffer *[32]uint64, keyboardBuffer *uint16, soundBuffer *bool) *Processor {
-	rand.Seed(time.Now().Unix())
+func NewProcessor(screenBuffer *FrameBuffer, keyState *KeyState, soundBuffer *SoundBuffer, config Config) *Processor {
 	processor := new(Processor)
-	processor.display = newDisplay(screenBuffer)
+	processor.platform = config.Platform
+	processor.quirks = config.Quirks
+	processor.machineCallPolicy = config.MachineCallPolicy
+	processor.display = newDisplay(screenBuffer, config.Platform)
 	//log.Println("Display initialised.")
-	processor.memory = newMemory()
+	processor.jit = config.JIT
+	processor.compiledBlocks = config.CompiledBlocks
+	processor.memory = processor.newMemory()
 	//log.Println("Memory initialised.")
 	processor.registers = NewRegisters(soundBuffer)
 	//log.Println("Registers initialised.")
-	processor.keyboards = NewKeyboard(keyboardBuffer)
+	processor.keyboards = NewKeyboard(keyState)
 	//log.Println("Keyboard initialised.")
 	processor.stack = new(chip8Stack)
 	//log.Println("Stack initialised.")
-	go processor.registers.RegisterClockLoop()
-	//log.Println("Register clock loop started.")
+	processor.flags = new(chip8Flags)
+	processor.seed = config.Seed
+	processor.random = newRandom(config.Seed)
 	return processor
 }
 
+// Create the memory of the platform, which caches the translated
+// blocks of code if the JIT or compiled blocks are enabled.
+func (p *Processor) newMemory() *chip8Memory {
+	memory := newMemory(p.platform.MemorySize())
+	if p.jit || len(p.compiledBlocks) > 0 {
+		memory.blocks = newBlockCache(memory.Size())
+	}
+	return memory
+}
+
+// Reset the processor to its initial state, which also aborts a
+// pending key wait. The program has to be loaded again, native
+// routines and the flags path are kept.
+func (p *Processor) Reset() {
+	p.display = newDisplay(p.display.screenBuffer, p.platform)
+	p.memory = p.newMemory()
+	p.registers = NewRegisters(p.registers.soundBuffer)
+	p.keyboards = NewKeyboard(p.keyboards.keyState)
+	p.stack = new(chip8Stack)
+	p.random = newRandom(p.seed)
+	p.halted = false
+	p.waitingForVBlank = false
+}
+
 // Load a standard Chip-8 Program to the memory
 // And set the program counter accordingly.
-func (p *Processor) LoadProgram(program []byte, programSize uint16) {
+func (p *Processor) LoadProgram(program []byte, programSize uint16) error {
 	// Load the program.
-	p.memory.LoadProgram(program, programSize)
+	if err := p.memory.LoadProgram(program, programSize); err != nil {
+		return err
+	}
+	p.romHash = sha256.Sum256(program)
+	p.loadCompiledBlocks()
 	// Set the PC to standard start location.
-	p.registers.SetProgramCounter(0x198)
+	p.setStartLocation(RamStartLocation)
+	return nil
 }
 
 // Load an ETI program to the memory and set
 // the program counter accordingly.
-func (p *Processor) LoadETIProgram(program []byte, programSize uint16) {
-	p.memory.LoadETIProgram(program, programSize)
-	p.registers.SetProgramCounter(0x600)
+func (p *Processor) LoadETIProgram(program []byte, programSize uint16) error {
+	if err := p.memory.LoadETIProgram(program, programSize); err != nil {
+		return err
+	}
+	p.romHash = sha256.Sum256(program)
+	p.loadCompiledBlocks()
+	p.setStartLocation(ETI660StartLocation)
+	return nil
+}
+
+// Set the program counter so that the next cycle
+// executes the instruction at the start location.
+func (p *Processor) setStartLocation(startLocation uint16) {
+	// Cycle increments the PC before fetching.
+	p.registers.SetProgramCounter(startLocation - 2)
+}
+
+// Set the file the RPL user flags are persisted to.
+func (p *Processor) SetFlagsPath(path string) {
+	p.flags.SetPath(path)
 }
 
 // Fetch the current instruction.
-func (p *Processor) fetchInstruction() uint16 {
-	mostSignificantByte := p.memory.ReadMemory(p.registers.GetProgramCounter())
-	leastSignificantByte := p.memory.ReadMemory(p.registers.GetProgramCounter() + 1)
-	return uint16(mostSignificantByte)<<8 + uint16(leastSignificantByte)
+func (p *Processor) fetchInstruction() (uint16, error) {
+	mostSignificantByte, err := p.memory.ReadMemory(p.registers.GetProgramCounter())
+	if err != nil {
+		return 0, err
+	}
+	leastSignificantByte, err := p.memory.ReadMemory(p.registers.GetProgramCounter() + 1)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(mostSignificantByte)<<8 + uint16(leastSignificantByte), nil
 }
 
 // Returns true if the processor should halt.
 func (p *Processor) ShouldHalt() bool {
-	return p.registers.GetProgramCounter() >= 0xFFD
+	return p.halted || uint32(p.registers.GetProgramCounter()) >= p.memory.Size()-3
+}
+
+// Halt the execution until the next vertical blank.
+func (p *Processor) waitForVBlank() {
+	p.waitingForVBlank = true
+	p.vblankFrame = p.registers.GetFrameCount()
 }
 
-// Run a CPU Fetch/Execute cycle.
-func (p *Processor) Cycle() {
+// Returns true while DXYN waits for the vertical blank.
+func (p *Processor) IsWaitingForVBlank() bool {
+	return p.waitingForVBlank
+}
+
+// Returns true while FX0A waits for a key.
+func (p *Processor) IsWaitingForKey() bool {
+	return p.keyboards.IsWaitingForKey()
+}
+
+// Returns true while the processor waits for the vertical
+// blank or a key, the rest of the frame is then idle.
+func (p *Processor) IsWaiting() bool {
+	return p.waitingForVBlank || p.keyboards.IsWaitingForKey()
+}
+
+// Abort a pending FX0A key wait, leaving its register
+// unchanged, so that the processor can be shut down or
+// reset without waiting for input.
+func (p *Processor) CancelKeyWait() {
+	p.keyboards.CancelKeyWait()
+}
+
+// Decrement the delay and sound timers, this should be
+// called once every 60 Hz frame.
+func (p *Processor) TickTimers() {
+	p.registers.UpdateClockRegisters()
+}
+
+// Publish the display and the sound state of the frame.
+func (p *Processor) SyncBuffers() {
+	p.display.SyncBuffer()
+	p.registers.SyncBuffer()
+}
+
+// Run up to the given number of cycles, tick the timers once and
+// publish the frame, advancing the processor by a single 60 Hz
+// frame. The frame ends early if the processor halts, waits for
+// the vertical blank or waits for a key. Returns the number of
+// cycles that were run.
+func (p *Processor) StepFrame(cycles int) (int, error) {
+	var err error
+	i := 0
+	for i < cycles && !p.ShouldHalt() {
+		executed := 1
+		if p.memory.blocks != nil {
+			executed, err = p.runBlock(cycles - i)
+		} else {
+			err = p.Cycle()
+		}
+		i += executed
+		if err != nil || p.IsWaiting() {
+			break
+		}
+	}
+	p.TickTimers()
+	p.SyncBuffers()
+	return i, err
+}
+
+// Run a CPU Fetch/Execute cycle, faults are reported as one of
+// the ErrUnknownOpcode, ErrStackOverflow, ErrStackUnderflow,
+// ErrMemoryOutOfBounds or ErrUnhandledMachineCall errors.
+func (p *Processor) Cycle() error {
+	if p.waitingForVBlank {
+		if p.registers.GetFrameCount() == p.vblankFrame {
+			return nil
+		}
+		p.waitingForVBlank = false
+	}
+	if p.keyboards.IsWaitingForKey() {
+		key, ok := p.keyboards.PollKeyWait(p.quirks.KeyRelease)
+		if !ok {
+			return nil
+		}
+		p.registers.WriteRegister(p.keyWaitRegister, key)
+	}
 	//Increment the PC.
 	p.registers.IncrementProgramCounter()
+	programCounter := p.registers.GetProgramCounter()
 	// Fetch the instruction.
-	instruction := p.fetchInstruction()
-	// Execute the instruction
-	p.executeInstruction(instruction)
+	instruction, err := p.fetchInstruction()
+	if err == nil {
+		// Execute the instruction
+		err = p.execute(p.platform.Opcodes().Decode(instruction))
+	}
+	if f, ok := err.(fault); ok {
+		// Record where the fault occured.
+		f.setLocation(programCounter, instruction)
+	}
+	return err
 }
@@ -1,14 +1,411 @@
 package device
 
-import "testing"
-
-func TestGetRegisterIndex(t *testing.T) {
-	var testMap = map[byte]byte{'0': 0, '1': 1, '2': 2, '3': 3, '4': 4, '5': 5, '6': 6, '7': 7, '8': 8,
-		'9': 9, 'A': 10, 'B': 11, 'C': 12, 'D': 13, 'E': 14, 'F': 15,
-		'a': 10, 'b': 11, 'c': 12, 'd': 13, 'e': 14, 'f': 15}
-	for character, index := range testMap {
-		if index != getRegisterIndex(character) {
-			t.Fatalf("Register character %v returned invalid index %d.", character, index)
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ambertide/chip8/pkg/isa"
+)
+
+func TestPlatformOpcodes(t *testing.T) {
+	tests := []struct {
+		platform Platform
+		opcode   uint16
+		kind     isa.Kind
+	}{
+		{Chip8, 0x00C4, isa.ScrollDown},
+		{Chip8, 0x00D4, isa.MachineCall},
+		{XOChip, 0x00D4, isa.ScrollUp},
+		{SuperChip, 0xF000, isa.Invalid},
+		{XOChip, 0xF000, isa.LoadILong},
+		{ETI660, 0xF385, isa.LoadFlags},
+		{Chip8, 0x5121, isa.Invalid},
+	}
+	for _, test := range tests {
+		if kind := test.platform.Opcodes().Decode(test.opcode).Kind; kind != test.kind {
+			t.Fatalf("Opcode %04X on platform %d decoded to %v instead of %v.", test.opcode, test.platform, kind, test.kind)
+		}
+	}
+}
+
+// The buffers a test processor shares with the frontend.
+type testBuffers struct {
+	screen FrameBuffer
+	keys   KeyState
+	sound  SoundBuffer
+}
+
+// Create a processor with the configuration and load the given
+// program, at the start location of the platform.
+func newTestProcessor(config Config, program []byte) (*Processor, *testBuffers) {
+	buffers := new(testBuffers)
+	processor := NewProcessor(&buffers.screen, &buffers.keys, &buffers.sound, config)
+	if config.Platform == ETI660 {
+		processor.LoadETIProgram(program, uint16(len(program)))
+	} else {
+		processor.LoadProgram(program, uint16(len(program)))
+	}
+	return processor, buffers
+}
+
+// Run the processor until the whole program is executed.
+func runTestProgram(processor *Processor, program []byte) {
+	for processor.registers.GetProgramCounter() < RamStartLocation+uint16(len(program))-2 {
+		processor.Cycle()
+	}
+}
+
+func TestShiftQuirk(t *testing.T) {
+	// LD V0, 0x01; LD V1, 0x04; SHR V0, V1
+	program := []byte{0x60, 0x01, 0x61, 0x04, 0x80, 0x16}
+	for name, expected := range map[string]byte{"cowgod": 0x00, "vip": 0x02} {
+		processor, _ := newTestProcessor(Config{Quirks: QuirksPresets[name]}, program)
+		runTestProgram(processor, program)
+		if value := processor.registers.ReadRegister(0); value != expected {
+			t.Fatalf("Quirks profile %s shifted V0 to %02X, expected %02X.", name, value, expected)
+		}
+	}
+}
+
+func TestQuirks(t *testing.T) {
+	tests := []struct {
+		name    string
+		quirks  Quirks
+		program []byte
+		cycles  int
+		observe func(p *Processor) int
+		// Observed values without and with the quirk.
+		without int
+		with    int
+	}{
+		// LD I, 0x300; LD [I], V1
+		{"IncrementI", Quirks{IncrementI: true}, []byte{0xA3, 0x00, 0xF1, 0x55}, 2,
+			func(p *Processor) int { return int(p.ReadIRegister()) }, 0x300, 0x302},
+		// LD V0, 0x10; LD V2, 0x20; JP V0, 0x204
+		{"JumpVX", Quirks{JumpVX: true}, []byte{0x60, 0x10, 0x62, 0x20, 0xB2, 0x04}, 3,
+			func(p *Processor) int { return int(p.NextInstruction()) }, 0x214, 0x224},
+		// LD VF, 0x05; OR V0, V1
+		{"ResetVF", Quirks{ResetVF: true}, []byte{0x6F, 0x05, 0x80, 0x11}, 2,
+			func(p *Processor) int { return int(p.ReadRegister(0xF)) }, 0x05, 0x00},
+		// LD V0, 60; LD I, 0x208; DRW V0, V1, 1; JP 0x206; sprite
+		{"ClipSprites", Quirks{ClipSprites: true}, []byte{0x60, 0x3C, 0xA2, 0x08, 0xD0, 0x11, 0x12, 0x06, 0xFF}, 3,
+			func(p *Processor) int { frame := p.Frame(); return int(frame.Pixel(0, 0)) }, 1, 0},
+		// DRW V0, V0, 1; ADD V2, 0x01
+		{"DisplayWait", Quirks{DisplayWait: true}, []byte{0xD0, 0x01, 0x72, 0x01}, 2,
+			func(p *Processor) int { return int(p.ReadRegister(2)) }, 1, 0},
+	}
+	for _, test := range tests {
+		for _, enabled := range []bool{false, true} {
+			quirks, expected := Quirks{}, test.without
+			if enabled {
+				quirks, expected = test.quirks, test.with
+			}
+			processor, _ := newTestProcessor(Config{Quirks: quirks}, test.program)
+			for i := 0; i < test.cycles; i++ {
+				if err := processor.Cycle(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if value := test.observe(processor); value != expected {
+				t.Fatalf("Quirk %s enabled %t resulted in 0x%X, expected 0x%X.", test.name, enabled, value, expected)
+			}
+		}
+	}
+}
+
+func TestETIProgramStart(t *testing.T) {
+	// LD V0, 0x2A
+	program := []byte{0x60, 0x2A}
+	processor, buffers := newTestProcessor(Config{Platform: ETI660}, program)
+	processor.Cycle()
+	if value := processor.registers.ReadRegister(0); value != 0x2A {
+		t.Fatalf("First instruction of the ETI-660 program was not executed, V0 is %02X.", value)
+	}
+	if height := buffers.screen.Latest().Height; height != ETI660Height {
+		t.Fatalf("ETI-660 display has height %d, expected %d.", height, ETI660Height)
+	}
+}
+
+func TestMachineRoutine(t *testing.T) {
+	// SYS 0x123; SYS 0x456
+	program := []byte{0x01, 0x23, 0x04, 0x56}
+	processor, _ := newTestProcessor(Config{}, program)
+	processor.RegisterMachineRoutine(0x123, func(p *Processor) {
+		p.WriteRegister(3, 0x2A)
+	})
+	runTestProgram(processor, program)
+	if value := processor.ReadRegister(3); value != 0x2A {
+		t.Fatalf("Machine routine was not called, V3 is %02X.", value)
+	}
+}
+
+func TestMachineCallPolicies(t *testing.T) {
+	// SYS 0x123; LD V0, 0x01
+	program := []byte{0x01, 0x23, 0x60, 0x01}
+	tests := []struct {
+		policy MachineCallPolicy
+		logged bool
+		fault  bool
+	}{
+		{IgnoreMachineCalls, false, false},
+		{LogMachineCalls, true, false},
+		{FaultMachineCalls, false, true},
+	}
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+	for _, test := range tests {
+		output.Reset()
+		processor, _ := newTestProcessor(Config{MachineCallPolicy: test.policy}, program)
+		err := processor.Cycle()
+		if test.fault {
+			var unhandled *ErrUnhandledMachineCall
+			if !errors.As(err, &unhandled) || unhandled.PC != 0x200 || unhandled.Opcode != 0x0123 {
+				t.Fatalf("Machine call under the fault policy returned %v.", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Machine call under policy %d returned %v.", test.policy, err)
+		}
+		if logged := strings.Contains(output.String(), "call to 0x123 at 0x200"); logged != test.logged {
+			t.Fatalf("Machine call under policy %d was logged %v, expected %v.", test.policy, logged, test.logged)
+		}
+		runTestCycles(t, processor, 1)
+		if processor.ReadRegister(0) != 0x01 {
+			t.Fatalf("Processor did not continue after the machine call under policy %d.", test.policy)
+		}
+	}
+}
+
+func TestCycleErrors(t *testing.T) {
+	// Each program faults on its second instruction at 0x202.
+	programs := map[string][]byte{
+		"unknown opcode":  {0x60, 0x00, 0x80, 0x08},
+		"stack underflow": {0x60, 0x00, 0x00, 0xEE},
+		"out of bounds":   {0xAF, 0xFF, 0xF1, 0x65},
+	}
+	for name, program := range programs {
+		processor, _ := newTestProcessor(Config{}, program)
+		var err error
+		for i := 0; i < 2 && err == nil; i++ {
+			err = processor.Cycle()
+		}
+		var pc uint16
+		switch e := err.(type) {
+		case *ErrUnknownOpcode:
+			pc = e.PC
+		case *ErrStackUnderflow:
+			pc = e.PC
+		case *ErrMemoryOutOfBounds:
+			pc = e.PC
+		default:
+			t.Fatalf("Program with %s returned %v.", name, err)
+		}
+		if pc != 0x202 {
+			t.Fatalf("Program with %s faulted at 0x%03X, expected 0x202.", name, pc)
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	// CALL 0x200, which calls itself until the stack is full.
+	program := []byte{0x22, 0x00}
+	processor, _ := newTestProcessor(Config{}, program)
+	runTestCycles(t, processor, StackSize)
+	// The fault is returned as it is rather than wrapped.
+	err := processor.Cycle()
+	overflow, ok := err.(*ErrStackOverflow)
+	if !ok {
+		t.Fatalf("Call %d returned %v, expected a stack overflow.", StackSize+1, err)
+	}
+	if overflow.PC != 0x200 || overflow.Opcode != 0x2200 {
+		t.Fatalf("Stack overflowed with %+v.", overflow)
+	}
+}
+
+func TestRandomSeed(t *testing.T) {
+	// Fill V0 to VE with random bytes.
+	var program []byte
+	for i := 0; i < 15; i++ {
+		program = append(program, 0xC0|byte(i), 0xFF)
+	}
+	run := func(seed int64) [16]byte {
+		processor, _ := newTestProcessor(Config{Seed: seed}, program)
+		runTestProgram(processor, program)
+		return processor.registers.BlockReadRegisters()
+	}
+	if run(42) != run(42) {
+		t.Fatal("Processors with the same seed generated different numbers.")
+	}
+	if run(42) == run(43) {
+		t.Fatal("Processors with different seeds generated the same numbers.")
+	}
+}
+
+func TestStepFrameTimers(t *testing.T) {
+	// LD V0, 0x05; LD DT, V0; followed by a jump to itself.
+	program := []byte{0x60, 0x05, 0xF0, 0x15, 0x12, 0x04}
+	processor, _ := newTestProcessor(Config{}, program)
+	for i := 0; i < 3; i++ {
+		if _, err := processor.StepFrame(100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if value := processor.registers.delayTimer; value != 2 {
+		t.Fatalf("Delay timer is %d after three frames, expected 2.", value)
+	}
+}
+
+func TestFramePublishedOnce(t *testing.T) {
+	// LD I, 0x000 (the font of 0); DRW V0, V0, 5; followed by a jump to itself.
+	program := []byte{0xA0, 0x00, 0xD0, 0x05, 0x12, 0x04}
+	processor, buffers := newTestProcessor(Config{}, program)
+	done := make(chan struct{})
+	go func() {
+		// Read the frames concurrently, as the frontend would.
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = buffers.screen.Latest().Pixel(0, 0)
+			_ = buffers.sound.Latest()
+		}
+	}()
+	processor.Cycle()
+	processor.Cycle()
+	if buffers.screen.Latest().Pixel(0, 0) != 0 {
+		t.Fatal("Frame was published before it was complete.")
+	}
+	if _, err := processor.StepFrame(0); err != nil {
+		t.Fatal(err)
+	}
+	if buffers.screen.Latest().Pixel(0, 0) == 0 {
+		t.Fatal("Frame was not published at the end of the frame.")
+	}
+	<-done
+}
+
+func TestKeyWaitRelease(t *testing.T) {
+	// LD V1, 0x05; LD DT, V1; LD V0, K; followed by a jump to itself.
+	program := []byte{0x61, 0x05, 0xF1, 0x15, 0xF0, 0x0A, 0x12, 0x06}
+	processor, buffers := newTestProcessor(Config{Quirks: Quirks{KeyRelease: true}}, program)
+	stepFrame := func() {
+		if _, err := processor.StepFrame(10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stepFrame()
+	buffers.keys.Press(0xB)
+	stepFrame()
+	if !processor.IsWaitingForKey() {
+		t.Fatal("Key wait ended before the key was released.")
+	}
+	if value := processor.registers.delayTimer; value != 3 {
+		t.Fatalf("Delay timer is %d during the key wait, expected 3.", value)
+	}
+	buffers.keys.Release(0xB)
+	stepFrame()
+	if processor.IsWaitingForKey() {
+		t.Fatal("Key wait did not end after the key was released.")
+	}
+	if value := processor.ReadRegister(0); value != 0xB {
+		t.Fatalf("V0 is %X after the key wait, expected B.", value)
+	}
+}
+
+func TestSaveState(t *testing.T) {
+	// LD V0, 0x05; LD DT, V0; RND V1, 0xFF; followed by a jump to itself.
+	program := []byte{0x60, 0x05, 0xF0, 0x15, 0xC1, 0xFF, 0x12, 0x06}
+	processor, _ := newTestProcessor(Config{}, program)
+	processor.Cycle()
+	processor.Cycle()
+	var state bytes.Buffer
+	if err := processor.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	saved := state.Bytes()
+	processor.Cycle()
+	value := processor.ReadRegister(1)
+	if err := processor.LoadState(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	if processor.DelayTimer() != 0x05 || processor.ReadRegister(1) != 0 {
+		t.Fatal("Registers are not restored.")
+	}
+	processor.Cycle()
+	if processor.ReadRegister(1) != value {
+		t.Fatal("Random number generator is not restored.")
+	}
+	other, _ := newTestProcessor(Config{}, []byte{0x12, 0x00})
+	if err := other.LoadState(bytes.NewReader(saved)); err == nil {
+		t.Fatal("State of a different ROM was loaded.")
+	}
+	saved[len(saved)/2] ^= 0xFF
+	if err := processor.LoadState(bytes.NewReader(saved)); err == nil {
+		t.Fatal("Corrupt state was loaded.")
+	}
+}
+
+func TestStateDisplaySize(t *testing.T) {
+	processor, _ := newTestProcessor(Config{}, []byte{0x12, 0x00})
+	state := processor.MarshalState()
+	var record stateRecord
+	recordSize := binary.Size(record)
+	tests := []struct {
+		width, height uint16
+		hires         bool
+	}{
+		{0, 32, false},
+		{64, 0, false},
+		{64, 32, true},
+		{128, 64, false},
+		{64, 48, false},
+	}
+	for _, test := range tests {
+		binary.Read(bytes.NewReader(state), binary.LittleEndian, &record)
+		record.Width, record.Height, record.HighResolution = test.width, test.height, test.hires
+		var modified bytes.Buffer
+		binary.Write(&modified, binary.LittleEndian, &record)
+		modified.Write(state[recordSize:])
+		if err := processor.UnmarshalState(modified.Bytes()); err == nil {
+			t.Fatalf("State with a %dx%d display in high resolution %v was loaded.", test.width, test.height, test.hires)
+		}
+	}
+	if err := processor.UnmarshalState(state); err != nil {
+		t.Fatal(err)
+	}
+	eti, _ := newTestProcessor(Config{Platform: ETI660}, []byte{0x16, 0x00})
+	if err := eti.UnmarshalState(eti.MarshalState()); err != nil {
+		t.Fatalf("State of the 64x48 ETI-660 display was rejected with %v.", err)
+	}
+}
+
+func TestStepFrameDisplayWait(t *testing.T) {
+	// LD I, 0x000; DRW V0, V0, 1; ADD V1, 0x01; JP 0x202
+	program := []byte{0xA0, 0x00, 0xD0, 0x01, 0x71, 0x01, 0x12, 0x02}
+	for _, jit := range []bool{false, true} {
+		processor := newBenchmarkProcessor(Chip8, "vip", jit, program)
+		for frame := 1; frame <= 5; frame++ {
+			if _, err := processor.StepFrame(100); err != nil {
+				t.Fatal(err)
+			}
+			// Every frame draws once and runs up to the next draw.
+			if value := processor.ReadRegister(1); value != byte(frame-1) {
+				t.Fatalf("V1 is %d after frame %d with the JIT %v, expected one draw per frame.", value, frame, jit)
+			}
+		}
+	}
+}
+
+func TestPlatformNames(t *testing.T) {
+	for _, name := range []string{"chip8", "schip", "xochip", "eti660"} {
+		platform, err := PlatformByName(name)
+		if err != nil || platform.String() != name {
+			t.Fatalf("Platform %s is named %s.", name, platform)
 		}
 	}
 }
@@ -0,0 +1,72 @@
+package device
+
+import "fmt"
+
+// Quirks select between the conflicting interpretations
+// of the ambiguous instructions used by different
+// Chip-8 interpreters.
+type Quirks struct {
+	// 8XY6 and 8XYE shift VX in place instead of
+	// storing the shifted value of VY in VX.
+	ShiftVX bool
+	// FX55 and FX65 leave I pointing to the address
+	// after the last register stored or loaded.
+	IncrementI bool
+	// BNNN is interpreted as BXNN, jumping to XNN + VX
+	// instead of NNN + V0.
+	JumpVX bool
+	// 8XY1, 8XY2 and 8XY3 reset VF to zero.
+	ResetVF bool
+	// Sprites are clipped at the edges of the screen
+	// instead of wrapping around to the opposite side.
+	ClipSprites bool
+	// DXYN waits for the vertical blank interrupt, limiting
+	// the program to a single draw per frame.
+	DisplayWait bool
+	// FX0A waits for the key to be released after it
+	// is pressed instead of continuing on the press.
+	KeyRelease bool
+}
+
+// Named quirk profiles of well known interpreters.
+var QuirksPresets = map[string]Quirks{
+	// As described in Cowgod's Chip-8 Technical Reference.
+	"cowgod": {
+		ShiftVX: true,
+	},
+	// The original COSMAC VIP interpreter.
+	"vip": {
+		IncrementI:  true,
+		ResetVF:     true,
+		ClipSprites: true,
+		DisplayWait: true,
+		KeyRelease:  true,
+	},
+	// CHIP-48 for the HP-48 calculators.
+	"chip48": {
+		ShiftVX:     true,
+		IncrementI:  true,
+		JumpVX:      true,
+		ClipSprites: true,
+	},
+	// SUPER-CHIP 1.1 for the HP-48 calculators.
+	"schip": {
+		ShiftVX:     true,
+		JumpVX:      true,
+		ClipSprites: true,
+	},
+	// XO-CHIP as implemented by Octo.
+	"xochip": {
+		IncrementI: true,
+		KeyRelease: true,
+	},
+}
+
+// Return the quirks profile with the given name.
+func QuirksByName(name string) (Quirks, error) {
+	quirks, ok := QuirksPresets[name]
+	if !ok {
+		return Quirks{}, fmt.Errorf("unknown quirks profile %q", name)
+	}
+	return quirks, nil
+}
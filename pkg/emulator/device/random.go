@@ -0,0 +1,24 @@
+package device
+
+// A seedable SplitMix64 generator, each processor has its
+// own so that runs with the same seed are reproducible.
+type chip8Random struct {
+	state uint64
+}
+
+func newRandom(seed int64) *chip8Random {
+	random := new(chip8Random)
+	random.state = uint64(seed)
+	return random
+}
+
+// Return the next random byte in the full 0-255 range.
+func (r *chip8Random) NextByte() byte {
+	r.state += 0x9E3779B97F4A7C15
+	z := r.state
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	z ^= z >> 31
+	// The high bits have the best quality.
+	return byte(z >> 56)
+}
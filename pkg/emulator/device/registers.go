@@ -1,22 +1,18 @@
 package device
 
-import (
-	"time"
-)
-
-// This type of function is used to operate on register values.
-type OperationFunction func(byte, byte) byte
-
-// This type of function is used to determine VF.
-type CarryFunction func(byte, byte) byte
-
 type chip8Registers struct {
 	generalPurpose [16]byte
 	iRegister      uint16
 	programCounter uint16
 	delayTimer     byte
 	soundTimer     byte
-	soundBuffer    *bool
+	// Sound state of the current frame, published
+	// to the buffer once the frame is complete.
+	sound       Sound
+	soundBuffer *SoundBuffer
+	// Number of times the timers were updated, used
+	// to detect the vertical blank.
+	frameCount uint64
 }
 
 // Write to a general purpose register.
@@ -42,18 +38,11 @@ func (r *chip8Registers) AddRegisterImmediate(registerIndex uint8, value byte) {
 	r.generalPurpose[registerIndex] += value
 }
 
-// Given indexes of two registers, use their values in the operation function,
-// Store the return value in the register x. Carry function
-// is calculated BEFORE the operation and its result is stored in VF register.
-func (r *chip8Registers) RegisterOperationWithCarry(x uint8, y uint8, operation OperationFunction, carry CarryFunction) {
-	r.generalPurpose[15] = carry(r.generalPurpose[x], r.generalPurpose[y])
-	r.generalPurpose[x] = operation(r.generalPurpose[x], r.generalPurpose[y])
-}
-
-// Given indexes of two registers, use their values in the operation function,
-// Store the return value in the register x.
-func (r *chip8Registers) RegisterOperation(x uint8, y uint8, operation OperationFunction) {
-	r.generalPurpose[x] = operation(r.generalPurpose[x], r.generalPurpose[y])
+// Write the value to the register and set VF to the flag, VF
+// is set first so that VF holds the value if it is the register.
+func (r *chip8Registers) WriteRegisterWithFlag(registerIndex uint8, value byte, flag bool) {
+	r.SetCarry(flag)
+	r.generalPurpose[registerIndex] = value
 }
 
 // Set the program counter to a value.
@@ -100,7 +89,15 @@ func (r *chip8Registers) SetIDigitSprite(sourceRegister uint8) {
 	// Since characters consist of 5 bytes in their sprites,
 	// Just times 5 should work.
 	//log.Printf("Writing address %03X\n to I register.\n", uint16(characterIndex)*5)
-	r.WriteIRegister(uint16(characterIndex) * 5)
+	r.WriteIRegister(SmallFontLocation + uint16(characterIndex)*5)
+}
+
+// Set the value of I to the address of the large sprite
+// representing the digit stored in the source register.
+func (r *chip8Registers) SetILargeDigitSprite(sourceRegister uint8) {
+	characterIndex := r.ReadRegister(sourceRegister)
+	// Large characters consist of 10 bytes.
+	r.WriteIRegister(LargeFontLocation + uint16(characterIndex)*10)
 }
 
 // Set the carry register VF to 1 if value is true.
@@ -154,19 +151,70 @@ func (r *chip8Registers) UpdateClockRegisters() {
 	if r.delayTimer > 0 {
 		r.delayTimer--
 	}
-	*r.soundBuffer = r.soundTimer > 0
+	r.sound.Active = r.soundTimer > 0
+	r.frameCount++
+}
+
+// Publish the sound state of the frame.
+func (r *chip8Registers) SyncBuffer() {
+	r.soundBuffer.Publish(r.sound)
+}
+
+// Return the number of frames since the registers were initialised.
+func (r *chip8Registers) GetFrameCount() uint64 {
+	return r.frameCount
+}
+
+// Load the XO-CHIP audio pattern to the sound buffer.
+func (r *chip8Registers) SetAudioPattern(pattern []byte) {
+	copy(r.sound.Pattern[:], pattern)
+	r.sound.UsePattern = true
+}
+
+// Set the XO-CHIP pitch to the value of the source register.
+func (r *chip8Registers) SetPitch(sourceRegister uint8) {
+	r.sound.Pitch = r.ReadRegister(sourceRegister)
+}
+
+// Write an array of bytes to the registers x to y, in reverse
+// order if x is greater than y.
+func (r *chip8Registers) RangeWriteRegisters(x uint8, y uint8, registerData [16]byte) {
+	for i := 0; i < registerRangeLength(x, y); i++ {
+		r.generalPurpose[registerRangeIndex(x, y, i)] = registerData[i]
+	}
+}
+
+// Return the values of the registers x to y, in reverse
+// order if x is greater than y.
+func (r *chip8Registers) RangeReadRegisters(x uint8, y uint8) [16]byte {
+	var buffer [16]byte
+	for i := 0; i < registerRangeLength(x, y); i++ {
+		buffer[i] = r.generalPurpose[registerRangeIndex(x, y, i)]
+	}
+	return buffer
+}
+
+// Return the number of registers from x to y inclusive.
+func registerRangeLength(x uint8, y uint8) int {
+	if x <= y {
+		return int(y-x) + 1
+	}
+	return int(x-y) + 1
 }
 
-func (r *chip8Registers) RegisterClockLoop() {
-	for {
-		r.UpdateClockRegisters()
-		time.Sleep(time.Second / 60)
+// Return the index of the ith register from x to y.
+func registerRangeIndex(x uint8, y uint8, i int) uint8 {
+	if x <= y {
+		return x + uint8(i)
 	}
+	return x - uint8(i)
 }
 
 // Initialise a new register with a sound buffer.
-func NewRegisters(soundBuffer *bool) *chip8Registers {
+func NewRegisters(soundBuffer *SoundBuffer) *chip8Registers {
 	register := new(chip8Registers)
 	register.soundBuffer = soundBuffer
+	register.sound.Pitch = DefaultPitch
+	register.SyncBuffer()
 	return register
 }
@@ -0,0 +1,20 @@
+package device
+
+// Number of bytes in the XO-CHIP audio pattern buffer.
+const AudioPatternSize = 16
+
+// Default XO-CHIP pitch, which plays the pattern at 4000 Hz.
+const DefaultPitch = 64
+
+// State of the sound output shared with the audio routine.
+type Sound struct {
+	// True while the sound timer is active.
+	Active bool
+	// Set once the program loads an audio pattern, until
+	// then the default tone should be played instead.
+	UsePattern bool
+	// The 1-bit audio samples played in a loop.
+	Pattern [AudioPatternSize]byte
+	// The playback rate of the pattern.
+	Pitch byte
+}
@@ -1,22 +1,32 @@
 package device
 
+// Number of nested subroutine calls allowed.
+const StackSize = 16
+
 type chip8Stack struct {
 	// Although technically a register
 	// It fits here much better.
 	stackPointer uint16
 	// This is where the addresses are hold.
-	addresses [16]uint16
+	addresses [StackSize]uint16
 }
 
 // Pop an address from the stack.
-func (s *chip8Stack) Pop() uint16 {
+func (s *chip8Stack) Pop() (uint16, error) {
+	if s.stackPointer == 0 {
+		return 0, &ErrStackUnderflow{}
+	}
 	s.stackPointer--
 	stackValue := s.addresses[s.stackPointer]
-	return stackValue
+	return stackValue, nil
 }
 
 // Push an address to the stack.
-func (s *chip8Stack) Push(address uint16) {
+func (s *chip8Stack) Push(address uint16) error {
+	if s.stackPointer == StackSize {
+		return &ErrStackOverflow{}
+	}
 	s.addresses[s.stackPointer] = address
 	s.stackPointer++
+	return nil
 }
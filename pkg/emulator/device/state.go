@@ -0,0 +1,230 @@
+package device
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Save states are stored in the following format, all values
+// are little endian:
+//
+//	Magic       4 bytes, "C8ST"
+//	Version     uint16, StateVersion
+//	Platform    uint8
+//	ROM hash    32 bytes, SHA-256 of the loaded program
+//	Memory size uint32
+//	State       the fields of stateRecord in order
+//	Memory      memory size bytes, starting from address 0
+//	Checksum    uint32, CRC-32 (IEEE) of all the preceding bytes
+//
+// The version is incremented whenever the format changes.
+const (
+	StateMagic   = "C8ST"
+	StateVersion = 1
+)
+
+// Precedes the state in a save state.
+type stateHeader struct {
+	Magic      [4]byte
+	Version    uint16
+	Platform   Platform
+	ROMHash    [sha256.Size]byte
+	MemorySize uint32
+}
+
+// The state of the processor other than the memory.
+type stateRecord struct {
+	// Registers.
+	Registers    [16]byte
+	I            uint16
+	PC           uint16
+	DelayTimer   byte
+	SoundTimer   byte
+	SoundActive  bool
+	UsePattern   bool
+	AudioPattern [AudioPatternSize]byte
+	Pitch        byte
+	FrameCount   uint64
+	// Stack.
+	StackPointer uint16
+	Stack        [StackSize]uint16
+	// Display.
+	Width          uint16
+	Height         uint16
+	HighResolution bool
+	SelectedPlanes byte
+	Planes         [PlaneCount]Plane
+	// Execution state.
+	Halted           bool
+	WaitingForVBlank bool
+	VBlankFrame      uint64
+	WaitingForKey    bool
+	KeyPressed       bool
+	PressedKey       byte
+	KeyWaitRegister  byte
+	RandomState      uint64
+}
+
+// Returned when a save state cannot be loaded.
+type ErrInvalidState struct {
+	Reason string
+}
+
+func (e *ErrInvalidState) Error() string {
+	return "invalid save state: " + e.Reason
+}
+
+// Returned when a save state was made with a different ROM.
+type ErrStateROMMismatch struct{}
+
+func (e *ErrStateROMMismatch) Error() string {
+	return "save state was made with a different ROM"
+}
+
+// Return the SHA-256 hash of the loaded program.
+func (p *Processor) ROMHash() [sha256.Size]byte {
+	return p.romHash
+}
+
+// Return the complete state of the processor without the header,
+// the states of a processor all have the same size.
+func (p *Processor) MarshalState() []byte {
+	record := stateRecord{
+		Registers:        p.registers.generalPurpose,
+		I:                p.registers.iRegister,
+		PC:               p.registers.programCounter,
+		DelayTimer:       p.registers.delayTimer,
+		SoundTimer:       p.registers.soundTimer,
+		SoundActive:      p.registers.sound.Active,
+		UsePattern:       p.registers.sound.UsePattern,
+		AudioPattern:     p.registers.sound.Pattern,
+		Pitch:            p.registers.sound.Pitch,
+		FrameCount:       p.registers.frameCount,
+		StackPointer:     p.stack.stackPointer,
+		Stack:            p.stack.addresses,
+		Width:            uint16(p.display.screen.Width),
+		Height:           uint16(p.display.screen.Height),
+		HighResolution:   p.display.hires,
+		SelectedPlanes:   p.display.selectedPlanes,
+		Planes:           p.display.screen.Planes,
+		Halted:           p.halted,
+		WaitingForVBlank: p.waitingForVBlank,
+		VBlankFrame:      p.vblankFrame,
+		WaitingForKey:    p.keyboards.waiting,
+		KeyPressed:       p.keyboards.keyPressed,
+		PressedKey:       p.keyboards.pressedKey,
+		KeyWaitRegister:  p.keyWaitRegister,
+		RandomState:      p.random.state,
+	}
+	var buffer bytes.Buffer
+	buffer.Grow(binary.Size(record) + int(p.memory.size))
+	binary.Write(&buffer, binary.LittleEndian, &record)
+	buffer.Write(p.memory.reserved[:])
+	buffer.Write(p.memory.ram[:p.memory.size-RamStartLocation])
+	return buffer.Bytes()
+}
+
+// Restore a state returned by MarshalState and publish the display.
+func (p *Processor) UnmarshalState(state []byte) error {
+	var record stateRecord
+	recordSize := binary.Size(record)
+	if len(state) != recordSize+int(p.memory.size) {
+		return &ErrInvalidState{fmt.Sprintf("state is %d bytes, expected %d", len(state), recordSize+int(p.memory.size))}
+	}
+	binary.Read(bytes.NewReader(state[:recordSize]), binary.LittleEndian, &record)
+	if !record.isValid(p.platform) {
+		return &ErrInvalidState{"state is corrupt"}
+	}
+	p.registers.generalPurpose = record.Registers
+	p.registers.iRegister = record.I
+	p.registers.programCounter = record.PC
+	p.registers.delayTimer = record.DelayTimer
+	p.registers.soundTimer = record.SoundTimer
+	p.registers.sound = Sound{record.SoundActive, record.UsePattern, record.AudioPattern, record.Pitch}
+	p.registers.frameCount = record.FrameCount
+	p.stack.stackPointer = record.StackPointer
+	p.stack.addresses = record.Stack
+	p.display.screen = Frame{int(record.Width), int(record.Height), record.Planes}
+	p.display.hires = record.HighResolution
+	p.display.selectedPlanes = record.SelectedPlanes
+	p.halted = record.Halted
+	p.waitingForVBlank = record.WaitingForVBlank
+	p.vblankFrame = record.VBlankFrame
+	p.keyboards.waiting = record.WaitingForKey
+	p.keyboards.keyPressed = record.KeyPressed
+	p.keyboards.pressedKey = record.PressedKey
+	p.keyWaitRegister = record.KeyWaitRegister
+	p.random.state = record.RandomState
+	memory := state[recordSize:]
+	copy(p.memory.reserved[:], memory)
+	copy(p.memory.ram[:], memory[RamStartLocation:])
+	p.memory.invalidate(0, p.memory.size)
+	p.loadCompiledBlocks()
+	p.SyncBuffers()
+	return nil
+}
+
+// Returns false if any of the values of the record are impossible.
+func (r *stateRecord) isValid(platform Platform) bool {
+	// The display must have the size of its mode on the platform.
+	width, height := platform.LowResolutionSize()
+	if r.HighResolution {
+		width, height = HighResolutionWidth, HighResolutionHeight
+	}
+	return r.StackPointer <= StackSize && r.SelectedPlanes <= 0x3 &&
+		int(r.Width) == width && int(r.Height) == height &&
+		r.KeyWaitRegister <= 0xF && r.PressedKey <= 0xF
+}
+
+// Write the state of the processor as a save state.
+func (p *Processor) SaveState(w io.Writer) error {
+	header := stateHeader{
+		Version:    StateVersion,
+		Platform:   p.platform,
+		ROMHash:    p.romHash,
+		MemorySize: p.memory.size,
+	}
+	copy(header.Magic[:], StateMagic)
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, &header)
+	buffer.Write(p.MarshalState())
+	binary.Write(&buffer, binary.LittleEndian, crc32.ChecksumIEEE(buffer.Bytes()))
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+// Restore a save state written by SaveState, the state must
+// be made on the same platform with the same ROM loaded.
+func (p *Processor) LoadState(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var header stateHeader
+	headerSize := binary.Size(header)
+	if len(data) < headerSize+4 {
+		return &ErrInvalidState{"state is truncated"}
+	}
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &header)
+	if string(header.Magic[:]) != StateMagic {
+		return &ErrInvalidState{"not a save state"}
+	}
+	if header.Version != StateVersion {
+		return &ErrInvalidState{fmt.Sprintf("unsupported version %d", header.Version)}
+	}
+	checksum := binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(data[:len(data)-4]) != checksum {
+		return &ErrInvalidState{"checksum mismatch"}
+	}
+	if header.Platform != p.platform || header.MemorySize != p.memory.size {
+		return &ErrInvalidState{"state was made on a different platform"}
+	}
+	if header.ROMHash != p.romHash {
+		return &ErrStateROMMismatch{}
+	}
+	return p.UnmarshalState(data[headerSize : len(data)-4])
+}
@@ -0,0 +1,124 @@
+package device
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// Run the given number of cycles of the processor.
+func runTestCycles(t *testing.T, processor *Processor, cycles int) {
+	for i := 0; i < cycles; i++ {
+		if err := processor.Cycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Check the colours of the pixels of the display at the given coordinates.
+func checkPixels(t *testing.T, processor *Processor, step string, pixels map[[2]int]byte) {
+	frame := processor.Frame()
+	for position, colour := range pixels {
+		if actual := frame.Pixel(position[0], position[1]); actual != colour {
+			t.Fatalf("Pixel %v is %d after %s, expected %d.", position, actual, step, colour)
+		}
+	}
+}
+
+func TestSuperChipResolution(t *testing.T) {
+	// HIGH; DRW V0, V0, 1; LOW
+	program := []byte{0x00, 0xFF, 0xD0, 0x01, 0x00, 0xFE}
+	processor, _ := newTestProcessor(Config{Platform: SuperChip, Quirks: QuirksPresets["schip"]}, program)
+	runTestCycles(t, processor, 2)
+	if frame := processor.Frame(); frame.Width != HighResolutionWidth || frame.Height != HighResolutionHeight {
+		t.Fatalf("Display is %dx%d after HIGH.", frame.Width, frame.Height)
+	}
+	checkPixels(t, processor, "DRW", map[[2]int]byte{{0, 0}: 1})
+	runTestCycles(t, processor, 1)
+	if frame := processor.Frame(); frame.Width != LowResolutionWidth || frame.Height != LowResolutionHeight {
+		t.Fatalf("Display is %dx%d after LOW.", frame.Width, frame.Height)
+	}
+	checkPixels(t, processor, "LOW", map[[2]int]byte{{0, 0}: 0})
+}
+
+func TestSuperChipScroll(t *testing.T) {
+	// HIGH; LD I, 0x20E; DRW V0, V0, 1; SCD 3; SCR; SCL; SCL; sprite
+	program := []byte{0x00, 0xFF, 0xA2, 0x0E, 0xD0, 0x01, 0x00, 0xC3, 0x00, 0xFB, 0x00, 0xFC, 0x00, 0xFC, 0xFF}
+	processor, _ := newTestProcessor(Config{Platform: SuperChip, Quirks: QuirksPresets["schip"]}, program)
+	runTestCycles(t, processor, 3)
+	checkPixels(t, processor, "DRW", map[[2]int]byte{{0, 0}: 1, {7, 0}: 1, {8, 0}: 0})
+	runTestCycles(t, processor, 1)
+	checkPixels(t, processor, "SCD 3", map[[2]int]byte{{0, 0}: 0, {0, 3}: 1, {7, 3}: 1})
+	runTestCycles(t, processor, 1)
+	checkPixels(t, processor, "SCR", map[[2]int]byte{{3, 3}: 0, {4, 3}: 1, {11, 3}: 1, {12, 3}: 0})
+	runTestCycles(t, processor, 1)
+	checkPixels(t, processor, "SCL", map[[2]int]byte{{0, 3}: 1, {7, 3}: 1, {8, 3}: 0})
+	runTestCycles(t, processor, 1)
+	checkPixels(t, processor, "SCL off the screen", map[[2]int]byte{{0, 3}: 1, {3, 3}: 1, {4, 3}: 0})
+}
+
+func TestSuperChipExit(t *testing.T) {
+	// EXIT; LD V0, 0x01
+	program := []byte{0x00, 0xFD, 0x60, 0x01}
+	processor, _ := newTestProcessor(Config{Platform: SuperChip}, program)
+	if _, err := processor.StepFrame(10); err != nil {
+		t.Fatal(err)
+	}
+	if !processor.ShouldHalt() || processor.ReadRegister(0) != 0 || processor.ProgramCounter() != 0x200 {
+		t.Fatalf("Processor continued to 0x%03X after EXIT.", processor.ProgramCounter())
+	}
+}
+
+func TestSuperChipLargeSprite(t *testing.T) {
+	// HIGH; LD I, 0x20C; DRW V0, V0, 0; DRW V0, V0, 0; LD V1, 60; DRW V0, V1, 0;
+	// followed by a 16x16 sprite.
+	program := []byte{0x00, 0xFF, 0xA2, 0x0C, 0xD0, 0x00, 0xD0, 0x00, 0x61, 0x3C, 0xD0, 0x10}
+	for i := 0; i < 32; i++ {
+		program = append(program, 0xFF)
+	}
+	processor, _ := newTestProcessor(Config{Platform: SuperChip, Quirks: QuirksPresets["schip"]}, program)
+	runTestCycles(t, processor, 3)
+	checkPixels(t, processor, "DRW 16x16", map[[2]int]byte{{0, 0}: 1, {15, 15}: 1, {16, 0}: 0, {0, 16}: 0})
+	if value := processor.ReadRegister(0xF); value != 0 {
+		t.Fatalf("VF is %d after drawing without collisions.", value)
+	}
+	runTestCycles(t, processor, 1)
+	if value := processor.ReadRegister(0xF); value != 16 {
+		t.Fatalf("VF is %d after erasing 16 rows, expected 16.", value)
+	}
+	runTestCycles(t, processor, 2)
+	// Rows 60 to 63 are drawn and the other 12 are clipped.
+	if value := processor.ReadRegister(0xF); value != 12 {
+		t.Fatalf("VF is %d after clipping 12 rows, expected 12.", value)
+	}
+	checkPixels(t, processor, "DRW at the bottom", map[[2]int]byte{{0, 63}: 1, {0, 0}: 0})
+}
+
+func TestSuperChipLargeFont(t *testing.T) {
+	// LD V0, 0x03; LD HF, V0
+	program := []byte{0x60, 0x03, 0xF0, 0x30}
+	processor, _ := newTestProcessor(Config{Platform: SuperChip}, program)
+	runTestCycles(t, processor, 2)
+	if address := processor.ReadIRegister(); address != LargeFontLocation+30 {
+		t.Fatalf("I is 0x%03X after LD HF, V0, expected 0x%03X.", address, LargeFontLocation+30)
+	}
+	if row := processor.ReadMemory(processor.ReadIRegister() + 2); row != 0x03 {
+		t.Fatalf("Third row of the large 3 is %02X.", row)
+	}
+}
+
+func TestSuperChipFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.flags")
+	// LD V0, 0x01; LD V1, 0x02; LD R, V1
+	store := []byte{0x60, 0x01, 0x61, 0x02, 0xF1, 0x75}
+	processor, _ := newTestProcessor(Config{Platform: SuperChip}, store)
+	processor.SetFlagsPath(path)
+	runTestCycles(t, processor, 3)
+	// LD V1, R
+	load := []byte{0xF1, 0x85}
+	processor, _ = newTestProcessor(Config{Platform: SuperChip}, load)
+	processor.SetFlagsPath(path)
+	runTestCycles(t, processor, 1)
+	if processor.ReadRegister(0) != 0x01 || processor.ReadRegister(1) != 0x02 {
+		t.Fatalf("Flags loaded as %02X %02X from the file.", processor.ReadRegister(0), processor.ReadRegister(1))
+	}
+}
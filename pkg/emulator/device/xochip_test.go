@@ -0,0 +1,117 @@
+package device
+
+import "testing"
+
+// Create an XO-CHIP processor with the Octo quirks and load the program.
+func newXOChipTestProcessor(program []byte) (*Processor, *testBuffers) {
+	return newTestProcessor(Config{Platform: XOChip, Quirks: QuirksPresets["xochip"]}, program)
+}
+
+func TestXOChipRegisterRanges(t *testing.T) {
+	// LD V1, 0x01; LD V2, 0x02; LD V3, 0x03; LD I, 0x300; LD [I], V1-V3; LD V6-V4, [I]
+	program := []byte{0x61, 0x01, 0x62, 0x02, 0x63, 0x03, 0xA3, 0x00, 0x51, 0x32, 0x56, 0x43}
+	processor, _ := newXOChipTestProcessor(program)
+	runTestCycles(t, processor, 5)
+	for i, expected := range []byte{0x01, 0x02, 0x03} {
+		if value := processor.ReadMemory(0x300 + uint16(i)); value != expected {
+			t.Fatalf("Memory at 0x%03X is %02X after LD [I], V1-V3, expected %02X.", 0x300+i, value, expected)
+		}
+	}
+	runTestCycles(t, processor, 1)
+	if processor.ReadRegister(6) != 0x01 || processor.ReadRegister(5) != 0x02 || processor.ReadRegister(4) != 0x03 {
+		t.Fatal("LD V6-V4, [I] did not load the registers in reverse order.")
+	}
+	if address := processor.ReadIRegister(); address != 0x300 {
+		t.Fatalf("I is 0x%03X after the range instructions, expected it to be unchanged.", address)
+	}
+}
+
+func TestXOChipPlanes(t *testing.T) {
+	// LD I, 0x212; PLANE 2; DRW V0, V0, 1; PLANE 3; DRW V0, V0, 1; PLANE 1; CLS;
+	// LD V1, 0x01; JP 0x210; sprites
+	program := []byte{
+		0xA2, 0x12, 0xF2, 0x01, 0xD0, 0x01, 0xF3, 0x01, 0xD0, 0x01, 0xF1, 0x01,
+		0x00, 0xE0, 0x61, 0x01, 0x12, 0x10, 0x80, 0xC0,
+	}
+	processor, _ := newXOChipTestProcessor(program)
+	runTestCycles(t, processor, 3)
+	checkPixels(t, processor, "drawing to the second plane", map[[2]int]byte{{0, 0}: 2, {1, 0}: 0})
+	runTestCycles(t, processor, 2)
+	// The first plane gets 0x80 and the second one 0xC0, erasing (0, 0).
+	checkPixels(t, processor, "drawing to both planes", map[[2]int]byte{{0, 0}: 1, {1, 0}: 2})
+	if value := processor.ReadRegister(0xF); value != 1 {
+		t.Fatalf("VF is %d after a collision in the second plane, expected 1.", value)
+	}
+	runTestCycles(t, processor, 2)
+	checkPixels(t, processor, "clearing the first plane", map[[2]int]byte{{0, 0}: 0, {1, 0}: 2})
+}
+
+func TestXOChipHighResolutionCollision(t *testing.T) {
+	// HIGH; LD I, 0x20A; DRW V0, V0, 0; DRW V0, V0, 0; JP 0x208; followed by a 16x16 sprite.
+	program := []byte{0x00, 0xFF, 0xA2, 0x0A, 0xD0, 0x00, 0xD0, 0x00, 0x12, 0x08}
+	for i := 0; i < 32; i++ {
+		program = append(program, 0xFF)
+	}
+	processor, _ := newXOChipTestProcessor(program)
+	runTestCycles(t, processor, 4)
+	if value := processor.ReadRegister(0xF); value != 1 {
+		t.Fatalf("VF is %d after erasing 16 rows, expected 1.", value)
+	}
+}
+
+func TestXOChipLongLoad(t *testing.T) {
+	// LD I, LONG 0x1234; LD V0, 0x01; SE V0, 0x01; LD I, LONG 0x0300; LD V1, 0x05
+	program := []byte{0xF0, 0x00, 0x12, 0x34, 0x60, 0x01, 0x30, 0x01, 0xF0, 0x00, 0x03, 0x00, 0x61, 0x05}
+	processor, _ := newXOChipTestProcessor(program)
+	runTestCycles(t, processor, 2)
+	if address := processor.ReadIRegister(); address != 0x1234 || processor.ReadRegister(0) != 0x01 {
+		t.Fatalf("I is 0x%04X and V0 is %02X after LD I, LONG.", address, processor.ReadRegister(0))
+	}
+	runTestCycles(t, processor, 2)
+	if address := processor.ReadIRegister(); address != 0x1234 || processor.ReadRegister(1) != 0x05 {
+		t.Fatal("Skip did not pass over both words of LD I, LONG.")
+	}
+}
+
+func TestXOChipAudio(t *testing.T) {
+	// LD I, 0x20C; AUDIO; LD V0, 0x70; PITCH V0; LD ST, V0; JP 0x20A; pattern
+	program := []byte{0xA2, 0x0C, 0xF0, 0x02, 0x60, 0x70, 0xF0, 0x3A, 0xF0, 0x18, 0x12, 0x0A}
+	for i := 0; i < AudioPatternSize; i++ {
+		program = append(program, byte(i*17))
+	}
+	processor, buffers := newXOChipTestProcessor(program)
+	if _, err := processor.StepFrame(10); err != nil {
+		t.Fatal(err)
+	}
+	sound := buffers.sound.Latest()
+	if !sound.Active || !sound.UsePattern || sound.Pitch != 0x70 {
+		t.Fatalf("Sound is %+v after AUDIO and PITCH.", sound)
+	}
+	for i, sample := range sound.Pattern {
+		if sample != byte(i*17) {
+			t.Fatalf("Byte %d of the pattern is %02X, expected %02X.", i, sample, byte(i*17))
+		}
+	}
+}
+
+func TestXOChipMemory(t *testing.T) {
+	// LD V0, 0xAB; LD I, LONG 0xFFF0; LD [I], V0; LD I, LONG 0xFFFF; LD [I], V1
+	program := []byte{0x60, 0xAB, 0xF0, 0x00, 0xFF, 0xF0, 0xF0, 0x55, 0xF0, 0x00, 0xFF, 0xFF, 0xF1, 0x55}
+	processor, _ := newXOChipTestProcessor(program)
+	if size := processor.MemorySize(); size != 0x10000 {
+		t.Fatalf("Memory size is 0x%X, expected 0x10000.", size)
+	}
+	runTestCycles(t, processor, 3)
+	if value := processor.ReadMemory(0xFFF0); value != 0xAB {
+		t.Fatalf("Memory at 0xFFF0 is %02X, expected AB.", value)
+	}
+	runTestCycles(t, processor, 1)
+	if _, ok := processor.Cycle().(*ErrMemoryOutOfBounds); !ok {
+		t.Fatal("Storing past the end of the 64K memory did not fault.")
+	}
+	chip8, _ := newTestProcessor(Config{}, []byte{0xAF, 0xFF, 0xF1, 0x55})
+	runTestCycles(t, chip8, 1)
+	if _, ok := chip8.Cycle().(*ErrMemoryOutOfBounds); !ok {
+		t.Fatal("Storing past the end of the 4K memory did not fault.")
+	}
+}
@@ -1,57 +1,193 @@
 package emulator
 
 import (
+	"fmt"
+	"net"
 	"os"
-	"time"
+	"path/filepath"
+	"strings"
 
+	"github.com/ambertide/chip8/pkg/debug"
+	"github.com/ambertide/chip8/pkg/emulator/cosmac"
 	"github.com/ambertide/chip8/pkg/emulator/device"
 )
 
+// Options used to run the emulator.
+type Options struct {
+	// Speed of the processor in Hz.
+	ClockSpeed  uint64
+	ProgramPath string
+	// The program, read from the program path if nil, which is
+	// then only used to name the files stored next to the program.
+	Program []byte
+	Config  device.Config
+	// Paths to the COSMAC VIP monitor ROM and Chip-8 interpreter
+	// images, if set the program is run by the original interpreter
+	// on an emulated RCA 1802 instead of the processor.
+	VIPMonitorPath     string
+	VIPInterpreterPath string
+	// If set, the state is loaded from this file after the
+	// program, and saved to that file when the program exits.
+	LoadStatePath string
+	SaveStatePath string
+	// Number of seconds that can be rewound, zero disables rewinding.
+	RewindSeconds int
+	// If set, a GDB remote stub listens on this TCP address and
+	// the program starts paused until a debugger continues it.
+	GDBAddress string
+}
+
 type Emulator struct {
-	screenBuffer   [32]uint64
-	processor      *device.Processor
-	keyboardBuffer uint16
-	soundBuffer    bool
-	clockSpeed     uint64
-	programPath    string
+	screenBuffer device.FrameBuffer
+	processor    *device.Processor
+	vip          *cosmac.VIP
+	keyState     device.KeyState
+	soundBuffer  device.SoundBuffer
+	clockSpeed   uint64
+	programPath  string
+	program      []byte
+	platform     device.Platform
+	controls     *Controls
+	// Snapshots of the past frames, nil if rewinding is disabled.
+	rewind *RewindBuffer
+	// Paths of the save states given in the options.
+	loadStatePath string
+	saveStatePath string
+	// Runs the processor while debugging, nil otherwise.
+	debugger    *debug.Debugger
+	gdbAddress  string
+	gdbListener net.Listener
+	// Closed when the program faults.
+	faulted chan struct{}
+	// Closed when the window is closed.
+	stop chan struct{}
+	// Closed when the emulator goroutine returns.
+	exited chan struct{}
 }
 
-func NewEmulator(clockSpeed uint64, programPath string) *Emulator {
+// Create an emulator for the options, returns an error if the
+// images of the COSMAC VIP could not be loaded.
+func NewEmulator(options Options) (*Emulator, error) {
 	emulator := new(Emulator)
-	emulator.clockSpeed = clockSpeed
-	emulator.programPath = programPath
-	emulator.processor = device.NewProcessor(&emulator.screenBuffer, &emulator.keyboardBuffer, &emulator.soundBuffer)
-	return emulator
+	emulator.clockSpeed = options.ClockSpeed
+	emulator.programPath = options.ProgramPath
+	emulator.program = options.Program
+	emulator.platform = options.Config.Platform
+	emulator.controls = NewControls()
+	// Rewinding would run behind the back of the debugger.
+	if options.RewindSeconds > 0 && options.VIPMonitorPath == "" && options.GDBAddress == "" {
+		emulator.rewind = NewRewindBuffer(options.RewindSeconds * FrameRate)
+	}
+	emulator.loadStatePath = options.LoadStatePath
+	emulator.saveStatePath = options.SaveStatePath
+	emulator.gdbAddress = options.GDBAddress
+	emulator.faulted = make(chan struct{})
+	emulator.stop = make(chan struct{})
+	emulator.exited = make(chan struct{})
+	if options.VIPMonitorPath != "" {
+		vip, err := newVIP(&emulator.screenBuffer, &emulator.keyState, &emulator.soundBuffer, options)
+		if err != nil {
+			return nil, err
+		}
+		emulator.vip = vip
+	} else {
+		emulator.processor = device.NewProcessor(&emulator.screenBuffer, &emulator.keyState, &emulator.soundBuffer, options.Config)
+	}
+	return emulator, nil
+}
+
+// Return the program given in the options or read it from its path.
+func (e *Emulator) readProgram() ([]byte, error) {
+	if e.program != nil {
+		return e.program, nil
+	}
+	return os.ReadFile(e.programPath)
+}
+
+// Load the program into the processor or the VIP.
+func (e *Emulator) loadProgram(program []byte) error {
+	if e.vip != nil {
+		return e.vip.LoadProgram(program)
+	}
+	return loadROM(e.processor, e.platform, program)
+}
+
+// Return the machine to be run by the scheduler.
+func (e *Emulator) core() pausableCore {
+	if e.vip != nil {
+		return vipCore{e.vip}
+	}
+	return controlledCore{e}
+}
+
+// Load the program, and the state if one is given.
+func (e *Emulator) start(program []byte) error {
+	if err := e.loadProgram(program); err != nil {
+		return fmt.Errorf("%s: %w", e.programPath, err)
+	}
+	if e.loadStatePath != "" {
+		if err := e.loadState(e.loadStatePath); err != nil {
+			return err
+		}
+	}
+	if e.rewind != nil {
+		e.rewind.Push(e.processor.MarshalState())
+	}
+	if e.gdbAddress != "" {
+		return e.startGDB()
+	}
+	return nil
 }
 
-func (e *Emulator) RunEmulator(program []byte, programSize uint16) {
-	e.processor.LoadProgram(program, programSize)
-	for !e.processor.ShouldHalt() {
-		e.processor.Cycle()
-		time.Sleep(time.Second / time.Duration(e.clockSpeed))
+// Save the state if requested once the program exits.
+func (e *Emulator) exit() error {
+	if e.saveStatePath != "" {
+		return e.saveState(e.saveStatePath)
 	}
+	return nil
 }
 
-func (emulator *Emulator) emulatorCode() {
+func (emulator *Emulator) emulatorCode() error {
 	romPath := emulator.programPath
-	file, err := os.Open(romPath)
+	program, err := emulator.readProgram()
 	if err != nil {
-		panic(err)
+		return err
 	}
-	var program [0xFFF]byte // Maximum ROM size.
-	programSize, err := file.Read(program[:])
-	if err != nil {
-		panic(err)
+	if emulator.processor != nil {
+		// RPL user flags are persisted next to the ROM.
+		emulator.processor.SetFlagsPath(strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".rpl")
+	}
+	if err := emulator.start(program); err != nil {
+		return err
 	}
-	emulator.RunEmulator(program[:], uint16(programSize))
+	defer emulator.stopGDB()
+	if err := NewScheduler(emulator.core(), emulator.clockSpeed).Run(emulator.stop); err != nil {
+		return fmt.Errorf("%s: %w", romPath, err)
+	}
+	return emulator.exit()
 }
 
-// Run the emulator subroutines.
-func RunEmulator(clockSpeed uint64, programPath string) {
-	e := NewEmulator(clockSpeed, programPath)
+// Run the emulator subroutines with the given frontends, the
+// renderer is run on the calling goroutine. Returns an error if
+// the program could not be loaded or the processor faulted.
+func RunEmulator(options Options, renderer Renderer, audio Audio) error {
+	e, err := NewEmulator(options)
+	if err != nil {
+		return err
+	}
 	//log.Println("Emulator initialised.")
-	go e.emulatorCode()
-	go BeepRoutine(&e.soundBuffer)
+	var emulatorErr error
+	go func() {
+		defer close(e.exited)
+		if emulatorErr = e.emulatorCode(); emulatorErr != nil {
+			close(e.faulted)
+		}
+	}()
+	go audio.Run(&e.soundBuffer, e.stop)
 	//log.Println("Emulator goroutine dispatched.")
-	RunGraphics(&e.screenBuffer, &e.keyboardBuffer)
+	renderer.Run(&e.screenBuffer, &e.keyState, e.controls, e.faulted)
+	close(e.stop)
+	// Wait for the state to be saved on exit.
+	<-e.exited
+	return emulatorErr
 }
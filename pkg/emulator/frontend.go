@@ -0,0 +1,75 @@
+package emulator
+
+import (
+	"image/color"
+	"sync/atomic"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+// Colours of the pixels depending on the planes they are
+// lit in, the first plane is drawn white.
+var PixelColours = [4]color.Color{
+	color.Black,
+	color.White,
+	color.RGBA{255, 102, 0, 255},
+	color.RGBA{102, 102, 102, 255},
+}
+
+// Commands sent by the frontends to the emulator.
+type Command int
+
+const (
+	// Save the state next to the ROM.
+	QuickSave Command = iota
+	// Load the state saved next to the ROM.
+	QuickLoad
+)
+
+// Carries the commands of the frontend to the emulator,
+// which handles them between frames.
+type Controls struct {
+	commands chan Command
+	// Non-zero while time runs backwards.
+	rewinding int32
+}
+
+func NewControls() *Controls {
+	controls := new(Controls)
+	controls.commands = make(chan Command, 8)
+	return controls
+}
+
+// Send a command, which is dropped if too many are pending.
+func (c *Controls) Send(command Command) {
+	select {
+	case c.commands <- command:
+	default:
+	}
+}
+
+// Start or stop running time backwards.
+func (c *Controls) SetRewinding(rewinding bool) {
+	var value int32
+	if rewinding {
+		value = 1
+	}
+	atomic.StoreInt32(&c.rewinding, value)
+}
+
+// Returns true while time runs backwards.
+func (c *Controls) Rewinding() bool {
+	return atomic.LoadInt32(&c.rewinding) != 0
+}
+
+// Displays the published frames and reports the pressed keys.
+type Renderer interface {
+	// Run until the user quits or stop is closed.
+	Run(screenBuffer *device.FrameBuffer, keyState *device.KeyState, controls *Controls, stop <-chan struct{})
+}
+
+// Plays the published sound state.
+type Audio interface {
+	// Run until stop is closed.
+	Run(soundBuffer *device.SoundBuffer, stop <-chan struct{})
+}
@@ -0,0 +1,36 @@
+package emulator
+
+import (
+	"errors"
+	"log"
+	"net"
+
+	"github.com/ambertide/chip8/pkg/debug"
+)
+
+// Returned when debugging is requested on the COSMAC VIP.
+var errVIPDebug = errors.New("the debugger does not support the vip platform")
+
+// Run the processor through a debugger and serve it to GDB clients,
+// the program stays paused until a client continues it.
+func (e *Emulator) startGDB() error {
+	if e.vip != nil {
+		return errVIPDebug
+	}
+	listener, err := net.Listen("tcp", e.gdbAddress)
+	if err != nil {
+		return err
+	}
+	e.gdbListener = listener
+	e.debugger = debug.NewDebugger(e.processor)
+	log.Printf("Waiting for GDB on %s.", listener.Addr())
+	go debug.NewGDBServer(e.debugger).Serve(listener)
+	return nil
+}
+
+// Stop accepting GDB clients.
+func (e *Emulator) stopGDB() {
+	if e.gdbListener != nil {
+		e.gdbListener.Close()
+	}
+}
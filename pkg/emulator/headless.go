@@ -0,0 +1,170 @@
+package emulator
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+// Options used to run the emulator without a window.
+type HeadlessOptions struct {
+	// Stop after this many frames or cycles, whichever comes
+	// first, zero means no limit. Cycles are ignored by the VIP.
+	Frames uint64
+	Cycles uint64
+	// Scripted key presses, sorted by frame.
+	Keys []KeyEvent
+	// Paths the final frame is written to as a PNG
+	// image and as ASCII art, ignored if empty.
+	PNGPath   string
+	ASCIIPath string
+}
+
+// Sets the pressed keys from the start of a frame.
+type KeyEvent struct {
+	Frame uint64
+	Mask  uint16
+}
+
+// Parse a key script of comma separated frame:keys pairs, where
+// keys are the hexadecimal keys held from that frame on, for
+// instance "10:5,12:,30:AB" holds 5 from frame 10, releases
+// it at frame 12 and holds A and B from frame 30.
+func ParseKeyScript(script string) ([]KeyEvent, error) {
+	var events []KeyEvent
+	if script == "" {
+		return events, nil
+	}
+	for _, entry := range strings.Split(script, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("key script entry %q is not frame:keys", entry)
+		}
+		frame, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("key script entry %q has an invalid frame", entry)
+		}
+		var mask uint16
+		for _, key := range parts[1] {
+			value, err := strconv.ParseUint(string(key), 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("key script entry %q has an invalid key %q", entry, key)
+			}
+			mask |= 1 << value
+		}
+		events = append(events, KeyEvent{frame, mask})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Frame < events[j].Frame })
+	return events, nil
+}
+
+// Run the program without a window or sound as fast as possible
+// and write the final frame, returns an error if the program could
+// not be loaded or the processor faulted.
+func RunHeadless(options Options, headless HeadlessOptions) error {
+	// Headless runs cannot be rewound.
+	options.RewindSeconds = 0
+	e, err := NewEmulator(options)
+	if err != nil {
+		return err
+	}
+	program, err := e.readProgram()
+	if err != nil {
+		return err
+	}
+	if err := e.start(program); err != nil {
+		return err
+	}
+	defer e.stopGDB()
+	core := e.core()
+	scheduler := NewScheduler(core, e.clockSpeed)
+	keys := headless.Keys
+	remainingCycles := headless.Cycles
+	var runErr error
+	for frame := uint64(0); !core.ShouldHalt(); {
+		if headless.Frames != 0 && frame >= headless.Frames {
+			break
+		}
+		for len(keys) > 0 && keys[0].Frame <= frame {
+			e.keyState.Set(keys[0].Mask)
+			keys = keys[1:]
+		}
+		cycles := uint64(scheduler.cyclesOfFrame())
+		if headless.Cycles != 0 && e.vip == nil {
+			if remainingCycles == 0 {
+				break
+			}
+			if cycles > remainingCycles {
+				cycles = remainingCycles
+			}
+		}
+		executed, ran, err := core.stepFrameUnlessPaused(int(cycles))
+		if headless.Cycles != 0 && e.vip == nil {
+			// Frames ended early by a wait only use the cycles they ran.
+			remainingCycles -= uint64(executed)
+		}
+		if err != nil {
+			runErr = fmt.Errorf("%s: frame %d: %w", options.ProgramPath, frame, err)
+			break
+		}
+		if ran {
+			// Frames held paused in the debugger are not counted.
+			frame++
+		}
+	}
+	// The frame is written even if the processor faulted.
+	frame := e.screenBuffer.Latest()
+	if err := writeFile(headless.PNGPath, frame, WriteFramePNG); err != nil {
+		return err
+	}
+	if err := writeFile(headless.ASCIIPath, frame, WriteFrameASCII); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return runErr
+	}
+	return e.exit()
+}
+
+// Write the frame to the file at the path using the encoder,
+// does nothing if the path is empty.
+func writeFile(path string, frame *device.Frame, encode func(io.Writer, *device.Frame) error) error {
+	if path == "" {
+		return nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := encode(file, frame); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Write the frame as a PNG image, a pixel for each pixel.
+func WriteFramePNG(w io.Writer, frame *device.Frame) error {
+	palette := make(color.Palette, len(PixelColours))
+	copy(palette, PixelColours[:])
+	img := image.NewPaletted(image.Rect(0, 0, frame.Width, frame.Height), palette)
+	for y := 0; y < frame.Height; y++ {
+		for x := 0; x < frame.Width; x++ {
+			img.SetColorIndex(x, y, frame.Pixel(x, y))
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// Write the frame as ASCII art, a line for each row.
+func WriteFrameASCII(w io.Writer, frame *device.Frame) error {
+	return frame.WriteASCII(w)
+}
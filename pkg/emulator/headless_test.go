@@ -0,0 +1,147 @@
+package emulator
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ambertide/chip8/pkg/emulator/cosmac"
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+func TestParseKeyScript(t *testing.T) {
+	keys, err := ParseKeyScript("30:AB,10:5,12:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []KeyEvent{{10, 0x20}, {12, 0}, {30, 0xC00}}
+	if len(keys) != len(expected) {
+		t.Fatalf("Parsed %d key events, expected %d.", len(keys), len(expected))
+	}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Fatalf("Key event %d is %v, expected %v.", i, keys[i], expected[i])
+		}
+	}
+	if _, err := ParseKeyScript("10:G"); err == nil {
+		t.Fatal("Invalid key was parsed.")
+	}
+}
+
+func TestWriteFrameASCII(t *testing.T) {
+	frame := device.Frame{Width: 4, Height: 2}
+	frame.Planes[0][0][0] = 0x9 << 60
+	frame.Planes[1][1][0] = 0x1 << 63
+	var buffer bytes.Buffer
+	if err := WriteFrameASCII(&buffer, &frame); err != nil {
+		t.Fatal(err)
+	}
+	if text := buffer.String(); text != "#..#\n+...\n" {
+		t.Fatalf("Frame is written as %q.", text)
+	}
+}
+
+func TestHeadlessSaveState(t *testing.T) {
+	directory := t.TempDir()
+	romPath := filepath.Join(directory, "rom.ch8")
+	otherPath := filepath.Join(directory, "other.ch8")
+	statePath := filepath.Join(directory, "rom.state")
+	// LD V0, 0x05; LD DT, V0; followed by a jump to itself.
+	os.WriteFile(romPath, []byte{0x60, 0x05, 0xF0, 0x15, 0x12, 0x04}, 0644)
+	os.WriteFile(otherPath, []byte{0x12, 0x00}, 0644)
+	options := Options{ClockSpeed: 600, ProgramPath: romPath, SaveStatePath: statePath}
+	if err := RunHeadless(options, HeadlessOptions{Frames: 2}); err != nil {
+		t.Fatal(err)
+	}
+	options = Options{ClockSpeed: 600, ProgramPath: romPath, LoadStatePath: statePath}
+	if err := RunHeadless(options, HeadlessOptions{Frames: 1}); err != nil {
+		t.Fatal(err)
+	}
+	options.ProgramPath = otherPath
+	var mismatch *device.ErrStateROMMismatch
+	if err := RunHeadless(options, HeadlessOptions{Frames: 1}); !errors.As(err, &mismatch) {
+		t.Fatalf("Loading the state of another ROM returned %v.", err)
+	}
+}
+
+func TestHeadlessSlowClock(t *testing.T) {
+	directory := t.TempDir()
+	romPath := filepath.Join(directory, "rom.ch8")
+	statePath := filepath.Join(directory, "rom.state")
+	// ADD V0, 0x01; JP 0x200; counts the cycles in V0.
+	rom := []byte{0x70, 0x01, 0x12, 0x00}
+	os.WriteFile(romPath, rom, 0644)
+	// Every other frame runs no cycles at 30 Hz, and is still counted.
+	options := Options{ClockSpeed: 30, ProgramPath: romPath, SaveStatePath: statePath}
+	if err := RunHeadless(options, HeadlessOptions{Frames: 60}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := os.Open(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+	var screenBuffer device.FrameBuffer
+	var keyState device.KeyState
+	var soundBuffer device.SoundBuffer
+	processor := device.NewProcessor(&screenBuffer, &keyState, &soundBuffer, device.Config{})
+	if err := processor.LoadProgram(rom, uint16(len(rom))); err != nil {
+		t.Fatal(err)
+	}
+	if err := processor.LoadState(state); err != nil {
+		t.Fatal(err)
+	}
+	if added := processor.ReadRegister(0); added != 15 {
+		t.Fatalf("V0 was added to %d times in 60 frames, expected 15.", added)
+	}
+}
+
+func TestRunHeadless(t *testing.T) {
+	directory := t.TempDir()
+	romPath := filepath.Join(directory, "rom.ch8")
+	asciiPath := filepath.Join(directory, "rom.txt")
+	// LD I, 0x000; LD V0, K; DRW V1, V1, 1; JP 0x206; waits for the key 5
+	// pressed at frame 5 and draws the top of the 0.
+	os.WriteFile(romPath, []byte{0xA0, 0x00, 0xF0, 0x0A, 0xD1, 0x11, 0x12, 0x06}, 0644)
+	options := Options{ClockSpeed: 600, ProgramPath: romPath}
+	keys := []KeyEvent{{5, 0x20}, {6, 0}}
+	// The frames waiting for the key only use the cycles they ran.
+	if err := RunHeadless(options, HeadlessOptions{Cycles: 20, Keys: keys, ASCIIPath: asciiPath}); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := os.ReadFile(asciiPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(frame, []byte("####....")) {
+		t.Fatalf("First row of the frame is %q, expected the top of the 0.", bytes.SplitN(frame, []byte("\n"), 2)[0])
+	}
+	// LD I, 0x000; DRW V1, V1, 1; followed by an unknown opcode.
+	os.WriteFile(romPath, []byte{0xA0, 0x00, 0xD1, 0x11, 0xFF, 0xFF}, 0644)
+	var unknown *device.ErrUnknownOpcode
+	if err := RunHeadless(options, HeadlessOptions{Frames: 10, ASCIIPath: asciiPath}); !errors.As(err, &unknown) {
+		t.Fatalf("Headless run of a faulting ROM returned %v.", err)
+	}
+	if frame, _ := os.ReadFile(asciiPath); !bytes.HasPrefix(frame, []byte("####....")) {
+		t.Fatal("Frame was not written after the fault.")
+	}
+}
+
+func TestHeadlessVIPImages(t *testing.T) {
+	directory := t.TempDir()
+	romPath := filepath.Join(directory, "rom.ch8")
+	monitorPath := filepath.Join(directory, "monitor.bin")
+	os.WriteFile(romPath, []byte{0x12, 0x00}, 0644)
+	os.WriteFile(monitorPath, make([]byte, cosmac.MonitorSize+1), 0644)
+	options := Options{ProgramPath: romPath, VIPMonitorPath: filepath.Join(directory, "missing.bin"), VIPInterpreterPath: romPath}
+	if err := RunHeadless(options, HeadlessOptions{Frames: 1}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Missing monitor image returned %v.", err)
+	}
+	options.VIPMonitorPath = monitorPath
+	if err := RunHeadless(options, HeadlessOptions{Frames: 1}); err == nil || !strings.HasPrefix(err.Error(), monitorPath+": ") {
+		t.Fatalf("Oversized monitor image returned %v.", err)
+	}
+}
@@ -0,0 +1,169 @@
+package emulator
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+// A Chip-8 machine to be embedded in other programs, it is stepped
+// by the caller and never starts any goroutines of its own.
+type Machine struct {
+	processor    *device.Processor
+	scheduler    *Scheduler
+	screenBuffer device.FrameBuffer
+	keyState     device.KeyState
+	soundBuffer  device.SoundBuffer
+	platform     device.Platform
+	rom          []byte
+}
+
+// Create a new machine with the configuration, running
+// at the clock speed in Hz when stepped a frame at a time.
+func NewMachine(config device.Config, clockSpeed uint64) *Machine {
+	machine := new(Machine)
+	machine.platform = config.Platform
+	machine.processor = device.NewProcessor(&machine.screenBuffer, &machine.keyState, &machine.soundBuffer, config)
+	machine.scheduler = NewScheduler(machine.processor, clockSpeed)
+	return machine
+}
+
+// Load the ROM and reset the machine to run it.
+func (m *Machine) LoadROM(rom []byte) error {
+	m.rom = append([]byte(nil), rom...)
+	return m.Reset()
+}
+
+// Reset the machine and load the ROM again.
+func (m *Machine) Reset() error {
+	m.processor.Reset()
+	return loadROM(m.processor, m.platform, m.rom)
+}
+
+// Load the ROM at the start location of the platform, returns an
+// error if it does not fit between there and the end of the memory.
+func loadROM(processor *device.Processor, platform device.Platform, rom []byte) error {
+	start := device.RamStartLocation
+	if platform == device.ETI660 {
+		start = device.ETI660StartLocation
+	}
+	if room := int(platform.MemorySize()) - start; len(rom) > room {
+		return fmt.Errorf("program is %d bytes, only %d bytes fit from 0x%03X on the %s platform", len(rom), room, start, platform)
+	}
+	if platform == device.ETI660 {
+		return processor.LoadETIProgram(rom, uint16(len(rom)))
+	}
+	return processor.LoadProgram(rom, uint16(len(rom)))
+}
+
+// Execute a single instruction, the timers are not ticked.
+func (m *Machine) Step() error {
+	if m.processor.ShouldHalt() {
+		return nil
+	}
+	return m.processor.Cycle()
+}
+
+// Execute the instructions of a single 60 Hz frame and tick the timers.
+func (m *Machine) StepFrame() error {
+	if m.processor.ShouldHalt() {
+		return nil
+	}
+	return m.scheduler.StepFrame()
+}
+
+// Returns true once the program has exited.
+func (m *Machine) Halted() bool {
+	return m.processor.ShouldHalt()
+}
+
+// Set the pressed keys, where bit N is set if key N is pressed.
+func (m *Machine) SetKeys(mask uint16) {
+	m.keyState.Set(mask)
+}
+
+// Return a copy of the display.
+func (m *Machine) Framebuffer() device.Frame {
+	return m.processor.Frame()
+}
+
+// Returns true while the sound timer is active.
+func (m *Machine) SoundActive() bool {
+	return m.processor.SoundTimer() > 0
+}
+
+// Return the value of the register VX.
+func (m *Machine) V(x uint8) byte {
+	return m.processor.ReadRegister(x)
+}
+
+// Return the values of the registers V0 to VF.
+func (m *Machine) Registers() [16]byte {
+	var registers [16]byte
+	for i := range registers {
+		registers[i] = m.processor.ReadRegister(uint8(i))
+	}
+	return registers
+}
+
+// Return the value of the I register.
+func (m *Machine) I() uint16 {
+	return m.processor.ReadIRegister()
+}
+
+// Return the address of the next instruction.
+func (m *Machine) PC() uint16 {
+	// The processor increments the PC before fetching.
+	return m.processor.ProgramCounter() + 2
+}
+
+// Return the number of addresses on the stack.
+func (m *Machine) SP() uint16 {
+	return m.processor.StackPointer()
+}
+
+// Return a copy of the stack, the most recently pushed address last.
+func (m *Machine) Stack() []uint16 {
+	return m.processor.Stack()
+}
+
+// Return the value of the delay timer.
+func (m *Machine) DelayTimer() byte {
+	return m.processor.DelayTimer()
+}
+
+// Return the value of the sound timer.
+func (m *Machine) SoundTimer() byte {
+	return m.processor.SoundTimer()
+}
+
+// Read a byte of memory, addresses outside of the memory read as zero.
+func (m *Machine) ReadMemory(address uint16) byte {
+	return m.processor.ReadMemory(address)
+}
+
+// Return a copy of the whole memory.
+func (m *Machine) Memory() []byte {
+	memory := make([]byte, m.processor.MemorySize())
+	for i := range memory {
+		memory[i] = m.processor.ReadMemory(uint16(i))
+	}
+	return memory
+}
+
+// Write the state of the machine as a save state.
+func (m *Machine) SaveState(w io.Writer) error {
+	return m.processor.SaveState(w)
+}
+
+// Restore a save state made with the same ROM.
+func (m *Machine) LoadState(r io.Reader) error {
+	return m.processor.LoadState(r)
+}
+
+// Return the underlying processor, for instance to
+// register native routines for machine code calls.
+func (m *Machine) Processor() *device.Processor {
+	return m.processor
+}
@@ -0,0 +1,70 @@
+package emulator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+func TestMachine(t *testing.T) {
+	// LD V0, 0x05; LD DT, V0; CALL 0x208; at 0x208, a jump to itself.
+	rom := []byte{0x60, 0x05, 0xF0, 0x15, 0x22, 0x08, 0x00, 0x00, 0x12, 0x08}
+	machine := NewMachine(device.Config{}, 600)
+	if err := machine.LoadROM(rom); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := machine.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if machine.V(0) != 0x05 || machine.DelayTimer() != 0x05 {
+		t.Fatalf("V0 is %d and DT is %d, expected 5.", machine.V(0), machine.DelayTimer())
+	}
+	if machine.PC() != 0x208 || machine.SP() != 1 || machine.Stack()[0] != 0x204 {
+		t.Fatalf("PC is %X and the stack is %X after the call.", machine.PC(), machine.Stack())
+	}
+	if err := machine.StepFrame(); err != nil {
+		t.Fatal(err)
+	}
+	if machine.DelayTimer() != 0x04 {
+		t.Fatalf("DT is %d after a frame, expected 4.", machine.DelayTimer())
+	}
+	if err := machine.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if machine.V(0) != 0 || machine.SP() != 0 || machine.PC() != device.RamStartLocation {
+		t.Fatal("Machine is not reset.")
+	}
+	if machine.ReadMemory(device.RamStartLocation) != 0x60 {
+		t.Fatal("ROM is not loaded again after the reset.")
+	}
+}
+
+func TestMachineROMSize(t *testing.T) {
+	tests := []struct {
+		platform device.Platform
+		size     int
+		fits     bool
+	}{
+		{device.Chip8, 0xE00, true},
+		{device.Chip8, 0xE01, false},
+		{device.ETI660, 0xA00, true},
+		{device.ETI660, 0xA01, false},
+		{device.XOChip, 0xFE00, true},
+		// Sizes of 64K or more used to be truncated.
+		{device.XOChip, 0x10000, false},
+	}
+	for _, test := range tests {
+		machine := NewMachine(device.Config{Platform: test.platform}, 600)
+		err := machine.LoadROM(make([]byte, test.size))
+		if (err == nil) != test.fits {
+			t.Fatalf("Loading %d bytes on the %s platform returned %v.", test.size, test.platform, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), fmt.Sprintf("program is %d bytes", test.size)) {
+			t.Fatalf("Error %q does not state the size of the program.", err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package emulator
+
+import (
+	"encoding/binary"
+)
+
+// A bounded ring buffer of the snapshots of the past frames. Only the
+// latest snapshot is kept as is, every other one is stored as its XOR
+// with the snapshot after it, run length encoded, since the memory
+// rarely changes between frames.
+type RewindBuffer struct {
+	// Encoded differences between consecutive snapshots,
+	// the oldest one is dropped once the buffer is full.
+	deltas [][]byte
+	// Index of the oldest difference and the number of them.
+	start int
+	count int
+	// The latest snapshot.
+	latest []byte
+}
+
+// Create a rewind buffer holding the given number of frames.
+func NewRewindBuffer(frames int) *RewindBuffer {
+	buffer := new(RewindBuffer)
+	buffer.deltas = make([][]byte, frames)
+	return buffer
+}
+
+// Return the number of frames that can be rewound.
+func (b *RewindBuffer) Len() int {
+	return b.count
+}
+
+// Add the snapshot of a frame, the buffer keeps the snapshot.
+func (b *RewindBuffer) Push(snapshot []byte) {
+	if b.latest != nil && len(b.latest) == len(snapshot) && len(b.deltas) > 0 {
+		index := (b.start + b.count) % len(b.deltas)
+		if b.count == len(b.deltas) {
+			// Drop the oldest frame.
+			b.start = (b.start + 1) % len(b.deltas)
+		} else {
+			b.count++
+		}
+		b.deltas[index] = encodeDelta(b.deltas[index][:0], b.latest, snapshot)
+	} else {
+		// Snapshots of a different size cannot be compared.
+		b.start, b.count = 0, 0
+	}
+	b.latest = snapshot
+}
+
+// Remove the latest snapshot and return the one before it, which
+// must not be modified, returns false if there are no earlier ones.
+func (b *RewindBuffer) Pop() ([]byte, bool) {
+	if b.count == 0 {
+		return nil, false
+	}
+	b.count--
+	index := (b.start + b.count) % len(b.deltas)
+	b.latest = decodeDelta(b.latest, b.deltas[index])
+	return b.latest, true
+}
+
+// Append the XOR of the two snapshots of the same size to dst,
+// encoded as pairs of a run of zero bytes and a run of literal
+// bytes, with the lengths of the runs as uvarints.
+func encodeDelta(dst []byte, previous []byte, next []byte) []byte {
+	var length [binary.MaxVarintLen64]byte
+	for i := 0; i < len(next); {
+		zeros := i
+		for i < len(next) && previous[i] == next[i] {
+			i++
+		}
+		literals := i
+		for i < len(next) && previous[i] != next[i] {
+			i++
+		}
+		dst = append(dst, length[:binary.PutUvarint(length[:], uint64(literals-zeros))]...)
+		dst = append(dst, length[:binary.PutUvarint(length[:], uint64(i-literals))]...)
+		for j := literals; j < i; j++ {
+			dst = append(dst, previous[j]^next[j])
+		}
+	}
+	return dst
+}
+
+// Apply an encoded XOR to the snapshot in place and return it.
+func decodeDelta(snapshot []byte, delta []byte) []byte {
+	position := 0
+	for len(delta) > 0 {
+		zeros, n := binary.Uvarint(delta)
+		delta = delta[n:]
+		literals, n := binary.Uvarint(delta)
+		delta = delta[n:]
+		position += int(zeros)
+		for i := 0; i < int(literals); i++ {
+			snapshot[position] ^= delta[i]
+			position++
+		}
+		delta = delta[literals:]
+	}
+	return snapshot
+}
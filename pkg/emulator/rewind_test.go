@@ -0,0 +1,31 @@
+package emulator
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRewindBuffer(t *testing.T) {
+	buffer := NewRewindBuffer(2)
+	snapshots := [][]byte{
+		{0, 0, 0, 0, 0, 0},
+		{0, 1, 0, 0, 2, 0},
+		{3, 1, 0, 0, 2, 4},
+		{3, 1, 5, 5, 2, 4},
+	}
+	for _, snapshot := range snapshots {
+		buffer.Push(append([]byte(nil), snapshot...))
+	}
+	if buffer.Len() != 2 {
+		t.Fatalf("Buffer holds %d frames, expected 2.", buffer.Len())
+	}
+	for i := 2; i >= 1; i-- {
+		snapshot, ok := buffer.Pop()
+		if !ok || !bytes.Equal(snapshot, snapshots[i]) {
+			t.Fatalf("Rewound to %v, expected %v.", snapshot, snapshots[i])
+		}
+	}
+	if _, ok := buffer.Pop(); ok {
+		t.Fatal("Rewound past the oldest frame.")
+	}
+}
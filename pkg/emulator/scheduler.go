@@ -0,0 +1,114 @@
+package emulator
+
+import (
+	"time"
+
+	"github.com/ambertide/chip8/pkg/emulator/cosmac"
+)
+
+const (
+	// Frequency of the timers and the display.
+	FrameRate = 60
+	// Duration of a single frame.
+	FrameDuration = time.Second / FrameRate
+	// If the scheduler falls behind by more than this, for
+	// instance because the process was suspended, it stops
+	// trying to catch up instead of running frames back to back.
+	maxFrameLag = FrameDuration * 10
+)
+
+// A machine that can be advanced a 60 Hz frame at a time.
+type Core interface {
+	// Run up to the given number of cycles and tick the timers
+	// once, returns the number of cycles that were run.
+	StepFrame(cycles int) (int, error)
+	ShouldHalt() bool
+}
+
+// A core that tells the frames it held paused, in the debugger
+// or while rewinding, apart from the frames it ran.
+type pausableCore interface {
+	Core
+	// Run a frame like StepFrame, also returns false if
+	// the frame was held paused.
+	stepFrameUnlessPaused(cycles int) (int, bool, error)
+}
+
+// Runs a core at a given clock speed in 60 Hz frames, all on
+// the calling goroutine so that the timers never race the CPU.
+type Scheduler struct {
+	core       Core
+	clockSpeed uint64
+	// Cycles carried between frames when the clock speed
+	// is not a multiple of the frame rate.
+	cycleRemainder uint64
+	// Deadline of the next frame.
+	nextFrame time.Time
+}
+
+// Create a new scheduler running the core at the clock speed in Hz.
+func NewScheduler(core Core, clockSpeed uint64) *Scheduler {
+	scheduler := new(Scheduler)
+	scheduler.core = core
+	scheduler.clockSpeed = clockSpeed
+	return scheduler
+}
+
+// Return the number of cycles of the next frame.
+func (s *Scheduler) cyclesOfFrame() int {
+	s.cycleRemainder += s.clockSpeed
+	cycles := s.cycleRemainder / FrameRate
+	s.cycleRemainder %= FrameRate
+	return int(cycles)
+}
+
+// Advance the core by a single frame, without waiting.
+func (s *Scheduler) StepFrame() error {
+	_, err := s.core.StepFrame(s.cyclesOfFrame())
+	return err
+}
+
+// Wait until the deadline of the next frame, the deadlines are
+// absolute so that oversleeping is compensated by the next frame.
+func (s *Scheduler) waitForFrame() {
+	s.nextFrame = s.nextFrame.Add(FrameDuration)
+	delay := time.Until(s.nextFrame)
+	if delay > 0 {
+		time.Sleep(delay)
+	} else if -delay > maxFrameLag {
+		s.nextFrame = time.Now()
+	}
+}
+
+// Run the core until it halts, faults or stop is closed.
+func (s *Scheduler) Run(stop <-chan struct{}) error {
+	s.nextFrame = time.Now()
+	for !s.core.ShouldHalt() {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if err := s.StepFrame(); err != nil {
+			return err
+		}
+		s.waitForFrame()
+	}
+	return nil
+}
+
+// The VIP runs a fixed number of machine cycles in a frame,
+// set by the CDP1861 rather than the clock speed.
+type vipCore struct {
+	*cosmac.VIP
+}
+
+func (v vipCore) StepFrame(cycles int) (int, error) {
+	v.VIP.StepFrame()
+	return cycles, nil
+}
+
+func (v vipCore) stepFrameUnlessPaused(cycles int) (int, bool, error) {
+	executed, err := v.StepFrame(cycles)
+	return executed, true, err
+}
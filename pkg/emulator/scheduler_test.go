@@ -0,0 +1,32 @@
+package emulator
+
+import "testing"
+
+// A core that counts the cycles it is asked to run.
+type countingCore struct {
+	cycles int
+	frames int
+}
+
+func (c *countingCore) StepFrame(cycles int) (int, error) {
+	c.cycles += cycles
+	c.frames++
+	return cycles, nil
+}
+
+func (c *countingCore) ShouldHalt() bool {
+	return false
+}
+
+func TestSchedulerCycles(t *testing.T) {
+	core := new(countingCore)
+	scheduler := NewScheduler(core, 500)
+	for i := 0; i < FrameRate; i++ {
+		if err := scheduler.StepFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if core.cycles != 500 {
+		t.Fatalf("Ran %d cycles in a second, expected 500.", core.cycles)
+	}
+}
@@ -0,0 +1,113 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+// Returned when save states are used on the COSMAC VIP.
+var errVIPState = errors.New("save states are not supported on the vip platform")
+
+// Return the path of the quick save state, next to the ROM.
+func (e *Emulator) quickStatePath() string {
+	return strings.TrimSuffix(e.programPath, filepath.Ext(e.programPath)) + ".state"
+}
+
+// Write the state of the processor to the file at the path.
+func (e *Emulator) saveState(path string) error {
+	if e.vip != nil {
+		return errVIPState
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := e.processor.SaveState(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Restore the state of the processor from the file at the path.
+func (e *Emulator) loadState(path string) error {
+	if e.vip != nil {
+		return errVIPState
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := e.processor.LoadState(file); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Handle a command sent by the frontend.
+func (e *Emulator) handleCommand(command Command) {
+	var err error
+	switch command {
+	case QuickSave:
+		err = e.saveState(e.quickStatePath())
+	case QuickLoad:
+		err = e.loadState(e.quickStatePath())
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// The processor of the emulator, which handles the commands
+// of the frontend between frames.
+type controlledCore struct {
+	e *Emulator
+}
+
+func (c controlledCore) StepFrame(cycles int) (int, error) {
+	executed, _, err := c.stepFrameUnlessPaused(cycles)
+	return executed, err
+}
+
+func (c controlledCore) stepFrameUnlessPaused(cycles int) (int, bool, error) {
+	for len(c.e.controls.commands) > 0 {
+		command := <-c.e.controls.commands
+		if c.e.debugger != nil {
+			// The debugger may be accessing the processor.
+			c.e.debugger.WithProcessor(func(*device.Processor) { c.e.handleCommand(command) })
+		} else {
+			c.e.handleCommand(command)
+		}
+	}
+	if c.e.debugger != nil {
+		return c.e.debugger.StepFrameUnlessPaused(cycles)
+	}
+	if c.e.rewind == nil {
+		executed, err := c.e.processor.StepFrame(cycles)
+		return executed, true, err
+	}
+	if c.e.controls.Rewinding() {
+		// Stay at the oldest frame once the buffer runs out.
+		if snapshot, ok := c.e.rewind.Pop(); ok {
+			return 0, false, c.e.processor.UnmarshalState(snapshot)
+		}
+		return 0, false, nil
+	}
+	executed, err := c.e.processor.StepFrame(cycles)
+	c.e.rewind.Push(c.e.processor.MarshalState())
+	return executed, true, err
+}
+
+func (c controlledCore) ShouldHalt() bool {
+	if c.e.debugger != nil {
+		return c.e.debugger.ShouldHalt()
+	}
+	return c.e.processor.ShouldHalt()
+}
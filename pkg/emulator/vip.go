@@ -0,0 +1,31 @@
+package emulator
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ambertide/chip8/pkg/emulator/cosmac"
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+// Create a COSMAC VIP running the monitor and the interpreter
+// images given in the options, returns an error if they could
+// not be read or do not fit in the memory of the VIP.
+func newVIP(screenBuffer *device.FrameBuffer, keyState *device.KeyState, soundBuffer *device.SoundBuffer, options Options) (*cosmac.VIP, error) {
+	monitor, err := os.ReadFile(options.VIPMonitorPath)
+	if err != nil {
+		return nil, err
+	}
+	interpreter, err := os.ReadFile(options.VIPInterpreterPath)
+	if err != nil {
+		return nil, err
+	}
+	vip, err := cosmac.NewVIP(screenBuffer, keyState, soundBuffer, monitor, cosmac.DefaultRAMSize)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", options.VIPMonitorPath, err)
+	}
+	if err := vip.LoadInterpreter(interpreter); err != nil {
+		return nil, fmt.Errorf("%s: %w", options.VIPInterpreterPath, err)
+	}
+	return vip, nil
+}
@@ -0,0 +1,69 @@
+// Contains the audio frontend of the emulator,
+// powered by the Beep library.
+package audio
+
+import (
+	"math"
+	"time"
+
+	"github.com/ambertide/chip8/pkg/emulator/device"
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/generators"
+	"github.com/faiface/beep/speaker"
+)
+
+const sampleRate = 44100
+
+// Create a streamer that plays the XO-CHIP audio pattern
+// of the sound at its pitch, phase holds the position in
+// the pattern between calls.
+func patternTone(sound device.Sound, phase *float64) beep.Streamer {
+	// The pattern is played at 4000 Hz by default.
+	rate := 4000 * math.Pow(2, (float64(sound.Pitch)-64)/48)
+	patternBits := float64(device.AudioPatternSize * 8)
+	return beep.StreamerFunc(func(samples [][2]float64) (n int, ok bool) {
+		for i := range samples {
+			bit := int(*phase)
+			value := -0.25
+			if sound.Pattern[bit/8]&(0x80>>(bit%8)) != 0 {
+				value = 0.25
+			}
+			samples[i] = [2]float64{value, value}
+			*phase = math.Mod(*phase+rate/sampleRate, patternBits)
+		}
+		return len(samples), true
+	})
+}
+
+func BeepRoutine(soundBuffer *device.SoundBuffer, stop <-chan struct{}) {
+	speaker.Init(sampleRate, 735)
+	sound, err := generators.SinTone(sampleRate, 1190)
+	if err != nil {
+		return
+	}
+	phase := 0.0
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		state := soundBuffer.Latest()
+		if state.Active {
+			if state.UsePattern {
+				speaker.Play(beep.Take(sampleRate/60, patternTone(state, &phase)))
+			} else {
+				speaker.Play(beep.Take(sampleRate/60, sound))
+			}
+		}
+		time.Sleep(time.Second / 60)
+	}
+}
+
+// Plays the sound of the emulator on the speaker.
+type Speaker struct{}
+
+// Play the sound until stop is closed.
+func (Speaker) Run(soundBuffer *device.SoundBuffer, stop <-chan struct{}) {
+	BeepRoutine(soundBuffer, stop)
+}
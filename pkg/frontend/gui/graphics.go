@@ -0,0 +1,189 @@
+// Contains the window frontend of the emulator,
+// powered by the Pixel library.
+package gui
+
+import (
+	"image"
+	"image/color"
+	_ "image/png"
+	"math"
+
+	"github.com/ambertide/chip8/pkg/emulator"
+	"github.com/ambertide/chip8/pkg/emulator/device"
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/pixelgl"
+)
+
+type Graphics struct {
+	screen      *device.FrameBuffer
+	pixelSprite *pixel.Sprite
+	window      *pixelgl.Window
+	batch       *pixel.Batch
+	keyState    *device.KeyState
+	controls    *emulator.Controls
+	// Closing stop closes the window.
+	stop <-chan struct{}
+}
+
+// Location and colour of a lit pixel.
+type litPixel struct {
+	matrix pixel.Matrix
+	colour byte
+}
+
+var keysToChip8 = map[pixelgl.Button]uint16{
+	pixelgl.Key0: 1,
+	pixelgl.Key1: 2,
+	pixelgl.Key2: 4,
+	pixelgl.Key3: 8,
+	pixelgl.Key4: 16,
+	pixelgl.Key5: 32,
+	pixelgl.Key6: 64,
+	pixelgl.Key7: 128,
+	pixelgl.Key8: 256,
+	pixelgl.Key9: 512,
+	pixelgl.KeyA: 1024,
+	pixelgl.KeyB: 2048,
+	pixelgl.KeyC: 4096,
+	pixelgl.KeyD: 8192,
+	pixelgl.KeyE: 16384,
+	pixelgl.KeyF: 32768,
+}
+
+// Almost verbatim from the Pixel tutorial in
+// https://github.com/faiface/pixel/wiki/Drawing-a-Sprite
+func (g *Graphics) loadPixelSprite() pixel.Picture {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			img.SetRGBA(i, j, color.RGBA{255, 255, 255, 1})
+		}
+	}
+	picture := pixel.PictureDataFromImage(img)
+	g.pixelSprite = pixel.NewSprite(picture, picture.Bounds())
+	//log.Print("Hi")
+	return picture
+}
+
+// Calculate the matrices to locate sprites.
+func (g *Graphics) calculateMatrices() []litPixel {
+	matrices := []litPixel{}
+	frame := g.screen.Latest()
+	if frame.Width == 0 || frame.Height == 0 {
+		return matrices
+	}
+	// Fit the display to the window regardless of its resolution.
+	bounds := g.window.Bounds()
+	scale := math.Min(bounds.W()/float64(frame.Width), bounds.H()/float64(frame.Height))
+	// Pixel sprite is 10x10 by default.
+	pixelScale := pixel.IM.Scaled(pixel.ZV, scale/10)
+	for y := 0; y < frame.Height; y++ {
+		for x := 0; x < frame.Width; x++ {
+			if colour := frame.Pixel(x, y); colour != 0 {
+				// Append the location of the pixel to the matrices as a matrix.
+				location := pixel.V(float64(x)+0.5, float64(frame.Height-y)-0.5).Scaled(scale)
+				matrices = append(matrices, litPixel{pixelScale.Moved(location), colour})
+			}
+		}
+	}
+	return matrices
+}
+
+// Draw the pixels to the screen.
+func (g *Graphics) drawPixels() {
+	pixelLocations := g.calculateMatrices()
+	for _, pixelLocation := range pixelLocations {
+		g.pixelSprite.DrawColorMask(g.batch, pixelLocation.matrix, emulator.PixelColours[pixelLocation.colour])
+	}
+
+}
+
+func NewGraphics(screenBuffer *device.FrameBuffer, keyState *device.KeyState, controls *emulator.Controls, stop <-chan struct{}) *Graphics {
+	graphics := new(Graphics)
+	graphics.controls = controls
+	graphics.stop = stop
+	graphics.screen = screenBuffer
+	graphics.keyState = keyState
+	var err error
+	config := pixelgl.WindowConfig{
+		Title:  "Chip8",
+		Bounds: pixel.R(0, 0, 640, 320),
+		VSync:  true,
+	}
+	graphics.window, err = pixelgl.NewWindow(config)
+	if err != nil {
+		panic(err)
+	}
+	pixelPicture := graphics.loadPixelSprite()
+	graphics.batch = pixel.NewBatch(&pixel.TrianglesData{}, pixelPicture)
+	return graphics
+}
+
+// Reset and recalculate the key state
+// From a slice of pressed keys.
+func (g *Graphics) updateKeyState(keyValues []uint16) {
+	newMask := uint16(0x0)
+	for _, keyValue := range keyValues {
+		newMask ^= keyValue
+	}
+	g.keyState.Set(newMask)
+}
+
+// Handle keyboard presses by the user.
+func (g *Graphics) handleKeyboard() {
+	pressedKeys := []uint16{}
+	for key, value := range keysToChip8 {
+		if g.window.Pressed(key) {
+			pressedKeys = append(pressedKeys, value)
+		}
+	}
+	g.updateKeyState(pressedKeys)
+	// F5 and F9 quick save and quick load the state.
+	if g.window.JustPressed(pixelgl.KeyF5) {
+		g.controls.Send(emulator.QuickSave)
+	}
+	if g.window.JustPressed(pixelgl.KeyF9) {
+		g.controls.Send(emulator.QuickLoad)
+	}
+	// Time runs backwards while backspace is held.
+	g.controls.SetRewinding(g.window.Pressed(pixelgl.KeyBackspace))
+}
+
+// Loop through the graphics engine.
+func (g *Graphics) Mainloop() {
+	for !g.window.Closed() {
+		select {
+		case <-g.stop:
+			g.window.SetClosed(true)
+			continue
+		default:
+		}
+		g.window.Clear(color.Black)
+		g.batch.Clear()
+		g.drawPixels()
+		g.batch.Draw(g.window)
+		g.window.Update()
+		g.handleKeyboard()
+	}
+}
+
+func RunGraphics(screenBuffer *device.FrameBuffer, keyState *device.KeyState, controls *emulator.Controls, stop <-chan struct{}) {
+	//log.Println("Graphic initialisation starting...")
+	graphics := NewGraphics(screenBuffer, keyState, controls, stop)
+	//log.Println("Graphics initialised")
+	graphics.Mainloop()
+
+}
+
+// Renders the emulator to a window.
+type Renderer struct{}
+
+// Run the window until it is closed or stop is closed.
+func (Renderer) Run(screenBuffer *device.FrameBuffer, keyState *device.KeyState, controls *emulator.Controls, stop <-chan struct{}) {
+	RunGraphics(screenBuffer, keyState, controls, stop)
+}
+
+// Run the function on the main thread, which the window requires.
+func Run(run func()) {
+	pixelgl.Run(run)
+}
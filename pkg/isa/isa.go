@@ -0,0 +1,302 @@
+// Contains the instruction set of the Chip-8 and its extensions,
+// decoded into structured instructions shared by the processor,
+// the disassembler, the assembler and the debuggers.
+package isa
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The kind of an instruction, which determines its operation
+// and which of the fields of the opcode are operands.
+type Kind uint8
+
+const (
+	// Not an instruction of the platform.
+	Invalid Kind = iota
+	MachineCall
+	ClearScreen
+	Return
+	ScrollDown
+	ScrollUp
+	ScrollRight
+	ScrollLeft
+	Exit
+	LowResolution
+	HighResolution
+	Jump
+	Call
+	SkipEqualImmediate
+	SkipNotEqualImmediate
+	SkipEqual
+	StoreRange
+	LoadRange
+	LoadImmediate
+	AddImmediate
+	Move
+	Or
+	And
+	Xor
+	Add
+	Sub
+	ShiftRight
+	SubN
+	ShiftLeft
+	SkipNotEqual
+	LoadI
+	JumpOffset
+	Random
+	Draw
+	SkipKeyPressed
+	SkipKeyNotPressed
+	LoadILong
+	SelectPlanes
+	LoadAudio
+	ReadDelay
+	WaitKey
+	SetDelay
+	SetSound
+	AddI
+	LoadDigit
+	LoadLargeDigit
+	StoreBCD
+	SetPitch
+	Store
+	Load
+	StoreFlags
+	LoadFlags
+	// Number of kinds.
+	KindCount
+)
+
+// Describes how a kind is encoded and written.
+type kindInfo struct {
+	// Hexadecimal digits of the opcode, where X and Y are
+	// registers, and N, NN and NNN are immediates.
+	pattern  string
+	mnemonic string
+	// Syntax of the operands, where Vx and Vy are registers, nn
+	// is a byte, nnn and nnnn are addresses, and n and x are
+	// written as decimal numbers.
+	syntax string
+}
+
+var kinds = [KindCount]kindInfo{
+	Invalid:               {"", "", ""},
+	MachineCall:           {"0NNN", "SYS", "nnn"},
+	ClearScreen:           {"00E0", "CLS", ""},
+	Return:                {"00EE", "RET", ""},
+	ScrollDown:            {"00CN", "SCD", "n"},
+	ScrollUp:              {"00DN", "SCU", "n"},
+	ScrollRight:           {"00FB", "SCR", ""},
+	ScrollLeft:            {"00FC", "SCL", ""},
+	Exit:                  {"00FD", "EXIT", ""},
+	LowResolution:         {"00FE", "LOW", ""},
+	HighResolution:        {"00FF", "HIGH", ""},
+	Jump:                  {"1NNN", "JP", "nnn"},
+	Call:                  {"2NNN", "CALL", "nnn"},
+	SkipEqualImmediate:    {"3XNN", "SE", "Vx, nn"},
+	SkipNotEqualImmediate: {"4XNN", "SNE", "Vx, nn"},
+	SkipEqual:             {"5XY0", "SE", "Vx, Vy"},
+	StoreRange:            {"5XY2", "LD", "[I], Vx-Vy"},
+	LoadRange:             {"5XY3", "LD", "Vx-Vy, [I]"},
+	LoadImmediate:         {"6XNN", "LD", "Vx, nn"},
+	AddImmediate:          {"7XNN", "ADD", "Vx, nn"},
+	Move:                  {"8XY0", "LD", "Vx, Vy"},
+	Or:                    {"8XY1", "OR", "Vx, Vy"},
+	And:                   {"8XY2", "AND", "Vx, Vy"},
+	Xor:                   {"8XY3", "XOR", "Vx, Vy"},
+	Add:                   {"8XY4", "ADD", "Vx, Vy"},
+	Sub:                   {"8XY5", "SUB", "Vx, Vy"},
+	ShiftRight:            {"8XY6", "SHR", "Vx, Vy"},
+	SubN:                  {"8XY7", "SUBN", "Vx, Vy"},
+	ShiftLeft:             {"8XYE", "SHL", "Vx, Vy"},
+	SkipNotEqual:          {"9XY0", "SNE", "Vx, Vy"},
+	LoadI:                 {"ANNN", "LD", "I, nnn"},
+	JumpOffset:            {"BNNN", "JP", "V0, nnn"},
+	Random:                {"CXNN", "RND", "Vx, nn"},
+	Draw:                  {"DXYN", "DRW", "Vx, Vy, n"},
+	SkipKeyPressed:        {"EX9E", "SKP", "Vx"},
+	SkipKeyNotPressed:     {"EXA1", "SKNP", "Vx"},
+	LoadILong:             {"F000", "LD", "I, LONG nnnn"},
+	SelectPlanes:          {"FX01", "PLANE", "x"},
+	LoadAudio:             {"F002", "AUDIO", ""},
+	ReadDelay:             {"FX07", "LD", "Vx, DT"},
+	WaitKey:               {"FX0A", "LD", "Vx, K"},
+	SetDelay:              {"FX15", "LD", "DT, Vx"},
+	SetSound:              {"FX18", "LD", "ST, Vx"},
+	AddI:                  {"FX1E", "ADD", "I, Vx"},
+	LoadDigit:             {"FX29", "LD", "F, Vx"},
+	LoadLargeDigit:        {"FX30", "LD", "HF, Vx"},
+	StoreBCD:              {"FX33", "LD", "B, Vx"},
+	SetPitch:              {"FX3A", "PITCH", "Vx"},
+	Store:                 {"FX55", "LD", "[I], Vx"},
+	Load:                  {"FX65", "LD", "Vx, [I]"},
+	StoreFlags:            {"FX75", "LD", "R, Vx"},
+	LoadFlags:             {"FX85", "LD", "Vx, R"},
+}
+
+// Masks of the fixed digits of the patterns and their values.
+var opcodeMasks, opcodeValues [KindCount]uint16
+
+func init() {
+	for kind := Kind(1); kind < KindCount; kind++ {
+		for _, digit := range kinds[kind].pattern {
+			opcodeMasks[kind] <<= 4
+			opcodeValues[kind] <<= 4
+			if value, err := strconv.ParseUint(string(digit), 16, 8); err == nil {
+				opcodeMasks[kind] |= 0xF
+				opcodeValues[kind] |= uint16(value)
+			}
+		}
+	}
+}
+
+// Return the opcode pattern of the kind, such as DXYN.
+func (k Kind) Pattern() string {
+	return kinds[k].pattern
+}
+
+// Return the mnemonic of the kind in Cowgod syntax.
+func (k Kind) Mnemonic() string {
+	return kinds[k].mnemonic
+}
+
+// Return the syntax of the operands of the kind, such as
+// "Vx, Vy, n", where Vx and Vy are registers, nn is a byte,
+// nnn and nnnn are addresses, and n and x are small numbers.
+func (k Kind) Syntax() string {
+	return kinds[k].syntax
+}
+
+func (k Kind) String() string {
+	if k == Invalid {
+		return "invalid"
+	}
+	return kinds[k].pattern
+}
+
+// Returns true if the opcode matches the pattern of the kind.
+func (k Kind) Matches(opcode uint16) bool {
+	return k != Invalid && opcode&opcodeMasks[k] == opcodeValues[k]
+}
+
+// A decoded instruction, the fields are those of the opcode
+// whether or not the kind uses them as operands.
+type Instruction struct {
+	Kind Kind
+	X    uint8
+	Y    uint8
+	N    uint8
+	NN   uint8
+	// The address of the instruction, for the long XO-CHIP load
+	// of I the whole second word of the instruction.
+	NNN uint16
+}
+
+// Decode the opcode with the instructions of all platforms, see
+// Table.Decode for the instructions of a single platform.
+func Decode(opcode uint16) Instruction {
+	return XOChip.Decode(opcode)
+}
+
+// Return the instruction of the kind with the fields of the opcode.
+func decodeFields(kind Kind, opcode uint16) Instruction {
+	return Instruction{
+		Kind: kind,
+		X:    uint8(opcode >> 8 & 0xF),
+		Y:    uint8(opcode >> 4 & 0xF),
+		N:    uint8(opcode & 0xF),
+		NN:   uint8(opcode),
+		NNN:  opcode & 0xFFF,
+	}
+}
+
+// Encode the instruction as an opcode from the operands of its
+// kind, the long XO-CHIP load of I is followed by the word NNN.
+func Encode(instruction Instruction) uint16 {
+	info := kinds[instruction.Kind]
+	opcode := opcodeValues[instruction.Kind]
+	for i, digit := range info.pattern {
+		shift := uint(12 - 4*i)
+		switch digit {
+		case 'X':
+			opcode |= uint16(instruction.X&0xF) << shift
+		case 'Y':
+			opcode |= uint16(instruction.Y&0xF) << shift
+		}
+	}
+	switch {
+	case strings.HasSuffix(info.pattern, "NNN"):
+		opcode |= instruction.NNN & 0xFFF
+	case strings.HasSuffix(info.pattern, "NN"):
+		opcode |= uint16(instruction.NN)
+	case strings.HasSuffix(info.pattern, "N"):
+		opcode |= uint16(instruction.N & 0xF)
+	}
+	return opcode
+}
+
+// Return the size of the instruction in bytes.
+func (i Instruction) Size() int {
+	if i.Kind == LoadILong {
+		return 4
+	}
+	return 2
+}
+
+// Returns true if the instruction refers to an address through NNN.
+func (i Instruction) HasAddress() bool {
+	return strings.Contains(kinds[i.Kind].syntax, "nnn")
+}
+
+// Return the instruction in Cowgod syntax, such as DRW V0, V1, 5.
+func (i Instruction) String() string {
+	return i.Format(nil)
+}
+
+// Return the instruction in Cowgod syntax, the address it
+// refers to is written by the function if it is not nil,
+// for instance to write the address as a label.
+func (i Instruction) Format(address func(address uint16) string) string {
+	info := kinds[i.Kind]
+	if i.Kind == Invalid {
+		return "invalid"
+	}
+	if info.syntax == "" {
+		return info.mnemonic
+	}
+	operands := strings.Split(info.syntax, ", ")
+	for index, operand := range operands {
+		operands[index] = i.formatOperand(operand, address)
+	}
+	return info.mnemonic + " " + strings.Join(operands, ", ")
+}
+
+// Return the value of an operand of the syntax.
+func (i Instruction) formatOperand(operand string, address func(address uint16) string) string {
+	switch operand {
+	case "nnn":
+		if address != nil {
+			return address(i.NNN)
+		}
+		return fmt.Sprintf("0x%03X", i.NNN)
+	case "LONG nnnn":
+		// The long load is marked, since its address
+		// could also fit into the short one.
+		if address != nil {
+			return "LONG " + address(i.NNN)
+		}
+		return fmt.Sprintf("LONG 0x%04X", i.NNN)
+	case "nn":
+		return fmt.Sprintf("0x%02X", i.NN)
+	case "n":
+		return fmt.Sprint(i.N)
+	case "x":
+		return fmt.Sprint(i.X)
+	}
+	operand = strings.Replace(operand, "Vx", fmt.Sprintf("V%X", i.X), 1)
+	return strings.Replace(operand, "Vy", fmt.Sprintf("V%X", i.Y), 1)
+}
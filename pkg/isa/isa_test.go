@@ -0,0 +1,52 @@
+package isa
+
+import "testing"
+
+func TestDecodeFields(t *testing.T) {
+	instruction := Decode(0xD12F)
+	if instruction.Kind != Draw || instruction.X != 0x1 || instruction.Y != 0x2 || instruction.N != 0xF {
+		t.Fatalf("DXYN decoded as %+v.", instruction)
+	}
+	instruction = Decode(0x3AB4)
+	if instruction.Kind != SkipEqualImmediate || instruction.X != 0xA || instruction.NN != 0xB4 {
+		t.Fatalf("3XNN decoded as %+v.", instruction)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for opcode := 0; opcode <= 0xFFFF; opcode++ {
+		instruction := Decode(uint16(opcode))
+		if instruction.Kind != Invalid && Encode(instruction) != uint16(opcode) {
+			t.Fatalf("%04X decoded as %s encodes to %04X.", opcode, instruction, Encode(instruction))
+		}
+	}
+}
+
+func TestTables(t *testing.T) {
+	for _, test := range []struct {
+		table    *Table
+		opcode   uint16
+		expected string
+	}{
+		{Chip8, 0x00E0, "CLS"},
+		{Chip8, 0x00FF, "SYS 0x0FF"},
+		{SuperChip, 0x00FF, "HIGH"},
+		{SuperChip, 0x00D2, "SYS 0x0D2"},
+		{XOChip, 0x00D2, "SCU 2"},
+		{Chip8, 0x5122, "invalid"},
+		{XOChip, 0x5122, "LD [I], V1-V2"},
+		{XOChip, 0xF201, "PLANE 2"},
+		{Chip8, 0x8AB6, "SHR VA, VB"},
+		{Chip8, 0xF165, "LD V1, [I]"},
+		{Chip8, 0x610A, "LD V1, 0x0A"},
+		{Chip8, 0xB2A0, "JP V0, 0x2A0"},
+	} {
+		if text := test.table.Decode(test.opcode).String(); text != test.expected {
+			t.Fatalf("%04X on %s is %q, expected %q.", test.opcode, test.table, text, test.expected)
+		}
+	}
+	long := Instruction{Kind: LoadILong, NNN: 0x1234}
+	if long.String() != "LD I, LONG 0x1234" || Encode(long) != 0xF000 {
+		t.Fatalf("Long load is %q.", long)
+	}
+}
@@ -0,0 +1,90 @@
+package isa
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+)
+
+// The instructions of a platform, decoding opcodes that are
+// not among them as invalid.
+type Table struct {
+	name  string
+	kinds []Kind
+	// Kinds of all opcodes, built on the first decode.
+	build  sync.Once
+	lookup *[0x10000]Kind
+}
+
+// Create a table of the kinds.
+func newTable(name string, kinds ...Kind) *Table {
+	return &Table{name: name, kinds: kinds}
+}
+
+var chip8Kinds = []Kind{
+	MachineCall, ClearScreen, Return, Jump, Call, SkipEqualImmediate, SkipNotEqualImmediate,
+	SkipEqual, LoadImmediate, AddImmediate, Move, Or, And, Xor, Add, Sub, ShiftRight, SubN,
+	ShiftLeft, SkipNotEqual, LoadI, JumpOffset, Random, Draw, SkipKeyPressed, SkipKeyNotPressed,
+	ReadDelay, WaitKey, SetDelay, SetSound, AddI, LoadDigit, StoreBCD, Store, Load,
+}
+
+var superChipKinds = append(append([]Kind(nil), chip8Kinds...),
+	ScrollDown, ScrollRight, ScrollLeft, Exit, LowResolution, HighResolution,
+	LoadLargeDigit, StoreFlags, LoadFlags,
+)
+
+var xoChipKinds = append(append([]Kind(nil), superChipKinds...),
+	ScrollUp, StoreRange, LoadRange, LoadILong, SelectPlanes, LoadAudio, SetPitch,
+)
+
+var (
+	// The original Chip-8 instructions.
+	Chip8 = newTable("chip8", chip8Kinds...)
+	// The Chip-8 and SUPER-CHIP 1.1 instructions.
+	SuperChip = newTable("schip", superChipKinds...)
+	// The SUPER-CHIP and XO-CHIP instructions.
+	XOChip = newTable("xochip", xoChipKinds...)
+)
+
+// Return the name of the platform of the table.
+func (t *Table) String() string {
+	return t.name
+}
+
+// Returns true if the kind is an instruction of the platform.
+func (t *Table) Supports(kind Kind) bool {
+	for _, supported := range t.kinds {
+		if supported == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the kinds of the instructions of the platform.
+func (t *Table) Kinds() []Kind {
+	return append([]Kind(nil), t.kinds...)
+}
+
+// Decode the opcode, where the most specific pattern of the platform
+// matching it is taken, so that 00E0 is CLS rather than SYS 0x0E0.
+func (t *Table) Decode(opcode uint16) Instruction {
+	t.build.Do(t.buildLookup)
+	return decodeFields(t.lookup[opcode], opcode)
+}
+
+// Fill the kinds of all opcodes, starting with the least specific patterns.
+func (t *Table) buildLookup() {
+	t.lookup = new([0x10000]Kind)
+	kinds := t.Kinds()
+	sort.SliceStable(kinds, func(i, j int) bool {
+		return bits.OnesCount16(opcodeMasks[kinds[i]]) < bits.OnesCount16(opcodeMasks[kinds[j]])
+	})
+	for _, kind := range kinds {
+		for opcode := 0; opcode < len(t.lookup); opcode++ {
+			if kind.Matches(uint16(opcode)) {
+				t.lookup[opcode] = kind
+			}
+		}
+	}
+}
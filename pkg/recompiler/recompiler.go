@@ -0,0 +1,368 @@
+// Contains a static recompiler, which turns the code of a ROM into
+// a Go program that runs it on the processor of the emulator.
+package recompiler
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+
+	"github.com/ambertide/chip8/pkg/disasm"
+	"github.com/ambertide/chip8/pkg/emulator/device"
+	"github.com/ambertide/chip8/pkg/isa"
+)
+
+// Options of the recompiled program.
+type Options struct {
+	Platform device.Platform
+	// The quirks the code is compiled for and the program runs with.
+	Quirks device.Quirks
+	// Name of the ROM, the save states and the RPL user flags of
+	// the program are stored next to it in the working directory.
+	Name string
+}
+
+// Names of the platforms in the device package.
+var platformNames = map[device.Platform]string{
+	device.Chip8:     "Chip8",
+	device.SuperChip: "SuperChip",
+	device.XOChip:    "XOChip",
+	device.ETI660:    "ETI660",
+}
+
+// A basic block of compiled instructions.
+type basicBlock struct {
+	address uint16
+	// Addresses of the instructions in order.
+	addresses []uint16
+	// Number of bytes of the code the block depends on.
+	size int
+}
+
+// The recompilation of a ROM.
+type recompilation struct {
+	rom     []byte
+	options Options
+	code    *disasm.Disassembly
+	blocks  []basicBlock
+	output  bytes.Buffer
+}
+
+// Returns true if the instruction can be compiled, which requires it
+// not to wait, halt, fault, write to the memory or use the keyboard,
+// the random number generator or the stack. The interpreter runs the
+// other instructions, as well as the computed BNNN jumps.
+func compilable(kind isa.Kind) bool {
+	switch kind {
+	case isa.ClearScreen, isa.Jump, isa.SkipEqualImmediate, isa.SkipNotEqualImmediate, isa.SkipEqual,
+		isa.SkipNotEqual, isa.LoadImmediate, isa.AddImmediate, isa.Move, isa.Or, isa.And, isa.Xor,
+		isa.Add, isa.Sub, isa.ShiftRight, isa.SubN, isa.ShiftLeft, isa.LoadI, isa.LoadILong,
+		isa.ReadDelay, isa.SetDelay, isa.SetSound, isa.AddI, isa.LoadDigit, isa.LoadLargeDigit:
+		return true
+	}
+	return false
+}
+
+// Returns true for the skips.
+func isSkip(kind isa.Kind) bool {
+	switch kind {
+	case isa.SkipEqualImmediate, isa.SkipNotEqualImmediate, isa.SkipEqual, isa.SkipNotEqual,
+		isa.SkipKeyPressed, isa.SkipKeyNotPressed:
+		return true
+	}
+	return false
+}
+
+// Write a Go program that runs the ROM with the instructions reached
+// from its start compiled into Go, falling back to the interpreter of
+// the processor for the other instructions and for modified code.
+func Recompile(rom []byte, options Options, w io.Writer) error {
+	r := &recompilation{rom: rom, options: options, code: disasm.Disassemble(rom, options.Platform)}
+	r.findBlocks()
+	r.writeProgram()
+	source, err := format.Source(r.output.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(source)
+	return err
+}
+
+// Return the word of the ROM at the address, zero outside of it.
+func (r *recompilation) word(address uint16) uint16 {
+	offset := int(address) - int(r.code.Origin())
+	if offset < 0 || offset+1 >= len(r.rom) {
+		return 0
+	}
+	return uint16(r.rom[offset])<<8 | uint16(r.rom[offset+1])
+}
+
+// Return the address a skip at the address continues at if taken,
+// which passes over both words of the long XO-CHIP load.
+func (r *recompilation) skipTarget(address uint16) uint16 {
+	if r.options.Platform == device.XOChip && r.word(address+2) == 0xF000 {
+		return address + 6
+	}
+	return address + 4
+}
+
+// Return the addresses the execution may enter the code at, which
+// are the start, the targets of jumps, calls and skips, and the
+// instructions after the ones that are run by the interpreter.
+func (r *recompilation) leaders() map[uint16]bool {
+	leaders := map[uint16]bool{r.code.Origin(): true}
+	for _, address := range r.code.Addresses() {
+		instruction, _ := r.code.Instruction(address)
+		next := address + uint16(instruction.Size())
+		switch {
+		case instruction.Kind == isa.Jump || instruction.Kind == isa.Call:
+			leaders[instruction.NNN] = true
+			leaders[next] = true
+		case isSkip(instruction.Kind):
+			leaders[next] = true
+			leaders[r.skipTarget(address)] = true
+		case !compilable(instruction.Kind):
+			leaders[next] = true
+		}
+	}
+	return leaders
+}
+
+// Split the compilable instructions into basic blocks.
+func (r *recompilation) findBlocks() {
+	leaders := r.leaders()
+	var starts []uint16
+	for address := range leaders {
+		starts = append(starts, address)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	for _, start := range starts {
+		block := basicBlock{address: start}
+		for address := start; address == start || !leaders[address]; {
+			instruction, ok := r.code.Instruction(address)
+			size := instruction.Size()
+			if isSkip(instruction.Kind) && r.options.Platform == device.XOChip {
+				// The length of the skip depends on the next word.
+				size += 2
+			}
+			offset := int(address) - int(r.code.Origin())
+			if !ok || !compilable(instruction.Kind) || offset+size > len(r.rom) || block.size+size > device.MaxBlockSize {
+				break
+			}
+			block.addresses = append(block.addresses, address)
+			block.size += size
+			if instruction.Kind == isa.Jump || isSkip(instruction.Kind) {
+				break
+			}
+			address += uint16(instruction.Size())
+		}
+		if len(block.addresses) > 0 {
+			r.blocks = append(r.blocks, block)
+		}
+	}
+}
+
+// Write formatted Go source to the output.
+func (r *recompilation) printf(format string, arguments ...interface{}) {
+	fmt.Fprintf(&r.output, format, arguments...)
+}
+
+// Write the program, its ROM, its compiled blocks and their functions.
+func (r *recompilation) writeProgram() {
+	r.printf("// Code generated by chip8 recompile from %s. DO NOT EDIT.\n\n", r.options.Name)
+	r.printf("// Runs %s with its code recompiled into Go, the instructions that\n", r.options.Name)
+	r.printf("// were not recompiled and modified code are run by the interpreter.\n")
+	r.printf("package main\n\n")
+	r.printf("import (\n\"flag\"\n\"fmt\"\n\"os\"\n\n")
+	r.printf("\"github.com/ambertide/chip8/pkg/emulator\"\n")
+	r.printf("\"github.com/ambertide/chip8/pkg/emulator/device\"\n")
+	r.printf("\"github.com/ambertide/chip8/pkg/frontend/audio\"\n")
+	r.printf("\"github.com/ambertide/chip8/pkg/frontend/gui\"\n)\n\n")
+	r.printf("// The ROM the program was recompiled from.\nvar rom = []byte{")
+	for i, value := range r.rom {
+		if i%16 == 0 {
+			r.printf("\n")
+		}
+		r.printf("0x%02X, ", value)
+	}
+	r.printf("\n}\n\n")
+	r.printf("// The blocks of the code of the ROM recompiled into Go.\nvar blocks = []device.CompiledBlock{\n")
+	for _, block := range r.blocks {
+		offset := int(block.address) - int(r.code.Origin())
+		r.printf("{Address: 0x%03X, Code: rom[0x%03X:0x%03X], Length: %d, Run: block%03X},\n",
+			block.address, offset, offset+block.size, len(block.addresses), block.address)
+	}
+	r.printf("}\n\n")
+	r.printf(mainFunction, r.options.Name, platformNames[r.options.Platform], r.options.Quirks)
+	for _, block := range r.blocks {
+		r.writeBlock(block)
+	}
+}
+
+// The main function of the program, which takes the name of
+// the ROM, the name of the platform and the quirks.
+const mainFunction = `func main() {
+	clockSpeed := flag.Uint64("speed", 500, "Sets the speed of the main processor in Hz.")
+	headless := flag.Bool("headless", false, "Runs without a window or sound as fast as possible, for testing.")
+	frames := flag.Uint64("frames", 0, "Stops after this many frames in headless mode, 0 means no limit.")
+	pngPath := flag.String("png", "", "Writes the final frame in headless mode to this PNG file.")
+	flag.Parse()
+	options := emulator.Options{
+		ClockSpeed:  *clockSpeed,
+		ProgramPath: %q,
+		Program:     rom,
+		Config: device.Config{
+			Platform:       device.%s,
+			Quirks:         %#v,
+			CompiledBlocks: blocks,
+		},
+	}
+	var err error
+	if *headless {
+		err = emulator.RunHeadless(options, emulator.HeadlessOptions{Frames: *frames, PNGPath: *pngPath})
+	} else {
+		gui.Run(func() { err = emulator.RunEmulator(options, gui.Renderer{}, audio.Speaker{}) })
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Return the value of VF for the carry.
+func carry(value bool) byte {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+`
+
+// Write the function of the block.
+func (r *recompilation) writeBlock(block basicBlock) {
+	last := block.addresses[len(block.addresses)-1]
+	lastInstruction, _ := r.code.Instruction(last)
+	r.printf("// Runs the instructions from 0x%03X to 0x%03X.\n", block.address, last)
+	r.printf("func block%03X(p *device.Processor) {\n", block.address)
+	if usesX, usesY := r.usesOperands(block); usesY {
+		r.printf("var vx, vy byte\n")
+	} else if usesX {
+		r.printf("var vx byte\n")
+	}
+	for _, address := range block.addresses {
+		instruction, _ := r.code.Instruction(address)
+		r.printf("// 0x%03X: %v\n", address, instruction)
+		r.writeInstruction(address, instruction)
+	}
+	if lastInstruction.Kind != isa.Jump && !isSkip(lastInstruction.Kind) {
+		r.printf("p.SetNextInstruction(0x%03X)\n", last+uint16(lastInstruction.Size()))
+	}
+	r.printf("}\n\n")
+}
+
+// Return whether the instructions of the block keep the value of
+// VX, and that of VY, in a variable since VF is written first.
+func (r *recompilation) usesOperands(block basicBlock) (bool, bool) {
+	usesX, usesY := false, false
+	for _, address := range block.addresses {
+		instruction, _ := r.code.Instruction(address)
+		switch instruction.Kind {
+		case isa.Add, isa.Sub, isa.SubN:
+			usesX, usesY = true, true
+		case isa.ShiftRight, isa.ShiftLeft:
+			usesX = true
+		}
+	}
+	return usesX, usesY
+}
+
+// Write the statements of the instruction at the address.
+func (r *recompilation) writeInstruction(address uint16, instruction isa.Instruction) {
+	x, y := fmt.Sprintf("0x%X", instruction.X), fmt.Sprintf("0x%X", instruction.Y)
+	read := func(register string) string { return "p.ReadRegister(" + register + ")" }
+	write := func(register string, value string) { r.printf("p.WriteRegister(%s, %s)\n", register, value) }
+	operands := func() { r.printf("vx, vy = %s, %s\n", read(x), read(y)) }
+	shifted := func() {
+		if r.options.Quirks.ShiftVX {
+			r.printf("vx = %s\n", read(x))
+		} else {
+			// Shift VY into VX instead.
+			r.printf("vx = %s\n", read(y))
+		}
+	}
+	bitwise := func(operator string) {
+		write(x, read(x)+operator+read(y))
+		if r.options.Quirks.ResetVF {
+			write("0xF", "0")
+		}
+	}
+	skip := func(condition string) {
+		r.printf("if %s {\np.SetNextInstruction(0x%03X)\nreturn\n}\n", condition, r.skipTarget(address))
+		r.printf("p.SetNextInstruction(0x%03X)\n", address+2)
+	}
+	switch instruction.Kind {
+	case isa.ClearScreen:
+		r.printf("p.ClearDisplay()\n")
+	case isa.Jump:
+		r.printf("p.SetNextInstruction(0x%03X)\n", instruction.NNN)
+	case isa.SkipEqualImmediate:
+		skip(fmt.Sprintf("%s == 0x%02X", read(x), instruction.NN))
+	case isa.SkipNotEqualImmediate:
+		skip(fmt.Sprintf("%s != 0x%02X", read(x), instruction.NN))
+	case isa.SkipEqual:
+		skip(read(x) + " == " + read(y))
+	case isa.SkipNotEqual:
+		skip(read(x) + " != " + read(y))
+	case isa.LoadImmediate:
+		write(x, fmt.Sprintf("0x%02X", instruction.NN))
+	case isa.AddImmediate:
+		write(x, fmt.Sprintf("%s+0x%02X", read(x), instruction.NN))
+	case isa.Move:
+		write(x, read(y))
+	case isa.Or:
+		bitwise("|")
+	case isa.And:
+		bitwise("&")
+	case isa.Xor:
+		bitwise("^")
+	case isa.Add:
+		operands()
+		write("0xF", "carry(uint16(vx)+uint16(vy) > 0xFF)")
+		write(x, "vx+vy")
+	case isa.Sub:
+		operands()
+		write("0xF", "carry(vx > vy)")
+		write(x, "vx-vy")
+	case isa.SubN:
+		operands()
+		write("0xF", "carry(vy > vx)")
+		write(x, "vy-vx")
+	case isa.ShiftRight:
+		shifted()
+		write("0xF", "vx&0x1")
+		write(x, "vx>>1")
+	case isa.ShiftLeft:
+		shifted()
+		write("0xF", "vx>>7")
+		write(x, "vx<<1")
+	case isa.LoadI:
+		r.printf("p.WriteIRegister(0x%03X)\n", instruction.NNN)
+	case isa.LoadILong:
+		r.printf("p.WriteIRegister(0x%04X)\n", instruction.NNN)
+	case isa.ReadDelay:
+		write(x, "p.DelayTimer()")
+	case isa.SetDelay:
+		r.printf("p.WriteDelayTimer(%s)\n", read(x))
+	case isa.SetSound:
+		r.printf("p.WriteSoundTimer(%s)\n", read(x))
+	case isa.AddI:
+		r.printf("p.WriteIRegister(p.ReadIRegister() + uint16(%s))\n", read(x))
+	case isa.LoadDigit:
+		r.printf("p.WriteIRegister(device.SmallFontLocation + uint16(%s)*5)\n", read(x))
+	case isa.LoadLargeDigit:
+		r.printf("p.WriteIRegister(device.LargeFontLocation + uint16(%s)*10)\n", read(x))
+	}
+}
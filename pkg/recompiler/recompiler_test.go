@@ -0,0 +1,137 @@
+package recompiler
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ambertide/chip8/pkg/emulator"
+	"github.com/ambertide/chip8/pkg/emulator/device"
+)
+
+func TestRecompile(t *testing.T) {
+	rom := []byte{
+		0x60, 0x05, // LD V0, 0x05
+		0x80, 0x14, // ADD V0, V1
+		0x30, 0x0A, // SE V0, 0x0A
+		0x12, 0x02, // JP 0x202
+		0xD0, 0x15, // DRW V0, V1, 5
+		0x12, 0x08, // JP 0x208
+	}
+	var program bytes.Buffer
+	options := Options{Platform: device.Chip8, Quirks: device.QuirksPresets["cowgod"], Name: "test.ch8"}
+	if err := Recompile(rom, options, &program); err != nil {
+		t.Fatal(err)
+	}
+	source := program.String()
+	expected := []string{
+		"// Code generated by chip8 recompile from test.ch8. DO NOT EDIT.",
+		"{Address: 0x200, Code: rom[0x000:0x002], Length: 1, Run: block200},",
+		"{Address: 0x202, Code: rom[0x002:0x006], Length: 2, Run: block202},",
+		"{Address: 0x206, Code: rom[0x006:0x008], Length: 1, Run: block206},",
+		"{Address: 0x20A, Code: rom[0x00A:0x00C], Length: 1, Run: block20A},",
+		"p.WriteRegister(0xF, carry(uint16(vx)+uint16(vy) > 0xFF))",
+		"if p.ReadRegister(0x0) == 0x0A {\n\t\tp.SetNextInstruction(0x208)",
+	}
+	for _, line := range expected {
+		if !strings.Contains(source, line) {
+			t.Fatalf("Program does not contain %q:\n%s", line, source)
+		}
+	}
+	if strings.Contains(source, "block208") {
+		t.Fatalf("Program compiled the draw at 0x208:\n%s", source)
+	}
+}
+
+func TestRecompileSkipLongLoad(t *testing.T) {
+	rom := []byte{
+		0x30, 0x00, // SE V0, 0x00
+		0xF0, 0x00, 0x03, 0x00, // LD I, LONG 0x300
+		0x12, 0x06, // JP 0x206
+	}
+	var program bytes.Buffer
+	options := Options{Platform: device.XOChip, Quirks: device.QuirksPresets["xochip"], Name: "test.ch8"}
+	if err := Recompile(rom, options, &program); err != nil {
+		t.Fatal(err)
+	}
+	source := program.String()
+	expected := []string{
+		"{Address: 0x202, Code: rom[0x002:0x006], Length: 1, Run: block202},",
+		"if p.ReadRegister(0x0) == 0x00 {\n\t\tp.SetNextInstruction(0x206)",
+	}
+	for _, line := range expected {
+		if !strings.Contains(source, line) {
+			t.Fatalf("Program does not contain %q:\n%s", line, source)
+		}
+	}
+	if strings.Contains(source, "block204") {
+		t.Fatalf("Program compiled the second word of the long load:\n%s", source)
+	}
+}
+
+// Run the ROM recompiled into a program for the frames without a
+// window, and return the final frame it wrote as a PNG image.
+func runRecompiled(t *testing.T, rom []byte, options Options, frames int) []byte {
+	var program bytes.Buffer
+	if err := Recompile(rom, options, &program); err != nil {
+		t.Fatal(err)
+	}
+	// The frontends need cgo, so the program is built without the window.
+	source := strings.NewReplacer(
+		"\"github.com/ambertide/chip8/pkg/frontend/audio\"\n", "",
+		"\"github.com/ambertide/chip8/pkg/frontend/gui\"\n", "",
+		"gui.Run(func() { err = emulator.RunEmulator(options, gui.Renderer{}, audio.Speaker{}) })", "err = fmt.Errorf(\"no window\")",
+	).Replace(program.String())
+	// The package must be within the module, directories starting with _ are ignored by ./...
+	directory, err := os.MkdirTemp(".", "_recompiled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	if err := os.WriteFile(filepath.Join(directory, "main.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pngPath := filepath.Join(t.TempDir(), "recompiled.png")
+	for _, arguments := range [][]string{
+		{"vet", "./" + directory},
+		{"run", "./" + directory, "-headless", "-frames", fmt.Sprint(frames), "-png", pngPath},
+	} {
+		if output, err := exec.Command("go", arguments...).CombinedOutput(); err != nil {
+			t.Fatalf("go %s failed with %v:\n%s", arguments[0], err, output)
+		}
+	}
+	frame, err := os.ReadFile(pngPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestRecompiledMatchesInterpreter(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil || testing.Short() {
+		t.Skip("Building the recompiled programs needs the go command.")
+	}
+	rom, err := os.ReadFile("../../test/characters.ch8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{Platform: device.Chip8, Quirks: device.QuirksPresets["cowgod"], Name: "characters.ch8"}
+	recompiled := runRecompiled(t, rom, options, 30)
+	pngPath := filepath.Join(t.TempDir(), "interpreted.png")
+	emulatorOptions := emulator.Options{ClockSpeed: 500, ProgramPath: "characters.ch8", Program: rom,
+		Config: device.Config{Platform: options.Platform, Quirks: options.Quirks}}
+	if err := emulator.RunHeadless(emulatorOptions, emulator.HeadlessOptions{Frames: 30, PNGPath: pngPath}); err != nil {
+		t.Fatal(err)
+	}
+	interpreted, err := os.ReadFile(pngPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recompiled, interpreted) {
+		t.Fatal("Recompiled program drew a different frame than the interpreter.")
+	}
+}